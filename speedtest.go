@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/showwin/speedtest-go/speedtest"
@@ -15,6 +17,19 @@ var (
 	serverIds  = kingpin.Flag("server", "Select server id to speedtest.").Short('s').Ints()
 	savingMode = kingpin.Flag("saving-mode", "Using less memory (≒10MB), though low accuracy (especially > 30Mbps).").Bool()
 	jsonOutput = kingpin.Flag("json", "Output results in json format").Bool()
+	ndjson     = kingpin.Flag("ndjson", "Stream progress and results as newline-delimited JSON events.").Bool()
+	socketMode = kingpin.Flag("socket", "Use the TCP socket protocol (port 8080) instead of HTTP.").Bool()
+	source     = kingpin.Flag("source", "Bind to the given local IP address.").IP()
+	iface      = kingpin.Flag("interface", "Bind to the given network interface.").Short('i').String()
+	share      = kingpin.Flag("share", "Submit the results to speedtest.net and show the share link.").Bool()
+	ipinfo     = kingpin.Flag("ipinfo", "Locate the caller with ipinfo.io instead of speedtest.net, which also reports the ASN.").Bool()
+	proxy      = kingpin.Flag("proxy", "Route tests through the given HTTP, HTTPS or SOCKS5 proxy, e.g. socks5://host:1080.").URL()
+	unit       = kingpin.Flag("unit", "Show speeds in decimal-bits (Mbps), decimal-bytes (MB/s), binary-bits (Mibps) or binary-bytes (MiB/s).").
+			Default("decimal-bits").Enum("decimal-bits", "decimal-bytes", "binary-bits", "binary-bytes")
+	overhead = kingpin.Flag("overhead", "Also show the estimated wire rate over ethernet, vlan, pppoe, ipv6 or docsis links.").
+			Enum("ethernet", "vlan", "pppoe", "ipv6", "docsis")
+	rateUnit     speedtest.RateUnit
+	wireOverhead *speedtest.Overhead
 )
 
 type fullOutput struct {
@@ -27,16 +42,41 @@ type outputTime time.Time
 func main() {
 	kingpin.Version("1.1.5")
 	kingpin.Parse()
+	checkError(rateUnit.UnmarshalText([]byte(*unit)))
+	if *overhead != "" {
+		o, err := speedtest.OverheadPreset(*overhead)
+		checkError(err)
+		wireOverhead = &o
+	}
 
-	user, err := speedtest.FetchUserInfo()
-	if err != nil {
-		fmt.Println("Warning: Cannot fetch user information. http://www.speedtest.net/speedtest-config.php is temporarily unavailable.")
+	var opts []speedtest.Option
+	if *source != nil {
+		opts = append(opts, speedtest.WithSourceAddr(*source))
+	}
+	if *iface != "" {
+		opts = append(opts, speedtest.WithInterface(*iface))
+	}
+	if *proxy != nil {
+		opts = append(opts, speedtest.WithProxy(*proxy))
+	}
+	if *ipinfo {
+		opts = append(opts, speedtest.WithUserInfoProvider(speedtest.IPInfoProvider{}))
+	}
+	client := speedtest.New(opts...)
+
+	if *ndjson {
+		*jsonOutput = false
+	}
+
+	user, err := client.FetchUserInfo()
+	if err != nil && !*ndjson {
+		fmt.Println("Warning: Cannot fetch user information:", err)
 	}
-	if !*jsonOutput {
+	if !*jsonOutput && !*ndjson && user != nil {
 		showUser(user)
 	}
 
-	servers, err := speedtest.FetchServers(user)
+	servers, err := client.FetchServers(user)
 	checkError(err)
 	if *showList {
 		showServerList(servers)
@@ -46,6 +86,16 @@ func main() {
 	targets, err := servers.FindServer(*serverIds)
 	checkError(err)
 
+	if *socketMode {
+		for _, s := range targets {
+			s.Type = speedtest.OoklaSocketServer
+		}
+	}
+
+	if *ndjson {
+		streamTest(targets, *savingMode)
+		return
+	}
 	startTest(targets, *savingMode, *jsonOutput)
 
 	if *jsonOutput {
@@ -78,6 +128,12 @@ func startTest(servers speedtest.Servers, savingMode bool, jsonOutput bool) {
 			err = s.UploadTest(savingMode)
 			checkError(err)
 
+			if *share {
+				// stdout carries the JSON alone; the error is also recorded in the share of the result.
+				if _, err := s.ShareResult(); err != nil {
+					fmt.Fprintln(os.Stderr, "Warning: Cannot share the result:", err)
+				}
+			}
 			continue
 		}
 
@@ -89,6 +145,9 @@ func startTest(servers speedtest.Servers, savingMode bool, jsonOutput bool) {
 		checkError(err)
 
 		showServerResult(s)
+		if *share {
+			showShare(s)
+		}
 	}
 
 	if !jsonOutput && len(servers) > 1 {
@@ -96,6 +155,23 @@ func startTest(servers speedtest.Servers, savingMode bool, jsonOutput bool) {
 	}
 }
 
+// streamTest tests the servers, writing progress and results to stdout as NDJSON events.
+func streamTest(servers speedtest.Servers, savingMode bool) {
+	w := speedtest.NewNDJSONWriter(os.Stdout)
+	cfg := speedtest.NewTestConfig(
+		speedtest.WithSavingMode(savingMode),
+		speedtest.WithProgressReporter(w, 250*time.Millisecond),
+		speedtest.WithShareResult(*share),
+	)
+	ctx := context.Background()
+	for _, s := range servers {
+		checkError(s.PingTestWithConfig(ctx, cfg))
+		checkError(s.DownloadTestWithConfig(ctx, cfg))
+		checkError(s.UploadTestWithConfig(ctx, cfg))
+		checkError(w.WriteResult(s.Result()))
+	}
+}
+
 func testDownload(server *speedtest.Server, savingMode bool) error {
 	quit := make(chan bool)
 	fmt.Printf("Download Test: ")
@@ -155,20 +231,38 @@ func showServer(s *speedtest.Server) {
 
 func showLatencyResult(server *speedtest.Server) {
 	fmt.Println("Latency:", server.Latency)
+	fmt.Printf("Jitter: %s, Packet Loss: %.1f%%\n", server.Jitter, server.PacketLoss)
 }
 
 // ShowResult : show testing result
 func showServerResult(server *speedtest.Server) {
 	fmt.Printf(" \n")
 
-	fmt.Printf("Download: %5.2f Mbit/s\n", server.DLSpeed)
-	fmt.Printf("Upload: %5.2f Mbit/s\n\n", server.ULSpeed)
+	fmt.Printf("Download: %s%s\n", server.DLRate().Format(rateUnit), wireRate(server.DLSpeed, server.IPVersion))
+	fmt.Printf("Upload: %s%s\n\n", server.ULRate().Format(rateUnit), wireRate(server.ULSpeed, server.IPVersion))
 	valid := server.CheckResultValid()
 	if !valid {
 		fmt.Println("Warning: Result seems to be wrong. Please speedtest again.")
 	}
 }
 
+// wireRate formats the wire rate of the given speed when --overhead is set.
+func wireRate(mbps float64, ipVersion int) string {
+	if wireOverhead == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (wire: %s)", speedtest.RateFromMbps(wireOverhead.WireSpeed(mbps, ipVersion)).Format(rateUnit))
+}
+
+func showShare(server *speedtest.Server) {
+	share, err := server.ShareResult()
+	if err != nil {
+		fmt.Println("Warning: Cannot share the result:", err)
+		return
+	}
+	fmt.Println("Share results:", share.URL)
+}
+
 func showAverageServerResult(servers speedtest.Servers) {
 	avgDL := 0.0
 	avgUL := 0.0
@@ -176,8 +270,8 @@ func showAverageServerResult(servers speedtest.Servers) {
 		avgDL = avgDL + s.DLSpeed
 		avgUL = avgUL + s.ULSpeed
 	}
-	fmt.Printf("Download Avg: %5.2f Mbit/s\n", avgDL/float64(len(servers)))
-	fmt.Printf("Upload Avg: %5.2f Mbit/s\n", avgUL/float64(len(servers)))
+	fmt.Printf("Download Avg: %s\n", speedtest.RateFromMbps(avgDL/float64(len(servers))).Format(rateUnit))
+	fmt.Printf("Upload Avg: %s\n", speedtest.RateFromMbps(avgUL/float64(len(servers))).Format(rateUnit))
 }
 
 func checkError(err error) {
@@ -0,0 +1,167 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultBidirectionalDuration is the duration of bidirectional tests without a TestConfig.Duration.
+const defaultBidirectionalDuration = 10 * time.Second
+
+// Streams and payload weights of the bidirectional test, those of the legacy ladder for 10 to 50 Mbit/s links.
+// There is no warm-up to pick them from, since the directions would warm each other up.
+const (
+	bidiDownloadStreams = 16
+	bidiDownloadWeight  = 4
+	bidiUploadStreams   = 16
+	bidiUploadWeight    = 9
+)
+
+// Bidirectional holds the throughput of downloads and uploads run at the same time.
+// Links with asymmetric shaping or that collapse under duplex load, such as DOCSIS and wireless links,
+// reach a Sum well below the DLSpeed and ULSpeed of separate tests.
+type Bidirectional struct {
+	DLSpeed  float64       `json:"dl_speed"` // Mbit/s
+	ULSpeed  float64       `json:"ul_speed"` // Mbit/s
+	Sum      float64       `json:"sum"`      // Mbit/s, DLSpeed + ULSpeed
+	DLBytes  int64         `json:"dl_bytes"`
+	ULBytes  int64         `json:"ul_bytes"`
+	Duration time.Duration `json:"duration"`
+	// Latency holds the round trips measured under load when TestConfig.LoadedLatency is set.
+	Latency LatencyPercentiles `json:"latency"`
+}
+
+// bidirectionalJSON is the wire format of Bidirectional.
+type bidirectionalJSON struct {
+	DLSpeed    float64            `json:"dl_speed"`
+	ULSpeed    float64            `json:"ul_speed"`
+	Sum        float64            `json:"sum"`
+	DLBytes    int64              `json:"dl_bytes"`
+	ULBytes    int64              `json:"ul_bytes"`
+	DurationMs float64            `json:"duration_ms"`
+	Latency    LatencyPercentiles `json:"latency"`
+}
+
+// MarshalJSON encodes the test with its duration in milliseconds.
+func (b Bidirectional) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bidirectionalJSON{b.DLSpeed, b.ULSpeed, b.Sum, b.DLBytes, b.ULBytes, milliseconds(b.Duration), b.Latency})
+}
+
+// UnmarshalJSON decodes a test encoded by MarshalJSON.
+func (b *Bidirectional) UnmarshalJSON(data []byte) error {
+	var v bidirectionalJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = Bidirectional{v.DLSpeed, v.ULSpeed, v.Sum, v.DLBytes, v.ULBytes, fromMilliseconds(v.DurationMs), v.Latency}
+	return nil
+}
+
+// BidirectionalTest downloads from and uploads to the server at the same time for cfg.Duration, 10 seconds if unset,
+// and records the throughput of each direction in Server.Bidirectional. DLSpeed and ULSpeed are left untouched.
+// Progress is reported for each direction as StageDownload and StageUpload.
+func (s *Server) BidirectionalTest(ctx context.Context, cfg TestConfig) error {
+	_, download, err := s.downloadFuncs(cfg)
+	if err != nil {
+		return err
+	}
+	_, upload, err := s.uploadFuncs(cfg)
+	if err != nil {
+		return err
+	}
+	doer, release, err := cfg.testClient(s.doer)
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx = withBufferBudget(ctx, newBufferBudget(cfg.MaxBufferMemory))
+	if cfg.Duration <= 0 {
+		cfg.Duration = defaultBidirectionalDuration
+	}
+
+	dlStreams, dlWeight := bidiDownloadStreams, bidiDownloadWeight
+	ulStreams, ulWeight := bidiUploadStreams, bidiUploadWeight
+	if cfg.SavingMode {
+		dlStreams, dlWeight = 6, 3
+		ulStreams, ulWeight = 1, 7
+	}
+	dlStreams, dlWeight = cfg.workload(dlStreams, dlWeight, s.downloadPayload)
+	ulStreams, ulWeight = cfg.workload(ulStreams, ulWeight, ulPayload)
+
+	sink, closeSink, err := cfg.downloadSink()
+	if err != nil {
+		return err
+	}
+	defer closeSink()
+	// Each direction is capped at cfg.RateLimit.
+	dm := &meter{limit: newTokenBucket(ctx, cfg.RateLimit), sink: sink}
+	um := &meter{limit: newTokenBucket(ctx, cfg.RateLimit)}
+
+	sTime := time.Now()
+	stopDL := reportProgress(cfg, StageDownload, dm)
+	stopUL := reportProgress(cfg, StageUpload, um)
+	stopProbe := s.probeLatency(ctx, cfg)
+	stopDLSampling := sampleThroughput(dm)
+	stopULSampling := sampleThroughput(um)
+	dlSet, ulSet := newStreamSet(dm), newStreamSet(um)
+
+	var dlElapsed, ulElapsed time.Duration
+	eg := errgroup.Group{}
+	eg.Go(func() error {
+		var err error
+		_, dlElapsed, err = cfg.runStreams(ctx, dlStreams, dlSet, func(ctx context.Context, m *meter) error {
+			return download(ctx, doer, dlWeight, m)
+		})
+		return err
+	})
+	eg.Go(func() error {
+		var err error
+		_, ulElapsed, err = cfg.runStreams(ctx, ulStreams, ulSet, func(ctx context.Context, m *meter) error {
+			return upload(ctx, doer, ulWeight, m)
+		})
+		return err
+	})
+	err = eg.Wait()
+	dlSamples := stopDLSampling()
+	ulSamples := stopULSampling()
+	loaded := stopProbe()
+	stopDL()
+	stopUL()
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	b := &Bidirectional{
+		DLSpeed:  mbps(dm.total(), dlElapsed),
+		ULSpeed:  mbps(um.total(), ulElapsed),
+		DLBytes:  int64(dm.total()),
+		ULBytes:  int64(um.total()),
+		Duration: time.Since(sTime),
+		Latency:  latencyPercentiles(loaded),
+	}
+	if w := dlSet.drainWindow(); w != nil {
+		b.DLSpeed = mbps(w.bytes, w.length)
+		dlSamples = w.samples(dlSamples)
+	}
+	if w := ulSet.drainWindow(); w != nil {
+		b.ULSpeed = mbps(w.bytes, w.length)
+		ulSamples = w.samples(ulSamples)
+	}
+	if speed, ok := estimateThroughput(dlSamples, cfg.Estimator); ok {
+		b.DLSpeed = speed
+	}
+	if speed, ok := estimateThroughput(ulSamples, cfg.Estimator); ok {
+		b.ULSpeed = speed
+	}
+	b.Sum = b.DLSpeed + b.ULSpeed
+	s.Bidirectional = b
+	s.setStreamsRemote(dlSet.stats())
+	s.markTest(sTime)
+	if err != nil {
+		return &InterruptedError{Stage: StageBidirectional, Result: s.Result(), Err: ctx.Err()}
+	}
+	return nil
+}
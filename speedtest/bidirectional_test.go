@@ -0,0 +1,75 @@
+package speedtest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBidirectionalTest(t *testing.T) {
+	ts := newLibrespeedTestServer(false)
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Type = LibrespeedServer
+
+	var mu sync.Mutex
+	stages := map[Stage]bool{}
+	reporter := ProgressReporterFunc(func(stage Stage, total uint64, instant, avg float64, elapsed time.Duration) {
+		mu.Lock()
+		stages[stage] = true
+		mu.Unlock()
+	})
+	cfg := NewTestConfig(
+		WithSavingMode(true),
+		WithStreamScaling(ScalingLegacy),
+		WithDuration(500*time.Millisecond),
+		WithLoadedLatency(50*time.Millisecond),
+		WithProgressReporter(reporter, 50*time.Millisecond),
+	)
+	if err := server.BidirectionalTest(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	b := server.Result().Bidirectional
+	if b == nil {
+		t.Fatal("the bidirectional test was not recorded")
+	}
+	if b.DLSpeed <= 0 || b.ULSpeed <= 0 || b.Sum != b.DLSpeed+b.ULSpeed || b.DLBytes <= 0 || b.ULBytes <= 0 {
+		t.Errorf("got unexpected result %+v", b)
+	}
+	if b.Duration < 500*time.Millisecond || b.Latency.Samples == 0 {
+		t.Errorf("got unexpected duration '%v' and latency %+v", b.Duration, b.Latency)
+	}
+	if server.DLSpeed != 0 || server.ULSpeed != 0 {
+		t.Errorf("got unexpected DLSpeed '%v' and ULSpeed '%v'", server.DLSpeed, server.ULSpeed)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !stages[StageDownload] || !stages[StageUpload] {
+		t.Errorf("got progress for stages %v", stages)
+	}
+}
+
+func TestBidirectionalTestInterrupted(t *testing.T) {
+	ts := newLibrespeedTestServer(false)
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Type = LibrespeedServer
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err = server.BidirectionalTest(ctx, NewTestConfig(WithSavingMode(true), WithDuration(time.Minute)))
+	ie, ok := err.(*InterruptedError)
+	if !ok || ie.Stage != StageBidirectional || ie.Result.Bidirectional == nil {
+		t.Fatalf("got unexpected error %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build linux
+// +build linux
+
+package speedtest
+
+import (
+	"net"
+	"syscall"
+)
+
+// bindToInterface makes d bind its sockets to the interface name with SO_BINDTODEVICE.
+func bindToInterface(d *net.Dialer, name string) {
+	d.Control = func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			serr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name)
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}
+}
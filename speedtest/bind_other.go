@@ -0,0 +1,40 @@
+//go:build !linux
+// +build !linux
+
+package speedtest
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// bindToInterface makes d bind its sockets to the first address of the interface name.
+// If the interface has no usable address, dialing fails with the lookup error.
+func bindToInterface(d *net.Dialer, name string) {
+	ip, err := interfaceAddr(name)
+	if err != nil {
+		d.Control = func(network, address string, c syscall.RawConn) error {
+			return err
+		}
+		return
+	}
+	d.LocalAddr = &net.TCPAddr{IP: ip}
+}
+
+func interfaceAddr(name string) (net.IP, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no usable address", name)
+}
@@ -0,0 +1,184 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultProbeInterval = 200 * time.Millisecond
+
+// LatencyPercentiles summarizes the successful round trips of a phase.
+type LatencyPercentiles struct {
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+	Samples int           `json:"samples"`
+}
+
+// latencyPercentilesJSON is the wire format of LatencyPercentiles.
+type latencyPercentilesJSON struct {
+	P50     float64 `json:"p50_ms"`
+	P90     float64 `json:"p90_ms"`
+	P99     float64 `json:"p99_ms"`
+	Samples int     `json:"samples"`
+}
+
+// MarshalJSON encodes the percentiles in milliseconds.
+func (p LatencyPercentiles) MarshalJSON() ([]byte, error) {
+	return json.Marshal(latencyPercentilesJSON{milliseconds(p.P50), milliseconds(p.P90), milliseconds(p.P99), p.Samples})
+}
+
+// UnmarshalJSON decodes percentiles encoded by MarshalJSON.
+func (p *LatencyPercentiles) UnmarshalJSON(data []byte) error {
+	var v latencyPercentilesJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = LatencyPercentiles{fromMilliseconds(v.P50), fromMilliseconds(v.P90), fromMilliseconds(v.P99), v.Samples}
+	return nil
+}
+
+// Bufferbloat compares idle round trips with those measured while the link is loaded.
+// Idle percentiles come from the latest latency test; a phase that was not probed is left zero.
+type Bufferbloat struct {
+	Idle     LatencyPercentiles `json:"idle"`
+	Download LatencyPercentiles `json:"download"`
+	Upload   LatencyPercentiles `json:"upload"`
+	// Grade rates the increase of the median round trip under load, from "A+" (under 5ms) to "F" (over 400ms).
+	Grade string `json:"grade"`
+}
+
+// bufferbloatGrades are the upper bounds of the latency increase for each grade, as used by the Waveform test.
+var bufferbloatGrades = []struct {
+	max   time.Duration
+	grade string
+}{
+	{5 * time.Millisecond, "A+"},
+	{30 * time.Millisecond, "A"},
+	{60 * time.Millisecond, "B"},
+	{200 * time.Millisecond, "C"},
+	{400 * time.Millisecond, "D"},
+}
+
+// grade rates the larger increase of the median round trip during download and upload over the idle median.
+func (b *Bufferbloat) grade() string {
+	loaded := b.Download.P50
+	if b.Upload.P50 > loaded {
+		loaded = b.Upload.P50
+	}
+	increase := loaded - b.Idle.P50
+	for _, g := range bufferbloatGrades {
+		if increase <= g.max {
+			return g.grade
+		}
+	}
+	return "F"
+}
+
+// latencyPercentiles computes percentiles over samples, ignoring failed (zero) round trips.
+func latencyPercentiles(samples []time.Duration) LatencyPercentiles {
+	var ok []time.Duration
+	for _, rtt := range samples {
+		if rtt > 0 {
+			ok = append(ok, rtt)
+		}
+	}
+	if len(ok) == 0 {
+		return LatencyPercentiles{}
+	}
+	sort.Slice(ok, func(i, j int) bool { return ok[i] < ok[j] })
+
+	// nearest-rank percentile
+	rank := func(p int) time.Duration {
+		i := (p*len(ok)+99)/100 - 1
+		if i < 0 {
+			i = 0
+		}
+		return ok[i]
+	}
+	return LatencyPercentiles{P50: rank(50), P90: rank(90), P99: rank(99), Samples: len(ok)}
+}
+
+// probeLatency pings the server every cfg.ProbeInterval on its own connection until the returned function is called,
+// which returns the round trips measured, zero for failures. It does nothing unless cfg.LoadedLatency is set.
+func (s *Server) probeLatency(ctx context.Context, cfg TestConfig) func() []time.Duration {
+	if !cfg.LoadedLatency {
+		return func() []time.Duration { return nil }
+	}
+	interval := cfg.ProbeInterval
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+
+	// Probes are not part of the timing of the phase under load.
+	ctx, cancel := context.WithCancel(withTiming(ctx, nil))
+	var mu sync.Mutex
+	var samples []time.Duration
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		ping, _, closer, err := s.pinger(ctx, cfg)
+		if err != nil {
+			return
+		}
+		if closer != nil {
+			defer closer.Close()
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			pingCtx, cancelPing := context.WithTimeout(ctx, pingTimeout)
+			rtt, err := ping(pingCtx)
+			cancelPing()
+			if ctx.Err() != nil {
+				// Round trips cut short by the end of the phase are not loss.
+				return
+			}
+			if err != nil {
+				rtt = 0
+			}
+			mu.Lock()
+			samples = append(samples, rtt)
+			mu.Unlock()
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() []time.Duration {
+		cancel()
+		<-finished
+		mu.Lock()
+		defer mu.Unlock()
+		return samples
+	}
+}
+
+// recordLoadedLatency stores the round trips probed during stage and updates the grade.
+func (s *Server) recordLoadedLatency(stage Stage, samples []time.Duration) {
+	if samples == nil {
+		return
+	}
+	if s.Bufferbloat == nil {
+		s.Bufferbloat = &Bufferbloat{}
+	}
+	b := s.Bufferbloat
+	b.Idle = latencyPercentiles(s.idleSamples)
+	switch stage {
+	case StageDownload:
+		b.Download = latencyPercentiles(samples)
+	case StageUpload:
+		b.Upload = latencyPercentiles(samples)
+	}
+	b.Grade = b.grade()
+}
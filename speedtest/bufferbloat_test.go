@@ -0,0 +1,76 @@
+package speedtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLatencyPercentiles(t *testing.T) {
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	samples = append(samples, 0)
+
+	p := latencyPercentiles(samples)
+	if p.P50 != 50*time.Millisecond || p.P90 != 90*time.Millisecond || p.P99 != 99*time.Millisecond || p.Samples != 100 {
+		t.Errorf("got unexpected percentiles %+v", p)
+	}
+	if (latencyPercentiles([]time.Duration{0})) != (LatencyPercentiles{}) {
+		t.Error("expected zero percentiles without successful round trips")
+	}
+}
+
+func TestBufferbloatGrade(t *testing.T) {
+	for _, tc := range []struct {
+		idle, dl, ul time.Duration
+		expected     string
+	}{
+		{idle: 20 * time.Millisecond, dl: 22 * time.Millisecond, ul: 21 * time.Millisecond, expected: "A+"},
+		{idle: 20 * time.Millisecond, dl: 22 * time.Millisecond, ul: 70 * time.Millisecond, expected: "B"},
+		{idle: 20 * time.Millisecond, dl: 500 * time.Millisecond, expected: "F"},
+	} {
+		b := &Bufferbloat{
+			Idle:     LatencyPercentiles{P50: tc.idle},
+			Download: LatencyPercentiles{P50: tc.dl},
+			Upload:   LatencyPercentiles{P50: tc.ul},
+		}
+		if g := b.grade(); g != tc.expected {
+			t.Errorf("got grade %v for %+v, expected %v", g, b, tc.expected)
+		}
+	}
+}
+
+func TestDownloadTestLoadedLatency(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	server := Server{
+		URL:  ts.URL + "/speedtest/upload.php",
+		doer: http.DefaultClient,
+	}
+	if err := server.PingTest(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := server.downloadTestContext(
+		context.Background(),
+		NewTestConfig(WithMaxStreams(1), WithLoadedLatency(50*time.Millisecond)),
+		mockWarmUp,
+		mockRequest,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := server.Bufferbloat
+	if b == nil {
+		t.Fatal("loaded latency was not recorded")
+	}
+	if b.Idle.Samples != defaultPingCount || b.Download.Samples < 5 || b.Upload.Samples != 0 || b.Grade != "A+" {
+		t.Errorf("got unexpected bufferbloat %+v", b)
+	}
+}
@@ -0,0 +1,81 @@
+package speedtest
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// copyBufferSize is the size of the buffers downloads are copied through.
+const copyBufferSize = 32 * 1024
+
+// copyBuffers recycles copy buffers across requests and tests, so that downloads do not allocate one per request.
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		return new([copyBufferSize]byte)
+	},
+}
+
+// bufferBudget holds a slot for every copy buffer a test may use at once. A nil budget is unbounded.
+type bufferBudget chan struct{}
+
+// newBufferBudget returns the budget of maxBytes of copy buffers, at least one, or nil if maxBytes is not positive.
+func newBufferBudget(maxBytes int64) bufferBudget {
+	if maxBytes <= 0 {
+		return nil
+	}
+	n := maxBytes / copyBufferSize
+	if n < 1 {
+		n = 1
+	}
+	return make(bufferBudget, n)
+}
+
+type bufferKey struct{}
+
+// withBufferBudget returns a context whose downloads copy within budget.
+func withBufferBudget(ctx context.Context, budget bufferBudget) context.Context {
+	return context.WithValue(ctx, bufferKey{}, budget)
+}
+
+// copyPayload copies src to dst through pooled buffers and returns the number of bytes copied.
+// A buffer is only held for one read and write, within the budget of ctx if any, so that the memory of concurrent
+// downloads stays bounded; streams beyond the budget take turns.
+func copyPayload(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	budget, _ := ctx.Value(bufferKey{}).(bufferBudget)
+	var written int64
+	for {
+		if budget != nil {
+			select {
+			case budget <- struct{}{}:
+			case <-ctx.Done():
+				return written, ctx.Err()
+			}
+		}
+		buf := copyBuffers.Get().(*[copyBufferSize]byte)
+		nr, rerr := src.Read(buf[:])
+		var werr error
+		if nr > 0 {
+			var nw int
+			nw, werr = dst.Write(buf[:nr])
+			written += int64(nw)
+			if werr == nil && nw != nr {
+				werr = io.ErrShortWrite
+			}
+		}
+		copyBuffers.Put(buf)
+		if budget != nil {
+			<-budget
+		}
+
+		if werr != nil {
+			return written, werr
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
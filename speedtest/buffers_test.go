@@ -0,0 +1,83 @@
+package speedtest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func TestCopyPayload(t *testing.T) {
+	src := bytes.Repeat([]byte("speedtest"), 10000)
+	var dst bytes.Buffer
+	n, err := copyPayload(context.Background(), &dst, bytes.NewReader(src))
+	if err != nil || n != int64(len(src)) || !bytes.Equal(dst.Bytes(), src) {
+		t.Errorf("got %v bytes and error %v", n, err)
+	}
+}
+
+// concurrentWriter records the largest number of concurrent writes.
+type concurrentWriter struct {
+	active, max int32
+	mu          sync.Mutex
+}
+
+func (w *concurrentWriter) Write(p []byte) (int, error) {
+	n := atomic.AddInt32(&w.active, 1)
+	w.mu.Lock()
+	if n > w.max {
+		w.max = n
+	}
+	w.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	atomic.AddInt32(&w.active, -1)
+	return len(p), nil
+}
+
+func TestCopyPayloadBudget(t *testing.T) {
+	w := &concurrentWriter{}
+	ctx := withBufferBudget(context.Background(), newBufferBudget(2*copyBufferSize))
+	eg := errgroup.Group{}
+	for i := 0; i < 8; i++ {
+		eg.Go(func() error {
+			_, err := copyPayload(ctx, w, io.LimitReader(newPayload(1<<20, PayloadRepeat), 4*copyBufferSize))
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if w.max != 2 {
+		t.Errorf("got %v concurrent buffers, expected 2", w.max)
+	}
+
+	ctx, cancel := context.WithCancel(withBufferBudget(context.Background(), newBufferBudget(1)))
+	budget := ctx.Value(bufferKey{}).(bufferBudget)
+	budget <- struct{}{} // exhaust the budget
+	cancel()
+	if _, err := copyPayload(ctx, w, bytes.NewReader([]byte("x"))); err != context.Canceled {
+		t.Errorf("got unexpected error %v while waiting for a buffer", err)
+	}
+}
+
+func TestDownloadMaxBufferMemory(t *testing.T) {
+	ts := newLibrespeedTestServer(false)
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Type = LibrespeedServer
+	if err := server.DownloadTestWithConfig(context.Background(), NewTestConfig(WithSavingMode(true), WithMaxBufferMemory(1))); err != nil {
+		t.Fatal(err)
+	}
+	if r := server.Result(); r.DLSpeed <= 0 || r.DLBytes != 6*int64(server.downloadPayload(3)) {
+		t.Errorf("got unexpected DLSpeed '%v' and DLBytes '%v'", r.DLSpeed, r.DLBytes)
+	}
+}
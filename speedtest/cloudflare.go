@@ -0,0 +1,111 @@
+package speedtest
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CloudflareURL is the base URL of Cloudflare's speed test.
+const CloudflareURL = "https://speed.cloudflare.com"
+
+// FetchCloudflareServer returns a Server for Cloudflare's speed test, described by the data center serving the client.
+func (client *Speedtest) FetchCloudflareServer() (*Server, error) {
+	return client.FetchCloudflareServerContext(context.Background())
+}
+
+// FetchCloudflareServerContext returns a Server for Cloudflare's speed test, described by the data center serving the client,
+// observing the given context.
+func (client *Speedtest) FetchCloudflareServerContext(ctx context.Context) (*Server, error) {
+	return client.cloudflareServer(ctx, CloudflareURL)
+}
+
+// FetchCloudflareServer returns a Server for Cloudflare's speed test, described by the data center serving the client.
+func FetchCloudflareServer() (*Server, error) {
+	return defaultClient.FetchCloudflareServer()
+}
+
+// FetchCloudflareServerContext returns a Server for Cloudflare's speed test, described by the data center serving the client,
+// observing the given context.
+func FetchCloudflareServerContext(ctx context.Context) (*Server, error) {
+	return defaultClient.FetchCloudflareServerContext(ctx)
+}
+
+func (client *Speedtest) cloudflareServer(ctx context.Context, baseURL string) (*Server, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		URL:       baseURL,
+		Sponsor:   "Cloudflare",
+		Host:      u.Host,
+		Type:      CloudflareServer,
+		doer:      client.doer,
+		dialer:    client.dialer,
+		proxy:     client.proxy,
+		netDialer: client.netDialer,
+	}
+
+	trace, err := fetchCloudflareTrace(ctx, client.doer, s.cloudflareBase()+"/cdn-cgi/trace")
+	if err != nil {
+		return nil, err
+	}
+	s.ID = trace["colo"]
+	s.Name = trace["colo"]
+	s.Country = trace["loc"]
+	return s, nil
+}
+
+// fetchCloudflareTrace returns the key=value lines of /cdn-cgi/trace, such as colo (the data center), loc (the client's country) and ip.
+func fetchCloudflareTrace(ctx context.Context, doer *http.Client, traceURL string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, traceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doer.Do(req)
+	if err != nil {
+		return nil, connError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	trace := map[string]string{}
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if i := strings.IndexByte(sc.Text(), '='); i > 0 {
+			trace[sc.Text()[:i]] = sc.Text()[i+1:]
+		}
+	}
+	return trace, sc.Err()
+}
+
+// cloudflareBase returns the server URL without a trailing slash, to which endpoints are appended.
+func (s *Server) cloudflareBase() string {
+	return strings.TrimSuffix(s.URL, "/")
+}
+
+// cloudflareProtocol tests Cloudflare's speed test: __down serves the requested number of bytes, __up accepts uploads
+// and /cdn-cgi/trace answers pings.
+type cloudflareProtocol struct{}
+
+func (cloudflareProtocol) BuildDownloadRequest(ctx context.Context, s *Server, w int) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, s.cloudflareBase()+"/__down?bytes="+strconv.Itoa(dlPayload(w)), nil)
+}
+
+func (cloudflareProtocol) BuildUploadRequest(ctx context.Context, s *Server, _ int64) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodPost, s.cloudflareBase()+"/__up", nil)
+}
+
+func (cloudflareProtocol) BuildPingRequest(ctx context.Context, s *Server) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, s.cloudflareBase()+"/cdn-cgi/trace", nil)
+}
+
+func (cloudflareProtocol) PayloadSize(w int) int {
+	return dlPayload(w)
+}
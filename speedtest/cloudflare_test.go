@@ -0,0 +1,56 @@
+package speedtest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestCloudflareServer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/__down", func(w http.ResponseWriter, r *http.Request) {
+		size, _ := strconv.Atoi(r.URL.Query().Get("bytes"))
+		io.Copy(w, newPayload(int64(size), PayloadRepeat))
+	})
+	mux.HandleFunc("/__up", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+	})
+	mux.HandleFunc("/cdn-cgi/trace", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "fl=29f1\nh=speed.cloudflare.com\nip=192.0.2.1\ncolo=NRT\nloc=JP\n")
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	server, err := New().cloudflareServer(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.ID != "NRT" || server.Country != "JP" || server.Type != CloudflareServer {
+		t.Fatalf("got unexpected server %+v", server)
+	}
+
+	if err := server.PingTestWithConfig(context.Background(), NewTestConfig(WithPingCount(2))); err != nil {
+		t.Fatal(err)
+	}
+	if server.LatencyMethod != LatencyHTTP || server.MinLatency <= 0 {
+		t.Errorf("got unexpected latency method '%v' and latency '%v'", server.LatencyMethod, server.MinLatency)
+	}
+
+	if err := server.DownloadTest(true); err != nil {
+		t.Fatal(err)
+	}
+	if r := server.Result(); r.DLSpeed <= 0 || r.DLBytes != 6*int64(dlPayload(3)) {
+		t.Errorf("got unexpected DLSpeed '%v' and DLBytes '%v'", r.DLSpeed, r.DLBytes)
+	}
+
+	if err := server.UploadTest(true); err != nil {
+		t.Fatal(err)
+	}
+	if server.ULSpeed <= 0 {
+		t.Errorf("got unexpected server.ULSpeed '%v'", server.ULSpeed)
+	}
+}
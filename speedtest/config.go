@@ -0,0 +1,370 @@
+package speedtest
+
+import (
+	"io"
+	"time"
+)
+
+const defaultWarmUpStreams = 2
+
+// TestConfig controls how download and upload tests are run.
+// The zero value runs the tests the same way DownloadTest(false) and UploadTest(false) do.
+type TestConfig struct {
+	// Duration, when non-zero, keeps every stream issuing requests until it has elapsed
+	// instead of running a single request per stream.
+	Duration time.Duration
+	// StreamScaling selects how the number of concurrent streams is chosen. The zero value scales adaptively
+	// when Duration is set and uses the legacy ladder otherwise.
+	StreamScaling StreamScaling
+	// MaxStreams caps the number of concurrent streams. 0 means no cap for the legacy ladder and 64 for adaptive scaling.
+	MaxStreams int
+	// SavingMode uses a small fixed workload to limit memory usage at the cost of accuracy.
+	SavingMode bool
+	// WarmUpStreams is the number of concurrent warm-up requests. 0 means 2.
+	WarmUpStreams int
+	// WarmUpDuration and WarmUpBytes budget the warm-up: its streams keep issuing requests until WarmUpDuration
+	// has elapsed or they have moved WarmUpBytes, whichever comes first. Zero values leave that limit off;
+	// with neither set, every stream issues a single request.
+	WarmUpDuration time.Duration
+	WarmUpBytes    int64
+	// PayloadSize is the approximate size in bytes of each request. The largest payload not exceeding
+	// it is used. 0 chooses the payload from the warm-up speed.
+	PayloadSize int
+	// PayloadPattern selects the content of HTTP upload payloads, which are generated on the fly unless UploadSource is set.
+	PayloadPattern PayloadPattern
+	// DownloadWriter, when set, also receives the payloads downloaded in the main phase, so that the test includes
+	// writing them, e.g. to storage. Writes of concurrent streams are serialized.
+	DownloadWriter io.Writer
+	// MaxBufferMemory caps the memory of the buffers downloads are copied through at once, in bytes, for memory-constrained
+	// devices. Buffers are 32 KiB and pooled; when streams need more than the cap, they take turns. 0 means no cap.
+	MaxBufferMemory int64
+	// DownloadTempFile writes the payloads downloaded in the main phase to a temporary file, removed after the test.
+	DownloadTempFile bool
+	// UploadSource, when set, provides the content of HTTP upload payloads instead of PayloadPattern. Payloads are
+	// read from its UploadSourceSize bytes in turn, wrapping around at the end; an *os.File and its size will do.
+	UploadSource     io.ReaderAt
+	UploadSourceSize int64
+	// ConnConfig controls connection reuse and HTTP/2 for HTTP tests. Set, it gives the test its own connection pool.
+	ConnConfig
+	// Reporter, when set, receives progress of the main phase every ReportInterval.
+	Reporter ProgressReporter
+	// ReportInterval is the interval between progress reports. 0 means 500ms.
+	ReportInterval time.Duration
+	// Estimator selects how the speed is computed from the throughput sampled every 100ms, past the first quarter
+	// of the main phase which is discarded as ramp-up. Phases too short to sample fall back to total bytes over duration.
+	Estimator SpeedEstimator
+	// Drain ends the main phase gracefully at its deadline, the end of Duration or DrainGrace before the deadline of the
+	// test's context if earlier: no request is started past it, and requests in flight have DrainGrace to complete
+	// before they are cancelled, without failing the test. Their bytes are counted, but the speed is measured
+	// until the deadline. Without Drain, the context deadline cancels requests in flight and interrupts the test.
+	Drain bool
+	// DrainGrace is the time requests in flight have to complete past the deadline of a drained test. 0 means 2s.
+	DrainGrace time.Duration
+	// Soak makes a long main phase, of minutes to hours of Duration, survive failing requests: a failed request is
+	// retried over a new connection after a backoff instead of failing the test, and the phase is checkpointed every
+	// CheckpointInterval, see Server.Soak. Soak has no effect without Duration, and errors of the warm-up still fail the test.
+	Soak bool
+	// CheckpointInterval is the interval between the checkpoints of a soak test. 0 means 1 minute.
+	CheckpointInterval time.Duration
+	// SoakReporter, when set, receives every checkpoint of a soak test, the last one when the main phase ends.
+	SoakReporter SoakReporter
+	// Overhead models the per-packet overhead DLWireSpeed and ULWireSpeed are estimated with. nil means OverheadEthernet.
+	Overhead *Overhead
+	// RateLimit caps the warm-up and the main phase at the given rate in Mbit/s, shared by all streams. 0 means no cap.
+	// Whether a test reached the cap is recorded in Server.DLCapReached and Server.ULCapReached.
+	RateLimit float64
+
+	// UDPAddr is the address of the companion UDP test server of UDPTest, see ServeUDP. Empty means port 5202
+	// of the server's host.
+	UDPAddr string
+	// UDPRate is the rate in Mbit/s UDPTest sends datagrams at in each direction. 0 means 10.
+	UDPRate float64
+	// UDPPacketSize is the size in bytes of the datagrams of UDPTest. 0 means 1200.
+	UDPPacketSize int
+
+	// PingCount is the number of round trips measured by the latency test. 0 means 3.
+	PingCount int
+	// LatencyMethod selects how round trips are measured. The zero value uses the server type's native method.
+	LatencyMethod LatencyMethod
+	// LoadedLatency probes round trips every ProbeInterval during the main phase of download and upload tests
+	// and records them in Server.Bufferbloat, compared with the round trips of the latest latency test.
+	LoadedLatency bool
+	// ProbeInterval is the interval between loaded latency probes. 0 means 200ms.
+	ProbeInterval time.Duration
+	// TracePath captures the path to the server, see Server.TracePath, before the latency test.
+	// A failed trace is recorded in Path.Error and does not fail the latency test.
+	TracePath bool
+	// TraceMethod selects the probes of the path trace.
+	TraceMethod TraceMethod
+	// TraceMaxHops is the largest TTL probed by the path trace. 0 means 30.
+	TraceMaxHops int
+	// TraceProbes is the number of probes sent to every hop. 0 means 3.
+	TraceProbes int
+	// ProxyLatencyCorrection subtracts the round trip to the proxy from the latency figures of a proxied test,
+	// so that they describe the path from the proxy to the server. Server.FullPathLatency keeps the full path.
+	ProxyLatencyCorrection bool
+
+	// ShareResult submits the results to speedtest.net or a LibreSpeed backend after a successful upload test,
+	// see Server.ShareResult. A failed submission is recorded in Share.Error and does not fail the upload test.
+	ShareResult bool
+
+	// ServerCount is the number of lowest-latency servers TestMultiple tests. 0 means 1.
+	ServerCount int
+	// Concurrent makes TestMultiple test the selected servers at the same time instead of one after another.
+	Concurrent bool
+}
+
+// TestOption is a function that modifies a TestConfig.
+type TestOption func(*TestConfig)
+
+// NewTestConfig creates a TestConfig with the given options applied.
+func NewTestConfig(opts ...TestOption) TestConfig {
+	var cfg TestConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithDuration sets TestConfig.Duration.
+func WithDuration(d time.Duration) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.Duration = d
+	}
+}
+
+// WithStreamScaling sets TestConfig.StreamScaling.
+func WithStreamScaling(scaling StreamScaling) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.StreamScaling = scaling
+	}
+}
+
+// WithMaxStreams sets TestConfig.MaxStreams.
+func WithMaxStreams(n int) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.MaxStreams = n
+	}
+}
+
+// WithSavingMode sets TestConfig.SavingMode.
+func WithSavingMode(savingMode bool) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.SavingMode = savingMode
+	}
+}
+
+// WithWarmUpStreams sets TestConfig.WarmUpStreams.
+func WithWarmUpStreams(n int) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.WarmUpStreams = n
+	}
+}
+
+// WithWarmUp sets TestConfig.WarmUpDuration and TestConfig.WarmUpBytes.
+func WithWarmUp(duration time.Duration, bytes int64) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.WarmUpDuration = duration
+		cfg.WarmUpBytes = bytes
+	}
+}
+
+// WithPayloadSize sets TestConfig.PayloadSize.
+func WithPayloadSize(bytes int) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.PayloadSize = bytes
+	}
+}
+
+// WithPayloadPattern sets TestConfig.PayloadPattern.
+func WithPayloadPattern(pattern PayloadPattern) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.PayloadPattern = pattern
+	}
+}
+
+// WithDownloadWriter sets TestConfig.DownloadWriter.
+func WithDownloadWriter(w io.Writer) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.DownloadWriter = w
+	}
+}
+
+// WithMaxBufferMemory sets TestConfig.MaxBufferMemory.
+func WithMaxBufferMemory(bytes int64) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.MaxBufferMemory = bytes
+	}
+}
+
+// WithDownloadTempFile sets TestConfig.DownloadTempFile.
+func WithDownloadTempFile() TestOption {
+	return func(cfg *TestConfig) {
+		cfg.DownloadTempFile = true
+	}
+}
+
+// WithUploadSource sets TestConfig.UploadSource and TestConfig.UploadSourceSize.
+func WithUploadSource(src io.ReaderAt, size int64) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.UploadSource = src
+		cfg.UploadSourceSize = size
+	}
+}
+
+// WithProgressReporter sets TestConfig.Reporter and TestConfig.ReportInterval.
+func WithProgressReporter(reporter ProgressReporter, interval time.Duration) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.Reporter = reporter
+		cfg.ReportInterval = interval
+	}
+}
+
+// WithEstimator sets TestConfig.Estimator.
+func WithEstimator(estimator SpeedEstimator) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.Estimator = estimator
+	}
+}
+
+// WithDrain sets TestConfig.Drain, with the given DrainGrace.
+func WithDrain(grace time.Duration) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.Drain = true
+		cfg.DrainGrace = grace
+	}
+}
+
+// WithSoak sets TestConfig.Soak, with the given Duration, CheckpointInterval and SoakReporter.
+func WithSoak(duration, interval time.Duration, reporter SoakReporter) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.Soak = true
+		cfg.Duration = duration
+		cfg.CheckpointInterval = interval
+		cfg.SoakReporter = reporter
+	}
+}
+
+// WithOverhead sets TestConfig.Overhead.
+func WithOverhead(o Overhead) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.Overhead = &o
+	}
+}
+
+// WithRateLimit sets TestConfig.RateLimit.
+func WithRateLimit(mbps float64) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.RateLimit = mbps
+	}
+}
+
+// WithUDP sets TestConfig.UDPAddr, UDPRate and UDPPacketSize.
+func WithUDP(addr string, mbps float64, packetSize int) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.UDPAddr = addr
+		cfg.UDPRate = mbps
+		cfg.UDPPacketSize = packetSize
+	}
+}
+
+// WithPingCount sets TestConfig.PingCount.
+func WithPingCount(n int) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.PingCount = n
+	}
+}
+
+// WithLatencyMethod sets TestConfig.LatencyMethod.
+func WithLatencyMethod(method LatencyMethod) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.LatencyMethod = method
+	}
+}
+
+// WithLoadedLatency sets TestConfig.LoadedLatency and TestConfig.ProbeInterval.
+func WithLoadedLatency(interval time.Duration) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.LoadedLatency = true
+		cfg.ProbeInterval = interval
+	}
+}
+
+// WithPathTrace sets TestConfig.TracePath, TestConfig.TraceMethod and TestConfig.TraceMaxHops.
+func WithPathTrace(method TraceMethod, maxHops int) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.TracePath = true
+		cfg.TraceMethod = method
+		cfg.TraceMaxHops = maxHops
+	}
+}
+
+// WithProxyLatencyCorrection sets TestConfig.ProxyLatencyCorrection.
+func WithProxyLatencyCorrection(correct bool) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.ProxyLatencyCorrection = correct
+	}
+}
+
+// WithShareResult sets TestConfig.ShareResult.
+func WithShareResult(share bool) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.ShareResult = share
+	}
+}
+
+// WithServerCount sets TestConfig.ServerCount.
+func WithServerCount(n int) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.ServerCount = n
+	}
+}
+
+// WithConcurrent sets TestConfig.Concurrent.
+func WithConcurrent(concurrent bool) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.Concurrent = concurrent
+	}
+}
+
+func (cfg TestConfig) warmUpStreams() int {
+	if cfg.WarmUpStreams <= 0 {
+		return defaultWarmUpStreams
+	}
+	return cfg.WarmUpStreams
+}
+
+// warmUpContinues reports whether the warm-up streams issue another request after elapsed and total bytes.
+func (cfg TestConfig) warmUpContinues(elapsed time.Duration, total int64) bool {
+	if cfg.WarmUpDuration <= 0 && cfg.WarmUpBytes <= 0 {
+		return false
+	}
+	return (cfg.WarmUpDuration <= 0 || elapsed < cfg.WarmUpDuration) && (cfg.WarmUpBytes <= 0 || total < cfg.WarmUpBytes)
+}
+
+// workload applies MaxStreams and PayloadSize to the workload chosen from the warm-up speed.
+// payload returns the size in bytes of a request with the given weight.
+func (cfg TestConfig) workload(workload, weight int, payload func(int) int) (int, int) {
+	if cfg.MaxStreams > 0 && workload > cfg.MaxStreams {
+		workload = cfg.MaxStreams
+	}
+	if cfg.PayloadSize > 0 {
+		weight = 0
+		for w := range dlSizes {
+			if payload(w) <= cfg.PayloadSize {
+				weight = w
+			}
+		}
+	}
+	return workload, weight
+}
+
+// dlPayload returns the size in bytes of random{N}x{N}.jpg for weight w.
+func dlPayload(w int) int {
+	return dlSizes[w] * dlSizes[w] * 2
+}
+
+// ulPayload returns the size in bytes of an upload for weight w.
+func ulPayload(w int) int {
+	return ulSizes[w] * 1000
+}
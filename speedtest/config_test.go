@@ -0,0 +1,55 @@
+package speedtest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTestConfig(t *testing.T) {
+	cfg := NewTestConfig(
+		WithDuration(10*time.Second),
+		WithMaxStreams(8),
+		WithSavingMode(true),
+		WithWarmUpStreams(4),
+		WithPayloadSize(1000000),
+	)
+
+	expected := TestConfig{
+		Duration:      10 * time.Second,
+		MaxStreams:    8,
+		SavingMode:    true,
+		WarmUpStreams: 4,
+		PayloadSize:   1000000,
+	}
+	if cfg != expected {
+		t.Errorf("got: %+v, expected: %+v", cfg, expected)
+	}
+
+	if (TestConfig{}).warmUpStreams() != 2 {
+		t.Errorf("got unexpected default warm up streams %v", (TestConfig{}).warmUpStreams())
+	}
+}
+
+func TestTestConfigWorkload(t *testing.T) {
+	workload, weight := TestConfig{}.workload(32, 6, dlPayload)
+	if workload != 32 || weight != 6 {
+		t.Errorf("got: %v/%v, expected: 32/6", workload, weight)
+	}
+
+	workload, weight = TestConfig{MaxStreams: 4, PayloadSize: 1000000}.workload(32, 6, dlPayload)
+	if workload != 4 || weight != 1 {
+		t.Errorf("got: %v/%v, expected: 4/1", workload, weight)
+	}
+
+	_, weight = TestConfig{PayloadSize: 1000000}.workload(40, 9, ulPayload)
+	if weight != 4 {
+		t.Errorf("got: %v, expected: 4", weight)
+	}
+
+	// LibreSpeed payloads are whole MiB chunks: 2 chunks exceed 2MB where random1000x1000.jpg does not.
+	server := &Server{URL: "http://dummy.com/backend", Type: LibrespeedServer}
+	_, weight = TestConfig{PayloadSize: 2000000}.workload(8, 6, server.downloadPayload)
+	if weight != 2 {
+		t.Errorf("got: %v, expected: 2", weight)
+	}
+}
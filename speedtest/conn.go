@@ -0,0 +1,127 @@
+package speedtest
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ConnConfig controls how the HTTP connections of a test are opened and reused.
+// The zero value keeps the settings of the client's transport.
+type ConnConfig struct {
+	// MaxConnsPerHost limits the connections to a server. 0 means no limit.
+	MaxConnsPerHost int
+	// DisableKeepAlives opens a new TCP connection for every request.
+	DisableKeepAlives bool
+	// ForceAttemptHTTP2 negotiates HTTP/2 even when the transport has a custom dialer or TLS configuration.
+	ForceAttemptHTTP2 bool
+	// DisableHTTP2 restricts connections to HTTP/1.1, so that every stream of a test uses its own TCP connection
+	// instead of being multiplexed onto one.
+	DisableHTTP2 bool
+	// TLS adjusts the verification of TLS connections. nil keeps the transport's settings.
+	TLS *TLSConfig
+	// Network forces resolution and dialing over one address family: "tcp4" for IPv4 or "tcp6" for IPv6.
+	// Empty uses either. Behind a proxy, it applies to the connections to the proxy.
+	Network string
+}
+
+// isZero reports whether cc leaves the transport unchanged.
+func (cc ConnConfig) isZero() bool {
+	return cc == ConnConfig{}
+}
+
+// NewHTTPClient returns a client with the default transport settings adjusted by cc, for use with WithDoer.
+func NewHTTPClient(cc ConnConfig) *http.Client {
+	c, _ := cc.apply(nil)
+	return c
+}
+
+// WithConnConfig adjusts the transport of the client's http.Client by cc, after the other connection options, see Option.
+// It has no effect if the client's transport is not an *http.Transport.
+func WithConnConfig(cc ConnConfig) Option {
+	return func(s *Speedtest) {
+		s.connConfigs = append(s.connConfigs, cc)
+	}
+}
+
+// WithConnections sets the connection settings of TestConfig.
+func WithConnections(cc ConnConfig) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.ConnConfig = cc
+	}
+}
+
+// WithNetwork sets TestConfig.Network, "tcp4" or "tcp6", to test over one address family only.
+func WithNetwork(network string) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.Network = network
+	}
+}
+
+// apply returns a copy of c, or of a default client if c is nil, whose transport is adjusted by cc.
+// c is returned unchanged if cc is zero.
+func (cc ConnConfig) apply(c *http.Client) (*http.Client, error) {
+	if cc.isZero() {
+		return c, nil
+	}
+
+	var base *http.Transport
+	if c == nil || c.Transport == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	} else if t, ok := c.Transport.(*http.Transport); ok {
+		base = t
+	} else {
+		return nil, errors.New("connection settings require an *http.Transport")
+	}
+
+	t := base.Clone()
+	if cc.Network != "" {
+		family, err := addressFamily(cc.Network)
+		if err != nil {
+			return nil, err
+		}
+		dial := t.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		t.DialContext = familyDialer{d: dialFunc(dial), family: family}.DialContext
+	}
+	if cc.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = cc.MaxConnsPerHost
+	}
+	if cc.DisableKeepAlives {
+		t.DisableKeepAlives = true
+	}
+	if cc.ForceAttemptHTTP2 {
+		t.ForceAttemptHTTP2 = true
+	}
+	if cc.DisableHTTP2 {
+		// A non-nil, empty TLSNextProto disables HTTP/2.
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if cc.TLS != nil {
+		t.TLSClientConfig = cc.TLS.clientConfig(t.TLSClientConfig)
+	}
+
+	client := &http.Client{Transport: t}
+	if c != nil {
+		client.CheckRedirect = c.CheckRedirect
+		client.Jar = c.Jar
+		client.Timeout = c.Timeout
+	}
+	return client, nil
+}
+
+// testClient returns the client the test of a server runs with, and a function releasing its connections when done.
+func (cfg TestConfig) testClient(c *http.Client) (*http.Client, func(), error) {
+	if cfg.ConnConfig.isZero() {
+		return c, func() {}, nil
+	}
+	client, err := cfg.ConnConfig.apply(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, client.CloseIdleConnections, nil
+}
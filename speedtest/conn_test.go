@@ -0,0 +1,71 @@
+package speedtest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestConnConfigApply(t *testing.T) {
+	c := &http.Client{}
+	if got, _ := (ConnConfig{}).apply(c); got != c {
+		t.Error("zero ConnConfig must keep the client")
+	}
+
+	got, err := ConnConfig{MaxConnsPerHost: 4, DisableKeepAlives: true, DisableHTTP2: true}.apply(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := got.Transport.(*http.Transport)
+	if tr.MaxConnsPerHost != 4 || !tr.DisableKeepAlives || tr.ForceAttemptHTTP2 || tr.TLSNextProto == nil || len(tr.TLSNextProto) != 0 {
+		t.Errorf("got unexpected transport %+v", tr)
+	}
+	if http.DefaultTransport.(*http.Transport).DisableKeepAlives {
+		t.Error("the default transport must not be modified")
+	}
+
+	custom := &http.Client{Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, nil })}
+	if _, err := (ConnConfig{DisableKeepAlives: true}).apply(custom); err == nil {
+		t.Error("expected an error for a custom RoundTripper")
+	}
+
+	s := New(WithConnConfig(ConnConfig{ForceAttemptHTTP2: true, MaxConnsPerHost: 2}))
+	if tr, ok := s.doer.Transport.(*http.Transport); !ok || !tr.ForceAttemptHTTP2 || tr.MaxConnsPerHost != 2 {
+		t.Error("WithConnConfig did not adjust the client")
+	}
+}
+
+func TestDownloadTestDisableKeepAlives(t *testing.T) {
+	var conns int64
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(serveRandomImage))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	server := Server{URL: ts.URL + "/speedtest/upload.php", doer: http.DefaultClient}
+	warmUp, request := server.httpDownloadFuncs(standardProtocol{})
+	err := server.downloadTestContext(
+		context.Background(),
+		NewTestConfig(WithSavingMode(true), WithConnections(ConnConfig{DisableKeepAlives: true})),
+		warmUp,
+		request,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 warm-up requests and 6 requests in saving mode, each on its own connection.
+	if n := atomic.LoadInt64(&conns); n != 8 {
+		t.Errorf("got %v connections, expected 8", n)
+	}
+}
@@ -0,0 +1,67 @@
+package speedtest
+
+import (
+	"context"
+	"time"
+)
+
+// defaultDrainGrace is the time in-flight requests of a drained test have to complete past its deadline.
+const defaultDrainGrace = 2 * time.Second
+
+// drainWindow is the part of a drained main phase until its deadline, which its speed is measured over.
+type drainWindow struct {
+	length time.Duration
+	bytes  uint64 // counted by the deadline
+}
+
+// samples returns the throughput samples taken within the window.
+func (w *drainWindow) samples(samples []float64) []float64 {
+	if n := int(w.length / sampleWindow); n < len(samples) {
+		return samples[:n]
+	}
+	return samples
+}
+
+func (cfg TestConfig) drainGrace() time.Duration {
+	if cfg.DrainGrace <= 0 {
+		return defaultDrainGrace
+	}
+	return cfg.DrainGrace
+}
+
+// runDrained runs a main phase of the given duration with run, ending it at its deadline: the end of duration, or
+// grace before the deadline of ctx if that comes first. Past the deadline no request is started and those in flight
+// have grace to complete; the ones still running after it are cancelled without failing the phase.
+// The part of the phase until the deadline is recorded as the drain window of set.
+// A phase that completes before its deadline, or has none, runs as usual.
+func runDrained(ctx context.Context, duration, grace time.Duration, set *streamSet, run func(context.Context, time.Duration) (int64, time.Duration, error)) (int64, time.Duration, error) {
+	window := duration
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline) - grace; window <= 0 || left < window {
+			window = left
+		}
+	}
+	if window <= 0 {
+		return run(ctx, duration)
+	}
+	if duration > 0 {
+		// Streams of a phase without duration issue a single request each, whenever the deadline.
+		duration = window
+	}
+
+	requestCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	mark := time.AfterFunc(window, func() {
+		set.setDrainWindow(&drainWindow{length: window, bytes: set.m.total()})
+	})
+	cut := time.AfterFunc(window+grace, cancel)
+	requests, elapsed, err := run(requestCtx, duration)
+	mark.Stop()
+	cut.Stop()
+	if err != nil && requestCtx.Err() != nil && set.drainWindow() != nil {
+		// Requests still in flight at the end of the grace period were cut short as intended,
+		// whether by the grace period or by the deadline of ctx it ends at.
+		err = nil
+	}
+	return requests, elapsed, err
+}
@@ -0,0 +1,87 @@
+package speedtest
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// slowRequest writes 10KB every 10ms to m for a second, or until ctx is done.
+func slowRequest(ctx context.Context, m *meter) error {
+	buf := make([]byte, 10000)
+	for i := 0; i < 100; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			m.Write(buf)
+		}
+	}
+	return nil
+}
+
+func TestDrainAtDuration(t *testing.T) {
+	m := &meter{}
+	set := newStreamSet(m)
+	cfg := NewTestConfig(WithStreamScaling(ScalingLegacy), WithDuration(300*time.Millisecond), WithDrain(200*time.Millisecond))
+	requests, elapsed, err := cfg.runStreams(context.Background(), 2, set, slowRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 || elapsed < 500*time.Millisecond || elapsed > 800*time.Millisecond {
+		t.Errorf("got %v requests in '%v', expected the requests to be cut after the grace period", requests, elapsed)
+	}
+
+	w := set.drainWindow()
+	if w == nil || w.length != 300*time.Millisecond {
+		t.Fatalf("got unexpected drain window %+v", w)
+	}
+	if w.bytes == 0 || m.total() <= w.bytes {
+		t.Errorf("got %v bytes by the deadline and %v in total", w.bytes, m.total())
+	}
+	if speed := mbps(w.bytes, w.length); speed < 2 || speed > 20 {
+		t.Errorf("got unexpected speed %v, expected about 16 Mbit/s", speed)
+	}
+	if samples := w.samples(make([]float64, 5)); len(samples) != 3 {
+		t.Errorf("got %v samples within the window, expected 3", len(samples))
+	}
+}
+
+func TestDrainAtContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+
+	m := &meter{}
+	set := newStreamSet(m)
+	cfg := NewTestConfig(WithStreamScaling(ScalingLegacy), WithDrain(100*time.Millisecond))
+	if _, _, err := cfg.runStreams(ctx, 2, set, slowRequest); err != nil {
+		t.Fatalf("got unexpected error %v", err)
+	}
+	if w := set.drainWindow(); w == nil || w.length > 300*time.Millisecond || w.bytes == 0 {
+		t.Errorf("got unexpected drain window %+v", w)
+	}
+
+	// Without Drain, the deadline interrupts the phase.
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := NewTestConfig(WithStreamScaling(ScalingLegacy)).runStreams(ctx, 2, newStreamSet(&meter{}), slowRequest); err == nil {
+		t.Error("expected the deadline to interrupt the phase")
+	}
+}
+
+func TestDrainCompletesBeforeDeadline(t *testing.T) {
+	set := newStreamSet(&meter{})
+	cfg := NewTestConfig(WithStreamScaling(ScalingLegacy), WithDuration(5*time.Second), WithDrain(0))
+	request := func(ctx context.Context, m *meter) error {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// The deadline of ctx, less the default grace period, has already passed: the phase runs as usual.
+	if _, _, err := cfg.runStreams(ctx, 1, set, request); err != nil {
+		t.Fatal(err)
+	}
+	if set.drainWindow() != nil {
+		t.Error("expected no drain window")
+	}
+}
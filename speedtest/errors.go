@@ -0,0 +1,107 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+var (
+	// ErrServerUnreachable is matched by errors.Is for failures to connect to or get a response from a server.
+	ErrServerUnreachable = errors.New("server unreachable")
+	// ErrHTTPStatus is matched by errors.Is for HTTPStatusErrors.
+	ErrHTTPStatus = errors.New("unexpected HTTP status")
+	// ErrUnsupportedServerType is returned for a ServerType the test has no implementation for.
+	ErrUnsupportedServerType = errors.New("unsupported server type")
+	// ErrPayloadTooSmall is matched by errors.Is when a server sent much less than the payload requested.
+	ErrPayloadTooSmall = errors.New("payload too small")
+	// ErrTestTimeout is matched by errors.Is for requests and tests that ran out of time.
+	ErrTestTimeout = errors.New("test timed out")
+	// ErrTestInterrupted is matched by errors.Is for the errors of tests interrupted by their context.
+	ErrTestInterrupted = errors.New("test interrupted")
+)
+
+// HTTPStatusError is returned when a server answers a test request with a status other than 2xx,
+// so that an error page is not measured as payload. It matches ErrHTTPStatus.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	URL        string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%v from %s: %s", ErrHTTPStatus, e.URL, e.Status)
+}
+
+// Is reports whether target is ErrHTTPStatus.
+func (e *HTTPStatusError) Is(target error) bool {
+	return target == ErrHTTPStatus
+}
+
+// checkStatus returns an HTTPStatusError if resp is not successful.
+// The URL is left empty for responses without their request, as custom Doers may return.
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	e := &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	if resp.Request != nil && resp.Request.URL != nil {
+		e.URL = resp.Request.URL.String()
+	}
+	return e
+}
+
+// InterruptedError is returned by a download or upload test whose context was done before it completed.
+// The server keeps the bytes and speed measured until then, which Result holds.
+// It unwraps to the context's error and matches ErrTestInterrupted, and ErrTestTimeout if the deadline was exceeded.
+type InterruptedError struct {
+	Stage  Stage
+	Result *Result
+	Err    error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("%s %v: %v", e.Stage, ErrTestInterrupted, e.Err)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrTestInterrupted, or ErrTestTimeout for an exceeded deadline.
+func (e *InterruptedError) Is(target error) bool {
+	return target == ErrTestInterrupted || target == ErrTestTimeout && errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// kindError attaches one of the sentinel errors to the error that caused it, so that errors.Is matches both.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// connError classifies an error from sending a request to or dialing a server.
+// Errors caused by ctx are returned as is; timeouts match ErrTestTimeout and other failures ErrServerUnreachable.
+func connError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return &kindError{kind: ErrTestTimeout, err: err}
+	}
+	return &kindError{kind: ErrServerUnreachable, err: err}
+}
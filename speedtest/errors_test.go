@@ -0,0 +1,123 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestHTTPStatusError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warmUp, _ := server.httpDownloadFuncs(standardProtocol{})
+	err = warmUp(context.Background(), server.doer, &meter{})
+	var se *HTTPStatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusForbidden || !errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("got unexpected download error '%v'", err)
+	}
+
+	_, upload := server.httpUploadFuncs(standardProtocol{}, patternPayload(PayloadRepeat))
+	err = upload(context.Background(), server.doer, 0, &meter{})
+	if !errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("got unexpected upload error '%v'", err)
+	}
+
+	if err := server.PingTestWithConfig(context.Background(), NewTestConfig(WithPingCount(2))); !errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("got unexpected ping error '%v'", err)
+	}
+}
+
+func TestPayloadTooSmall(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>not found</html>"))
+	}))
+	defer ts.Close()
+
+	err := downloadRequest(http.DefaultClient, ts.URL)
+	if !errors.Is(err, ErrPayloadTooSmall) {
+		t.Errorf("got unexpected error '%v'", err)
+	}
+}
+
+func TestServerUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(serveRandomImage))
+	ts.Close()
+
+	err := downloadRequest(http.DefaultClient, ts.URL)
+	if !errors.Is(err, ErrServerUnreachable) {
+		t.Errorf("got unexpected error '%v'", err)
+	}
+
+	_, err = dialSocket(context.Background(), nil, ts.Listener.Addr().String())
+	if !errors.Is(err, ErrServerUnreachable) {
+		t.Errorf("got unexpected socket error '%v'", err)
+	}
+}
+
+func TestTestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	doer := &http.Client{Timeout: 50 * time.Millisecond}
+	err := downloadRequest(doer, ts.URL)
+	if !errors.Is(err, ErrTestTimeout) {
+		t.Errorf("got unexpected error '%v'", err)
+	}
+
+	ie := &InterruptedError{Stage: StageDownload, Err: context.DeadlineExceeded}
+	if !errors.Is(ie, ErrTestTimeout) || !errors.Is(ie, ErrTestInterrupted) {
+		t.Errorf("expected '%v' to match ErrTestTimeout and ErrTestInterrupted", ie)
+	}
+	if ie := (&InterruptedError{Err: context.Canceled}); errors.Is(ie, ErrTestTimeout) {
+		t.Errorf("expected '%v' not to match ErrTestTimeout", ie)
+	}
+}
+
+func TestUnsupportedServerType(t *testing.T) {
+	server := &Server{Type: ServerType(99)}
+	if err := server.DownloadTestWithConfig(context.Background(), TestConfig{}); !errors.Is(err, ErrUnsupportedServerType) {
+		t.Errorf("got unexpected download error '%v'", err)
+	}
+	if err := server.UploadTestWithConfig(context.Background(), TestConfig{}); !errors.Is(err, ErrUnsupportedServerType) {
+		t.Errorf("got unexpected upload error '%v'", err)
+	}
+	if err := server.PingTest(); !errors.Is(err, ErrUnsupportedServerType) {
+		t.Errorf("got unexpected ping error '%v'", err)
+	}
+}
+
+// downloadRequest downloads the smallest payload of the speedtest.net server at baseURL.
+func downloadRequest(doer *http.Client, baseURL string) error {
+	_, request := (&Server{URL: baseURL + "/upload.php"}).httpDownloadFuncs(standardProtocol{})
+	return request(context.Background(), doer, 0, &meter{})
+}
+
+// serveRandomImage answers random{N}x{N}.jpg requests with the payload expected for N.
+func serveRandomImage(w http.ResponseWriter, r *http.Request) {
+	var n int
+	fmt.Sscanf(path.Base(r.URL.Path), "random%dx", &n)
+	w.Write(make([]byte, 2*n*n))
+}
+
+func TestCheckStatusWithoutRequest(t *testing.T) {
+	err := checkStatus(&http.Response{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"})
+	var se *HTTPStatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusBadGateway || se.URL != "" {
+		t.Errorf("got unexpected error '%v'", err)
+	}
+}
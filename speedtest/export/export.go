@@ -0,0 +1,354 @@
+// Package export exposes speedtest results as Prometheus metrics.
+//
+// An Exporter records Results and serves them in the Prometheus text exposition format,
+// so that probes can be scraped directly:
+//
+//	e := export.New()
+//	http.Handle("/metrics", e)
+//	go e.RunPeriodic(ctx, 15*time.Minute, speedtest.NewTestConfig(speedtest.WithServerCount(3)))
+package export
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+const (
+	defaultNamespace = "speedtest"
+	// defaultCandidates is the number of closest servers RunPeriodic pings to pick the servers it tests.
+	defaultCandidates = 10
+)
+
+var (
+	// DefaultLatencyBuckets are the upper bounds in seconds of the round trip histogram.
+	DefaultLatencyBuckets = []float64{.005, .01, .02, .05, .1, .2, .5, 1}
+	// DefaultSpeedBuckets are the upper bounds in Mbit/s of the download and upload speed histograms.
+	DefaultSpeedBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500}
+)
+
+// Exporter records speedtest results and serves them as Prometheus metrics.
+// It is safe for concurrent use.
+type Exporter struct {
+	namespace  string
+	client     *speedtest.Speedtest
+	servers    speedtest.Servers
+	candidates int
+
+	mu       sync.Mutex
+	results  map[string]*speedtest.Result // latest result by server id
+	dlBytes  map[string]int64
+	ulBytes  map[string]int64
+	errors   map[string]uint64 // by stage
+	latency  *histogram
+	dlSpeed  *histogram
+	ulSpeed  *histogram
+	lastTest time.Time
+}
+
+// Option is a function that can be passed to New to modify the Exporter.
+type Option func(*Exporter)
+
+// WithNamespace sets the prefix of the metric names. It defaults to "speedtest".
+func WithNamespace(namespace string) Option {
+	return func(e *Exporter) {
+		e.namespace = namespace
+	}
+}
+
+// WithClient sets the client RunPeriodic discovers servers with.
+func WithClient(client *speedtest.Speedtest) Option {
+	return func(e *Exporter) {
+		e.client = client
+	}
+}
+
+// WithServers makes RunPeriodic test among servers instead of the closest discovered servers.
+func WithServers(servers speedtest.Servers) Option {
+	return func(e *Exporter) {
+		e.servers = servers
+	}
+}
+
+// WithBuckets sets the upper bounds of the round trip histogram in seconds and of the speed histograms in Mbit/s.
+func WithBuckets(latency, speed []float64) Option {
+	return func(e *Exporter) {
+		e.latency = newHistogram(latency)
+		e.dlSpeed = newHistogram(speed)
+		e.ulSpeed = newHistogram(speed)
+	}
+}
+
+// New creates a new Exporter.
+func New(opts ...Option) *Exporter {
+	e := &Exporter{
+		namespace:  defaultNamespace,
+		client:     speedtest.New(),
+		candidates: defaultCandidates,
+		results:    map[string]*speedtest.Result{},
+		dlBytes:    map[string]int64{},
+		ulBytes:    map[string]int64{},
+		errors:     map[string]uint64{},
+		latency:    newHistogram(DefaultLatencyBuckets),
+		dlSpeed:    newHistogram(DefaultSpeedBuckets),
+		ulSpeed:    newHistogram(DefaultSpeedBuckets),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Observe records the result of the tests run against a server.
+func (e *Exporter) Observe(r *speedtest.Result) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.results[r.ServerID] = r
+	e.dlBytes[r.ServerID] += r.DLBytes
+	e.ulBytes[r.ServerID] += r.ULBytes
+	if r.MinLatency > 0 {
+		e.latency.observe(r.MinLatency.Seconds())
+	}
+	if r.DLSpeed > 0 {
+		e.dlSpeed.observe(r.DLSpeed)
+	}
+	if r.ULSpeed > 0 {
+		e.ulSpeed.observe(r.ULSpeed)
+	}
+	if r.FinishedAt.After(e.lastTest) {
+		e.lastTest = r.FinishedAt
+	}
+}
+
+// ObserveError records a failed test. stage names the step that failed, such as "discover" or "test".
+func (e *Exporter) ObserveError(stage string, err error) {
+	if err == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errors[stage]++
+}
+
+// RunPeriodic runs the tests configured by cfg immediately and then every interval, recording the results,
+// until ctx is done. The cfg.ServerCount lowest latency servers are tested among the servers set with WithServers,
+// or else among the closest servers discovered at each run. It returns an error without testing if interval is not positive.
+func (e *Exporter) RunPeriodic(ctx context.Context, interval time.Duration, cfg speedtest.TestConfig) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval %v must be positive", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		e.run(ctx, cfg)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (e *Exporter) run(ctx context.Context, cfg speedtest.TestConfig) {
+	servers := e.servers
+	if len(servers) == 0 {
+		discovered, err := e.client.DiscoverServersContext(ctx)
+		if err != nil {
+			e.ObserveError("discover", err)
+			return
+		}
+		servers = discovered.ClosestServers(e.candidates)
+	}
+
+	// The results of the servers that completed are recorded even if others failed.
+	mr, err := servers.TestMultiple(ctx, cfg)
+	if err != nil && ctx.Err() == nil {
+		e.ObserveError("test", err)
+	}
+	if mr == nil {
+		return
+	}
+	for _, r := range mr.Results {
+		e.Observe(r)
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = e.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format to w.
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	ids := make([]string, 0, len(e.results))
+	for id := range e.results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	gauges := []struct {
+		name, help string
+		value      func(r *speedtest.Result) float64
+	}{
+		{"download_mbps", "Download speed of the latest test in Mbit/s.", func(r *speedtest.Result) float64 { return r.DLSpeed }},
+		{"upload_mbps", "Upload speed of the latest test in Mbit/s.", func(r *speedtest.Result) float64 { return r.ULSpeed }},
+		{"latency_seconds", "Fastest round trip of the latest test.", func(r *speedtest.Result) float64 { return r.MinLatency.Seconds() }},
+		{"jitter_seconds", "Jitter of the latest test.", func(r *speedtest.Result) float64 { return r.Jitter.Seconds() }},
+		{"packet_loss_ratio", "Fraction of round trips lost in the latest test.", func(r *speedtest.Result) float64 { return r.PacketLoss / 100 }},
+	}
+	for _, g := range gauges {
+		e.header(cw, g.name, g.help, "gauge")
+		for _, id := range ids {
+			e.sample(cw, g.name, serverLabels(e.results[id]), g.value(e.results[id]))
+		}
+	}
+
+	counters := []struct {
+		name, help string
+		values     map[string]int64
+	}{
+		{"download_bytes_total", "Bytes downloaded by tests.", e.dlBytes},
+		{"upload_bytes_total", "Bytes uploaded by tests.", e.ulBytes},
+	}
+	// Counters accumulate over results, so they are labelled with the server id alone: a server renamed between
+	// tests keeps the same series.
+	for _, c := range counters {
+		e.header(cw, c.name, c.help, "counter")
+		for _, id := range ids {
+			e.sample(cw, c.name, [][2]string{{"server_id", id}}, float64(c.values[id]))
+		}
+	}
+
+	e.header(cw, "errors_total", "Tests that failed, by stage.", "counter")
+	stages := make([]string, 0, len(e.errors))
+	for stage := range e.errors {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		e.sample(cw, "errors_total", [][2]string{{"stage", stage}}, float64(e.errors[stage]))
+	}
+
+	e.header(cw, "last_test_timestamp_seconds", "Time the latest recorded test finished.", "gauge")
+	if !e.lastTest.IsZero() {
+		e.sample(cw, "last_test_timestamp_seconds", nil, float64(e.lastTest.UnixNano())/1e9)
+	}
+
+	e.writeHistogram(cw, "round_trip_seconds", "Fastest round trips of tests.", e.latency)
+	e.writeHistogram(cw, "download_speed_mbps", "Download speeds of tests in Mbit/s.", e.dlSpeed)
+	e.writeHistogram(cw, "upload_speed_mbps", "Upload speeds of tests in Mbit/s.", e.ulSpeed)
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+func (e *Exporter) header(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", e.namespace, name, help, e.namespace, name, typ)
+}
+
+func (e *Exporter) sample(w io.Writer, name string, labels [][2]string, value float64) {
+	fmt.Fprintf(w, "%s_%s%s %s\n", e.namespace, name, formatLabels(labels), formatValue(value))
+}
+
+func (e *Exporter) writeHistogram(w io.Writer, name, help string, h *histogram) {
+	e.header(w, name, help, "histogram")
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		e.sample(w, name+"_bucket", [][2]string{{"le", formatValue(bound)}}, float64(cumulative))
+	}
+	e.sample(w, name+"_bucket", [][2]string{{"le", "+Inf"}}, float64(h.count))
+	e.sample(w, name+"_sum", nil, h.sum)
+	e.sample(w, name+"_count", nil, float64(h.count))
+}
+
+func serverLabels(r *speedtest.Result) [][2]string {
+	return [][2]string{{"server_id", r.ServerID}, {"server_name", r.ServerName}, {"sponsor", r.Sponsor}}
+}
+
+func formatLabels(labels [][2]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = l[0] + `="` + labelEscaper.Replace(l[1]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// histogram counts observations in buckets with upper bounds, like a Prometheus histogram.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+	return &histogram{bounds: b, counts: make([]uint64, len(b))}
+}
+
+func (h *histogram) observe(v float64) {
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// countWriter counts the bytes written and keeps the first error.
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
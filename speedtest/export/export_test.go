@@ -0,0 +1,96 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+func TestExporterWriteTo(t *testing.T) {
+	e := New(WithBuckets([]float64{0.01, 0.1}, []float64{10, 100}))
+	e.Observe(&speedtest.Result{
+		ServerID:   "6691",
+		ServerName: `Shizuoka "JP"`,
+		FinishedAt: time.Unix(1609459200, 0),
+		MinLatency: 20 * time.Millisecond,
+		DLSpeed:    73.5,
+		ULSpeed:    35,
+		DLBytes:    1000,
+	})
+	e.Observe(&speedtest.Result{ServerID: "6691", MinLatency: 5 * time.Millisecond, DLSpeed: 50, DLBytes: 500})
+	e.ObserveError("test", errors.New("unreachable"))
+
+	var buf bytes.Buffer
+	n, err := e.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("got %v bytes written, expected %v", n, buf.Len())
+	}
+
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE speedtest_download_mbps gauge",
+		`speedtest_download_mbps{server_id="6691",server_name="",sponsor=""} 50`,
+		`speedtest_download_bytes_total{server_id="6691"} 1500`,
+		`speedtest_errors_total{stage="test"} 1`,
+		"speedtest_last_test_timestamp_seconds 1.6094592e+09",
+		`speedtest_round_trip_seconds_bucket{le="0.01"} 1`,
+		`speedtest_round_trip_seconds_bucket{le="0.1"} 2`,
+		`speedtest_round_trip_seconds_bucket{le="+Inf"} 2`,
+		"speedtest_round_trip_seconds_count 2",
+		`speedtest_download_speed_mbps_bucket{le="100"} 2`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected %q in:\n%s", line, out)
+		}
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	got := formatLabels([][2]string{{"a", "x\"y\\z\n"}, {"b", ""}})
+	if got != `{a="x\"y\\z\n",b=""}` {
+		t.Errorf("got unexpected labels %s", got)
+	}
+}
+
+func TestRunPeriodic(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		w.Write(make([]byte, 2000000))
+	}))
+	defer ts.Close()
+
+	server, err := speedtest.New().CustomServer(ts.URL + "/speedtest/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ID = "1"
+
+	e := New(WithNamespace("probe"), WithServers(speedtest.Servers{server}))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := e.RunPeriodic(ctx, time.Hour, speedtest.NewTestConfig(speedtest.WithSavingMode(true))); err != context.DeadlineExceeded {
+		t.Errorf("got unexpected error %v", err)
+	}
+
+	if err := e.RunPeriodic(context.Background(), 0, speedtest.TestConfig{}); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `probe_upload_mbps{server_id="1"`) {
+		t.Errorf("expected the tested server in:\n%s", rec.Body.String())
+	}
+}
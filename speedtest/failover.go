@@ -0,0 +1,146 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// TestFailover runs the latency, download and upload phases against servers in order of priority.
+// A phase that fails is retried against the next server, which then serves the remaining phases.
+func TestFailover(ctx context.Context, servers []*Server, cfg TestConfig) (*Result, error) {
+	return Servers(servers).TestFailover(ctx, cfg)
+}
+
+// TestFailover runs the latency, download and upload phases against the servers in order of priority.
+// A phase that fails is retried against the next server, which then serves the remaining phases.
+// The Result describes the server that served the download and records the server of every phase.
+// Only the errors of the context stop the test before all servers have been tried.
+func (l Servers) TestFailover(ctx context.Context, cfg TestConfig) (*Result, error) {
+	if len(l) == 0 {
+		return nil, errors.New("no servers available")
+	}
+
+	phases := [...]func(*Server) error{
+		func(s *Server) error { return s.PingTestWithConfig(ctx, cfg) },
+		func(s *Server) error { return s.DownloadTestWithConfig(ctx, cfg) },
+		func(s *Server) error { return s.UploadTestWithConfig(ctx, cfg) },
+	}
+
+	var served [len(phases)]*Server
+	next := 0
+	for i, phase := range phases {
+		var lastErr error
+		for served[i] == nil {
+			if next == len(l) {
+				return nil, fmt.Errorf("all %d servers failed: %w", len(l), lastErr)
+			}
+			s := l[next]
+			if err := phase(s); err != nil {
+				if ctx.Err() != nil {
+					return nil, err
+				}
+				lastErr = err
+				next++
+				continue
+			}
+			served[i] = s
+		}
+	}
+
+	latency, ul := served[0].Result(), served[2].Result()
+	r := served[1].Result()
+	copyLatency(r, latency)
+	copyUpload(r, ul)
+	r.QoE = r.qoe()
+	if latency.StartedAt.Before(r.StartedAt) {
+		r.StartedAt = latency.StartedAt
+	}
+	if ul.FinishedAt.After(r.FinishedAt) {
+		r.FinishedAt = ul.FinishedAt
+	}
+	return r, nil
+}
+
+// copyLatency copies the figures of the latency phase of src into dst, a result of another server.
+// Fields added to Result for the latency phase must be copied here too.
+func copyLatency(dst, src *Result) {
+	dst.Latency, dst.MinLatency, dst.MaxLatency = src.Latency, src.MinLatency, src.MaxLatency
+	dst.Jitter, dst.PacketLoss, dst.LatencyMethod = src.Jitter, src.PacketLoss, src.LatencyMethod
+	dst.ProxyLatency, dst.FullPathLatency = src.ProxyLatency, src.FullPathLatency
+	dst.LatencyServerID = src.LatencyServerID
+	if src.Bufferbloat != nil || dst.Bufferbloat != nil {
+		b := cloneBufferbloat(dst.Bufferbloat)
+		b.Idle = LatencyPercentiles{}
+		if src.Bufferbloat != nil {
+			b.Idle = src.Bufferbloat.Idle
+		}
+		b.Grade = b.grade()
+		dst.Bufferbloat = b
+	}
+	if src.Timings != nil || dst.Timings != nil {
+		t := cloneTimings(dst.Timings)
+		t.Latency = PhaseTiming{}
+		if src.Timings != nil {
+			t.Latency = src.Timings.Latency
+		}
+		dst.Timings = t
+	}
+}
+
+// copyUpload copies the figures of the upload phase of src into dst, a result of another server.
+// Fields added to Result for the upload phase must be copied here too.
+func copyUpload(dst, src *Result) {
+	dst.ULSpeed, dst.ULBytes, dst.ULDuration = src.ULSpeed, src.ULBytes, src.ULDuration
+	dst.ULCapReached, dst.ULSpeedStable, dst.ULWireSpeed = src.ULCapReached, src.ULSpeedStable, src.ULWireSpeed
+	dst.ULSamples, dst.ULStreams = src.ULSamples, src.ULStreams
+	dst.ULServerID = src.ULServerID
+	// TestConfig.ShareResult submits the result after the upload test, so the share belongs to the upload server.
+	dst.Share = src.Share
+	if src.Bufferbloat != nil || dst.Bufferbloat != nil {
+		b := cloneBufferbloat(dst.Bufferbloat)
+		b.Upload = LatencyPercentiles{}
+		if src.Bufferbloat != nil {
+			b.Upload = src.Bufferbloat.Upload
+		}
+		b.Grade = b.grade()
+		dst.Bufferbloat = b
+	}
+	if src.Timings != nil || dst.Timings != nil {
+		t := cloneTimings(dst.Timings)
+		t.Upload = PhaseTiming{}
+		if src.Timings != nil {
+			t.Upload = src.Timings.Upload
+		}
+		dst.Timings = t
+	}
+	if src.Soak != nil || dst.Soak != nil {
+		soak := &Soak{}
+		if dst.Soak != nil {
+			*soak = *dst.Soak
+		}
+		soak.Upload = nil
+		if src.Soak != nil {
+			soak.Upload = src.Soak.Upload
+		}
+		dst.Soak = soak
+	}
+}
+
+// cloneBufferbloat returns a copy of b, which may be nil, so that a merged result does not alter the server's.
+func cloneBufferbloat(b *Bufferbloat) *Bufferbloat {
+	c := &Bufferbloat{}
+	if b != nil {
+		*c = *b
+	}
+	return c
+}
+
+// cloneTimings returns a copy of t, which may be nil.
+func cloneTimings(t *Timings) *Timings {
+	c := &Timings{}
+	if t != nil {
+		*c = *t
+	}
+	return c
+}
@@ -0,0 +1,117 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest/speedtesttest"
+)
+
+func TestTestFailover(t *testing.T) {
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+	// Answers pings but fails every download.
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latency.txt" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer broken.Close()
+	healthy := newLibrespeedTestServer(false)
+	defer healthy.Close()
+
+	var servers Servers
+	for i, u := range []string{dead.URL + "/upload.php", broken.URL + "/upload.php", healthy.URL + "/backend"} {
+		s, err := New().CustomServer(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.ID = string(rune('a' + i))
+		servers = append(servers, s)
+	}
+	servers[2].Type = LibrespeedServer
+
+	r, err := servers.TestFailover(context.Background(), NewTestConfig(WithSavingMode(true), WithPingCount(2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ServerID != "c" || r.LatencyServerID != "b" || r.DLServerID != "c" || r.ULServerID != "c" {
+		t.Errorf("got unexpected servers %v, %v, %v, %v", r.ServerID, r.LatencyServerID, r.DLServerID, r.ULServerID)
+	}
+	if r.MinLatency != servers[1].MinLatency || r.DLSpeed <= 0 || r.ULSpeed <= 0 {
+		t.Errorf("got unexpected result %+v", r)
+	}
+
+	_, err = servers[:2].TestFailover(context.Background(), NewTestConfig(WithSavingMode(true), WithPingCount(2)))
+	if !errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("got unexpected error '%v'", err)
+	}
+}
+
+func TestTestFailoverUpload(t *testing.T) {
+	// Serves everything but uploads.
+	primary := speedtesttest.NewServer(speedtesttest.Config{Inject: func(r *http.Request) int {
+		if r.Method == http.MethodPost {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}})
+	defer primary.Close()
+	backup := speedtesttest.NewServer(speedtesttest.Config{})
+	defer backup.Close()
+
+	var servers Servers
+	for i, u := range []string{primary.SpeedtestURL(), backup.SpeedtestURL()} {
+		s, err := New().CustomServer(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.ID = string(rune('a' + i))
+		servers = append(servers, s)
+	}
+
+	cfg := NewTestConfig(WithDuration(300*time.Millisecond), WithMaxStreams(2), WithPingCount(2), WithLoadedLatency(20*time.Millisecond))
+	r, err := servers.TestFailover(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl, ul := servers[0].Result(), servers[1].Result()
+	if r.DLServerID != "a" || r.ULServerID != "b" || r.DLSpeed != dl.DLSpeed {
+		t.Fatalf("got servers %v and %v", r.DLServerID, r.ULServerID)
+	}
+
+	got, expected := reflect.ValueOf(r).Elem(), reflect.ValueOf(ul).Elem()
+	for i := 0; i < got.NumField(); i++ {
+		name := got.Type().Field(i).Name
+		if !strings.HasPrefix(name, "UL") {
+			continue
+		}
+		if !reflect.DeepEqual(got.Field(i).Interface(), expected.Field(i).Interface()) {
+			t.Errorf("got %v %v, expected %v from the backup server", name, got.Field(i), expected.Field(i))
+		}
+	}
+	if r.Timings == nil || r.Timings.Upload != ul.Timings.Upload || r.Timings.Download != dl.Timings.Download {
+		t.Errorf("got timings %+v, expected the upload from the backup server", r.Timings)
+	}
+	if r.Bufferbloat == nil || r.Bufferbloat.Upload != ul.Bufferbloat.Upload || r.Bufferbloat.Download != dl.Bufferbloat.Download {
+		t.Errorf("got bufferbloat %+v, expected the upload from the backup server", r.Bufferbloat)
+	}
+	if servers[0].Bufferbloat.Upload.Samples != 0 {
+		t.Error("the merged result altered the primary server")
+	}
+}
+
+func TestCopyUploadShare(t *testing.T) {
+	dst := &Result{ServerID: "a"}
+	src := &Result{ServerID: "b", Share: &Share{ResultID: "123"}}
+	copyUpload(dst, src)
+	if dst.Share != src.Share {
+		t.Errorf("got share %+v, expected the share of the upload server", dst.Share)
+	}
+}
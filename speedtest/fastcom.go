@@ -0,0 +1,167 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	fastComUrl    = "https://fast.com"
+	fastComApiUrl = "https://api.fast.com/netflix/speedtest/v2"
+
+	// fastComUrlCount is the number of OCA servers requested from the API.
+	fastComUrlCount = 5
+)
+
+var (
+	fastComScriptRe = regexp.MustCompile(`<script src="(/app-[^"]+\.js)"`)
+	fastComTokenRe  = regexp.MustCompile(`token:"([A-Za-z0-9]+)"`)
+)
+
+// fastComTargets is the response of the fast.com API.
+type fastComTargets struct {
+	Targets []struct {
+		URL      string `json:"url"`
+		Location struct {
+			City    string `json:"city"`
+			Country string `json:"country"`
+		} `json:"location"`
+	} `json:"targets"`
+}
+
+// FetchFastComServers retrieves the Netflix Open Connect servers assigned to the client by fast.com.
+func (client *Speedtest) FetchFastComServers() (Servers, error) {
+	return client.FetchFastComServersContext(context.Background())
+}
+
+// FetchFastComServersContext retrieves the Netflix Open Connect servers assigned to the client by fast.com, observing the given context.
+func (client *Speedtest) FetchFastComServersContext(ctx context.Context) (Servers, error) {
+	return client.fetchFastComServers(ctx, fastComUrl, fastComApiUrl)
+}
+
+// FetchFastComServers retrieves the Netflix Open Connect servers assigned to the client by fast.com.
+func FetchFastComServers() (Servers, error) {
+	return defaultClient.FetchFastComServers()
+}
+
+// FetchFastComServersContext retrieves the Netflix Open Connect servers assigned to the client by fast.com, observing the given context.
+func FetchFastComServersContext(ctx context.Context) (Servers, error) {
+	return defaultClient.FetchFastComServersContext(ctx)
+}
+
+func (client *Speedtest) fetchFastComServers(ctx context.Context, siteURL, apiURL string) (Servers, error) {
+	token, err := client.fastComToken(ctx, siteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	q := url.Values{"https": {"true"}, "token": {token}, "urlCount": {strconv.Itoa(fastComUrlCount)}}
+	body, err := client.fastComGet(ctx, apiURL+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var targets fastComTargets
+	if err := json.Unmarshal(body, &targets); err != nil {
+		return nil, err
+	}
+
+	var servers Servers
+	for i, t := range targets.Targets {
+		u, err := url.Parse(t.URL)
+		if err != nil {
+			continue
+		}
+		servers = append(servers, &Server{
+			URL:       t.URL,
+			Name:      t.Location.City,
+			Country:   t.Location.Country,
+			Sponsor:   "Netflix",
+			ID:        strconv.Itoa(i),
+			Host:      u.Host,
+			Type:      FastComServer,
+			doer:      client.doer,
+			dialer:    client.dialer,
+			proxy:     client.proxy,
+			netDialer: client.netDialer,
+		})
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("fast.com returned no servers")
+	}
+	return servers, nil
+}
+
+// fastComToken extracts the API token from the script of the fast.com page.
+func (client *Speedtest) fastComToken(ctx context.Context, siteURL string) (string, error) {
+	page, err := client.fastComGet(ctx, siteURL)
+	if err != nil {
+		return "", err
+	}
+	m := fastComScriptRe.FindSubmatch(page)
+	if m == nil {
+		return "", errors.New("fast.com script not found")
+	}
+
+	script, err := client.fastComGet(ctx, siteURL+string(m[1]))
+	if err != nil {
+		return "", err
+	}
+	m = fastComTokenRe.FindSubmatch(script)
+	if m == nil {
+		return "", errors.New("fast.com token not found")
+	}
+	return string(m[1]), nil
+}
+
+func (client *Speedtest) fastComGet(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.doer.Do(req)
+	if err != nil {
+		return nil, connError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// fastComRange returns the URL of the first size bytes served by the OCA server at rawURL.
+// OCA URLs carry their signature in the query; the range is a path suffix, e.g. /speedtest/range/0-1023?c=...
+func fastComRange(rawURL string, size int) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/range/0-" + strconv.Itoa(size-1)
+	return u.String()
+}
+
+// fastComProtocol tests OCA servers, which serve and accept byte ranges of their speedtest URL.
+type fastComProtocol struct{}
+
+func (fastComProtocol) BuildDownloadRequest(ctx context.Context, s *Server, w int) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, fastComRange(s.URL, dlPayload(w)), nil)
+}
+
+func (fastComProtocol) BuildUploadRequest(ctx context.Context, s *Server, size int64) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodPost, fastComRange(s.URL, int(size)), nil)
+}
+
+func (fastComProtocol) BuildPingRequest(ctx context.Context, s *Server) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, fastComRange(s.URL, 1), nil)
+}
+
+func (fastComProtocol) PayloadSize(w int) int {
+	return dlPayload(w)
+}
@@ -0,0 +1,77 @@
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFastComServer(t *testing.T) {
+	var ts *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><script src="/app-1a2b3c.js"></script></html>`)
+	})
+	mux.HandleFunc("/app-1a2b3c.js", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `var a={https:!0,token:"YXNkZmFzZGxmbnNk",urlCount:5}`)
+	})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != "YXNkZmFzZGxmbnNk" {
+			http.Error(w, "invalid token", http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"targets":[{"url":"%s/speedtest?c=jp&e=1","location":{"city":"Tokyo","country":"JP"}}]}`, ts.URL)
+	})
+	mux.HandleFunc("/speedtest/range/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("c") != "jp" {
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodPost {
+			io.Copy(ioutil.Discard, r.Body)
+			return
+		}
+		var first, last int64
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/speedtest/range/"), "%d-%d", &first, &last)
+		io.Copy(w, newPayload(last-first+1, PayloadRepeat))
+	})
+	ts = httptest.NewServer(mux)
+	defer ts.Close()
+
+	servers, err := New().fetchFastComServers(context.Background(), ts.URL, ts.URL+"/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := servers[0]
+	if len(servers) != 1 || server.Name != "Tokyo" || server.Country != "JP" || server.Type != FastComServer {
+		t.Fatalf("got unexpected servers %v", servers)
+	}
+
+	if err := server.PingTestWithConfig(context.Background(), NewTestConfig(WithPingCount(2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.DownloadTest(true); err != nil {
+		t.Fatal(err)
+	}
+	if r := server.Result(); r.DLSpeed <= 0 || r.DLBytes != 6*int64(dlPayload(3)) {
+		t.Errorf("got unexpected DLSpeed '%v' and DLBytes '%v'", r.DLSpeed, r.DLBytes)
+	}
+	if err := server.UploadTest(true); err != nil {
+		t.Fatal(err)
+	}
+	if server.ULSpeed <= 0 {
+		t.Errorf("got unexpected server.ULSpeed '%v'", server.ULSpeed)
+	}
+}
+
+func TestFastComRange(t *testing.T) {
+	u := fastComRange("https://ipv4-c001-nrt001-ix.1.oca.nflxvideo.net/speedtest?c=jp&n=2516&v=3&e=1&t=abc", 1024)
+	if u != "https://ipv4-c001-nrt001-ix.1.oca.nflxvideo.net/speedtest/range/0-1023?c=jp&n=2516&v=3&e=1&t=abc" {
+		t.Errorf("got unexpected url %v", u)
+	}
+}
@@ -0,0 +1,149 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"time"
+)
+
+const (
+	icmpEchoRequest   = 8
+	icmpEchoReply     = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// icmpConn sends ICMP echo requests to a single host over a raw socket, which usually requires privileges.
+type icmpConn struct {
+	conn net.PacketConn
+	dst  *net.IPAddr
+	v6   bool
+	id   uint16
+	seq  uint16
+}
+
+// dialICMP opens a raw ICMP socket for pinging host, honouring the local address and socket options of d if not nil.
+// host is resolved over ipNetwork, "ip", "ip4" or "ip6". The error wraps os.ErrPermission if the process may not open raw sockets.
+func dialICMP(ctx context.Context, d *net.Dialer, host, ipNetwork string) (*icmpConn, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, ipNetwork, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+	dst := &net.IPAddr{IP: ips[0]}
+	recordRemote(ctx, dst)
+
+	network := "ip4:icmp"
+	v6 := dst.IP.To4() == nil
+	if v6 {
+		network = "ip6:ipv6-icmp"
+	}
+
+	var lc net.ListenConfig
+	laddr := ""
+	if d != nil {
+		lc.Control = d.Control
+		if a, ok := d.LocalAddr.(*net.TCPAddr); ok {
+			laddr = a.IP.String()
+		}
+	}
+	conn, err := lc.ListenPacket(ctx, network, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &icmpConn{
+		conn: conn,
+		dst:  dst,
+		v6:   v6,
+		id:   uint16(rand.Intn(1 << 16)),
+	}, nil
+}
+
+// ping measures a single echo round trip.
+func (c *icmpConn) ping(ctx context.Context) (time.Duration, error) {
+	defer c.watch(ctx)()
+
+	c.seq++
+	typ, replyType := byte(icmpEchoRequest), byte(icmpEchoReply)
+	if c.v6 {
+		typ, replyType = icmpv6EchoRequest, icmpv6EchoReply
+	}
+	msg := icmpEcho(typ, c.id, c.seq, !c.v6)
+
+	sTime := time.Now()
+	if _, err := c.conn.WriteTo(msg, c.dst); err != nil {
+		return 0, err
+	}
+
+	// The raw socket receives every ICMP message for the host; wait for the reply to this request.
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		if n < 8 || buf[0] != replyType {
+			continue
+		}
+		if ip, ok := from.(*net.IPAddr); !ok || !ip.IP.Equal(c.dst.IP) {
+			continue
+		}
+		if binary.BigEndian.Uint16(buf[4:]) == c.id && binary.BigEndian.Uint16(buf[6:]) == c.seq {
+			return time.Since(sTime), nil
+		}
+	}
+}
+
+// watch bounds reads by the deadline of ctx and aborts them when ctx is done. The returned function stops watching.
+func (c *icmpConn) watch(ctx context.Context) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetReadDeadline(deadline)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// Close closes the socket.
+func (c *icmpConn) Close() error {
+	return c.conn.Close()
+}
+
+// icmpEcho builds an echo request. The checksum of ICMPv6 covers a pseudo header and is filled in by the kernel.
+func icmpEcho(typ byte, id, seq uint16, checksum bool) []byte {
+	msg := make([]byte, 16)
+	msg[0] = typ
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	binary.BigEndian.PutUint64(msg[8:], uint64(time.Now().UnixNano()))
+	if checksum {
+		binary.BigEndian.PutUint16(msg[2:], internetChecksum(msg))
+	}
+	return msg
+}
+
+// internetChecksum computes the RFC 1071 checksum of b.
+func internetChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,76 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInternetChecksum(t *testing.T) {
+	// Example from RFC 1071 section 3.
+	b := []byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}
+	if sum := internetChecksum(b); sum != ^uint16(0xddf2) {
+		t.Errorf("got unexpected checksum %#x", sum)
+	}
+
+	msg := icmpEcho(icmpEchoRequest, 1, 2, true)
+	if internetChecksum(msg) != 0 {
+		t.Error("echo request checksum does not verify")
+	}
+}
+
+func TestPingTestICMP(t *testing.T) {
+	server := &Server{Host: "127.0.0.1:8080"}
+	if _, err := dialICMP(context.Background(), nil, server.hostname(), "ip"); errors.Is(err, os.ErrPermission) {
+		// Without raw sockets the native method must be used instead.
+		l := newSocketTestServer(t)
+		defer l.Close()
+		server = &Server{Host: l.Addr().String(), Type: OoklaSocketServer}
+		if err := server.PingTestICMP(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if server.LatencyMethod != LatencySocket {
+			t.Errorf("got unexpected latency method %v", server.LatencyMethod)
+		}
+		return
+	}
+
+	if err := server.PingTestICMP(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if server.LatencyMethod != LatencyICMP || server.MinLatency <= 0 || server.PacketLoss != 0 {
+		t.Errorf("got unexpected latency method %v, latency %v and packet loss %v", server.LatencyMethod, server.MinLatency, server.PacketLoss)
+	}
+}
+
+func TestPingTestUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(string(buf[:n]), "PING") {
+				conn.WriteTo([]byte("PONG 0\n"), addr)
+			}
+		}
+	}()
+
+	server := &Server{Host: conn.LocalAddr().String()}
+	err = server.PingTestWithConfig(context.Background(), NewTestConfig(WithPingCount(3), WithLatencyMethod(LatencyUDP)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.LatencyMethod != LatencyUDP || server.MinLatency <= 0 {
+		t.Errorf("got unexpected latency method %v and latency %v", server.LatencyMethod, server.MinLatency)
+	}
+}
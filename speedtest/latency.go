@@ -0,0 +1,209 @@
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyMethod identifies how round trips are measured.
+type LatencyMethod int
+
+const (
+	// LatencyAuto uses the server type's native method.
+	LatencyAuto LatencyMethod = iota
+	// LatencyHTTP times HTTP GET requests to the latency endpoint.
+	LatencyHTTP
+	// LatencySocket times PING commands of the Ookla TCP protocol.
+	LatencySocket
+	// LatencyWebSocket times WebSocket ping/pong frames. Only LibrespeedServer supports it;
+	// other servers, or a LibreSpeed backend without the endpoint, fall back to the native method.
+	LatencyWebSocket
+	// LatencyICMP times ICMP echo requests, excluding TLS and server processing time.
+	// It requires the privilege to open raw sockets and falls back to the native method without it.
+	LatencyICMP
+	// LatencyUDP times PING datagrams sent to the socket port of speedtest.net servers.
+	// Other server types do not support it and use their native method.
+	LatencyUDP
+)
+
+// String representation of LatencyMethod
+func (m LatencyMethod) String() string {
+	switch m {
+	case LatencyHTTP:
+		return "http"
+	case LatencySocket:
+		return "tcp"
+	case LatencyWebSocket:
+		return "websocket"
+	case LatencyICMP:
+		return "icmp"
+	case LatencyUDP:
+		return "udp"
+	default:
+		return "auto"
+	}
+}
+
+// MarshalText encodes the method as its string representation.
+func (m LatencyMethod) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes a method encoded by MarshalText.
+func (m *LatencyMethod) UnmarshalText(text []byte) error {
+	for _, method := range []LatencyMethod{LatencyAuto, LatencyHTTP, LatencySocket, LatencyWebSocket, LatencyICMP, LatencyUDP} {
+		if method.String() == string(text) {
+			*m = method
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown latency method %q", text)
+}
+
+// LatencyStats summarizes the round trips measured against one server.
+type LatencyStats struct {
+	Min    time.Duration `json:"min"`
+	Avg    time.Duration `json:"avg"`
+	Max    time.Duration `json:"max"`
+	Jitter time.Duration `json:"jitter"`
+	Loss   float64       `json:"loss"` // percentage of failed round trips, like Server.PacketLoss
+}
+
+// LatencyMatrix holds round trip samples measured against a set of servers.
+// Samples[i][j] is the j-th round trip to Servers[i]; a zero value means the round trip failed.
+type LatencyMatrix struct {
+	Servers Servers           `json:"servers"`
+	Samples [][]time.Duration `json:"samples"`
+	Stats   []LatencyStats    `json:"stats"`
+}
+
+// LatencyMatrix pings every server rounds times and returns the resulting latency matrix.
+func (l Servers) LatencyMatrix(rounds int) (*LatencyMatrix, error) {
+	return l.LatencyMatrixContext(context.Background(), rounds)
+}
+
+// LatencyMatrixContext pings every server rounds times and returns the resulting latency matrix, observing the given context.
+// All servers are pinged concurrently within a round, so that samples in the same column are taken under comparable conditions.
+func (l Servers) LatencyMatrixContext(ctx context.Context, rounds int) (*LatencyMatrix, error) {
+	if len(l) == 0 {
+		return nil, fmt.Errorf("no servers available")
+	}
+	if rounds <= 0 {
+		rounds = 1
+	}
+
+	m := &LatencyMatrix{
+		Servers: l,
+		Samples: make([][]time.Duration, len(l)),
+		Stats:   make([]LatencyStats, len(l)),
+	}
+	for i := range m.Samples {
+		m.Samples[i] = make([]time.Duration, rounds)
+	}
+
+	for r := 0; r < rounds; r++ {
+		wg := sync.WaitGroup{}
+		for i, s := range l {
+			wg.Add(1)
+			go func(i int, s *Server) {
+				defer wg.Done()
+				// A failed round trip is recorded as loss rather than aborting the matrix.
+				if rtt, err := s.ping(ctx); err == nil {
+					m.Samples[i][r] = rtt
+				}
+			}(i, s)
+		}
+		wg.Wait()
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, samples := range m.Samples {
+		m.Stats[i] = latencyStats(samples)
+	}
+
+	return m, nil
+}
+
+// Best returns the server with the lowest average round trip among those that answered every ping,
+// falling back to the lowest average overall.
+func (m *LatencyMatrix) Best() *Server {
+	best := -1
+	for i, st := range m.Stats {
+		if st.Loss == 100 {
+			continue
+		}
+		if best < 0 || betterLatency(st, m.Stats[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	return m.Servers[best]
+}
+
+func betterLatency(a, b LatencyStats) bool {
+	if (a.Loss == 0) != (b.Loss == 0) {
+		return a.Loss == 0
+	}
+	return a.Avg < b.Avg
+}
+
+// String representation of LatencyMatrix
+func (m *LatencyMatrix) String() string {
+	var sb strings.Builder
+	for i, s := range m.Servers {
+		st := m.Stats[i]
+		fmt.Fprintf(&sb, "[%4s] %-30s min %-12s avg %-12s max %-12s jitter %-12s loss %5.1f%%\n",
+			s.ID, s.Name, st.Min, st.Avg, st.Max, st.Jitter, st.Loss)
+	}
+	return sb.String()
+}
+
+// latencyStats computes min/avg/max, jitter and loss over samples, where zero samples are failures.
+// Jitter is the mean absolute difference between consecutive successful round trips.
+func latencyStats(samples []time.Duration) LatencyStats {
+	var st LatencyStats
+	var sum, diffSum, prev time.Duration
+	ok, diffs := 0, 0
+
+	for _, rtt := range samples {
+		if rtt <= 0 {
+			continue
+		}
+		if ok == 0 || rtt < st.Min {
+			st.Min = rtt
+		}
+		if rtt > st.Max {
+			st.Max = rtt
+		}
+		if ok > 0 {
+			d := rtt - prev
+			if d < 0 {
+				d = -d
+			}
+			diffSum += d
+			diffs++
+		}
+		sum += rtt
+		prev = rtt
+		ok++
+	}
+
+	if len(samples) > 0 {
+		st.Loss = float64(len(samples)-ok) / float64(len(samples)) * 100
+	}
+	if ok > 0 {
+		st.Avg = sum / time.Duration(ok)
+	}
+	if diffs > 0 {
+		st.Jitter = diffSum / time.Duration(diffs)
+	}
+	return st
+}
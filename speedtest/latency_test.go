@@ -0,0 +1,64 @@
+package speedtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	ms := time.Millisecond
+	st := latencyStats([]time.Duration{10 * ms, 20 * ms, 0, 14 * ms})
+
+	if st.Min != 10*ms || st.Max != 20*ms {
+		t.Errorf("got unexpected min/max %v/%v", st.Min, st.Max)
+	}
+	if st.Avg != 44*ms/3 {
+		t.Errorf("got unexpected avg %v", st.Avg)
+	}
+	if st.Jitter != 8*ms {
+		t.Errorf("got unexpected jitter %v, expected 8ms", st.Jitter)
+	}
+	if st.Loss != 25 {
+		t.Errorf("got unexpected loss %v, expected 25", st.Loss)
+	}
+}
+
+func TestLatencyMatrix(t *testing.T) {
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer slow.Close()
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+
+	client := New()
+	var servers Servers
+	for _, u := range []string{slow.URL, fast.URL, dead.URL} {
+		s, err := client.CustomServer(u + "/upload.php")
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, s)
+	}
+
+	m, err := servers.LatencyMatrix(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Samples) != 3 || len(m.Samples[0]) != 3 {
+		t.Fatalf("got unexpected matrix shape %v", m.Samples)
+	}
+	if m.Stats[0].Min < 20*time.Millisecond {
+		t.Errorf("got unexpected min %v for slow server", m.Stats[0].Min)
+	}
+	if m.Stats[2].Loss != 100 {
+		t.Errorf("got unexpected loss %v for dead server", m.Stats[2].Loss)
+	}
+	if m.Best() != servers[1] {
+		t.Errorf("expected the fast server to be the best, got %v", m.Best())
+	}
+}
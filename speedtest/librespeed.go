@@ -0,0 +1,203 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// librespeedChunkSize is the size in bytes of one garbage.php chunk.
+const librespeedChunkSize = 1024 * 1024
+
+// librespeedWebSocketPath is the WebSocket latency endpoint, relative to the server URL.
+const librespeedWebSocketPath = "ws"
+
+// librespeedBase returns the server URL with a trailing slash, to which backend endpoints are appended.
+func (s *Server) librespeedBase() string {
+	if strings.HasSuffix(s.URL, "/") {
+		return s.URL
+	}
+	return s.URL + "/"
+}
+
+// librespeedWebSocketURL returns the ws:// or wss:// URL of the WebSocket latency endpoint.
+func (s *Server) librespeedWebSocketURL() string {
+	u := s.librespeedBase() + librespeedWebSocketPath
+	if strings.HasPrefix(u, "https://") {
+		return "wss://" + strings.TrimPrefix(u, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(u, "http://")
+}
+
+// librespeedChunks returns the number of garbage.php chunks requested for weight w,
+// chosen to match the HTTP payload of the same weight.
+func librespeedChunks(w int) int {
+	chunks := dlPayload(w) / 1000 / 1000
+	if chunks < 1 {
+		chunks = 1
+	}
+	return chunks
+}
+
+// librespeedProtocol tests LibreSpeed backends: garbage.php serves chunks and empty.php accepts uploads and answers pings.
+type librespeedProtocol struct{}
+
+func (librespeedProtocol) BuildDownloadRequest(ctx context.Context, s *Server, w int) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, s.librespeedBase()+"garbage.php?ckSize="+strconv.Itoa(librespeedChunks(w)), nil)
+}
+
+func (librespeedProtocol) BuildUploadRequest(ctx context.Context, s *Server, _ int64) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodPost, s.librespeedBase()+"empty.php", nil)
+}
+
+func (librespeedProtocol) BuildPingRequest(ctx context.Context, s *Server) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, s.librespeedBase()+"empty.php", nil)
+}
+
+func (librespeedProtocol) PayloadSize(w int) int {
+	return librespeedChunks(w) * librespeedChunkSize
+}
+
+// ClientInfo describes the caller as seen by a server.
+type ClientInfo struct {
+	IP  string `json:"ip"`
+	ISP string `json:"isp,omitempty"`
+	// ASN is the autonomous system of the caller's network, e.g. "AS7922".
+	ASN     string `json:"asn,omitempty"`
+	Country string `json:"country,omitempty"`
+	// Lat and Lon locate the caller, 0 when unknown.
+	Lat float64 `json:"lat,omitempty"`
+	Lon float64 `json:"lon,omitempty"`
+	// Processed is the summary of the caller as formatted by the server, e.g. "192.0.2.1 - Example ISP, US (12 km)".
+	Processed string `json:"processed,omitempty"`
+
+	raw json.RawMessage // the ISP information as returned by the server, submitted with telemetry
+}
+
+// librespeedIP is the response of getIP.php with ISP information.
+type librespeedIP struct {
+	ProcessedString string          `json:"processedString"`
+	RawIspInfo      json.RawMessage `json:"rawIspInfo"`
+}
+
+// librespeedIspInfo holds the fields of getIP.php's rawIspInfo, as returned by ipinfo.io, used by ClientInfo.
+type librespeedIspInfo struct {
+	IP      string `json:"ip"`
+	Org     string `json:"org"` // "AS7922 Comcast Cable Communications, LLC"
+	Country string `json:"country"`
+}
+
+// FetchClientInfo retrieves the caller's IP, ISP and ASN from the getIP.php endpoint of a LibreSpeed backend
+// and records them in Server.ClientInfo.
+func (s *Server) FetchClientInfo() (*ClientInfo, error) {
+	return s.FetchClientInfoContext(context.Background())
+}
+
+// FetchClientInfoContext retrieves the caller's IP, ISP and ASN from a LibreSpeed backend, observing the given context.
+// See FetchClientInfo.
+func (s *Server) FetchClientInfoContext(ctx context.Context) (*ClientInfo, error) {
+	if s.Type != LibrespeedServer {
+		return nil, fmt.Errorf("%w: client information requires a LibreSpeed backend", ErrUnsupportedServerType)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.librespeedBase()+"getIP.php?isp=true&distance=km", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.doer.Do(req)
+	if err != nil {
+		return nil, connError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	info := parseLibrespeedIP(body)
+	s.ClientInfo = info
+	return info, nil
+}
+
+// parseLibrespeedIP decodes a getIP.php response. Backends without ISP detection answer with the bare IP.
+func parseLibrespeedIP(body []byte) *ClientInfo {
+	var v librespeedIP
+	if err := json.Unmarshal(body, &v); err != nil {
+		ip := strings.TrimSpace(string(body))
+		return &ClientInfo{IP: ip, Processed: ip}
+	}
+
+	info := &ClientInfo{Processed: v.ProcessedString, raw: v.RawIspInfo}
+	// The processed string starts with the IP, followed by the ISP if known: "192.0.2.1 - Example ISP, US (12 km)".
+	parts := strings.SplitN(v.ProcessedString, " - ", 2)
+	info.IP = strings.TrimSpace(parts[0])
+
+	var isp librespeedIspInfo
+	if json.Unmarshal(v.RawIspInfo, &isp) == nil {
+		if isp.IP != "" {
+			info.IP = isp.IP
+		}
+		info.Country = isp.Country
+		info.ASN, info.ISP = splitOrg(isp.Org)
+	}
+	if info.ISP == "" && len(parts) == 2 {
+		info.ISP = strings.TrimSpace(strings.SplitN(parts[1], ",", 2)[0])
+	}
+	return info
+}
+
+// librespeedTelemetry submits the results to the telemetry of a LibreSpeed backend, with the ISP information
+// of Server.ClientInfo if fetched. Backends only accept results if telemetry is enabled.
+func (s *Server) librespeedTelemetry(ctx context.Context) (*Share, error) {
+	form := url.Values{
+		"dl":     {strconv.FormatFloat(s.DLSpeed, 'f', 2, 64)},
+		"ul":     {strconv.FormatFloat(s.ULSpeed, 'f', 2, 64)},
+		"ping":   {strconv.FormatFloat(milliseconds(s.MinLatency), 'f', 2, 64)},
+		"jitter": {strconv.FormatFloat(milliseconds(s.Jitter), 'f', 2, 64)},
+		"extra":  {""},
+		"log":    {""},
+	}
+	ispinfo := ""
+	if s.ClientInfo != nil {
+		if b, err := json.Marshal(librespeedIP{ProcessedString: s.ClientInfo.Processed, RawIspInfo: s.ClientInfo.raw}); err == nil {
+			ispinfo = string(b)
+		}
+	}
+	form.Set("ispinfo", ispinfo)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.librespeedBase()+"results/telemetry.php", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.doer.Do(req)
+	if err != nil {
+		return nil, connError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The backend answers "id <id>".
+	reply := strings.TrimSpace(string(body))
+	id := strings.TrimSpace(strings.TrimPrefix(reply, "id "))
+	if !strings.HasPrefix(reply, "id ") || id == "" {
+		return nil, errors.New("the LibreSpeed backend did not return a result id, telemetry may be disabled")
+	}
+	return &Share{ResultID: id, URL: s.librespeedBase() + "results/?id=" + url.QueryEscape(id)}, nil
+}
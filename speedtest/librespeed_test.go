@@ -0,0 +1,161 @@
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestLibrespeedServer(t *testing.T) {
+	for _, withWebSocket := range []bool{true, false} {
+		ts := newLibrespeedTestServer(withWebSocket)
+
+		server, err := New().CustomServer(ts.URL + "/backend")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.Type = LibrespeedServer
+
+		err = server.PingTestWithConfig(context.Background(), NewTestConfig(WithPingCount(3), WithLatencyMethod(LatencyWebSocket)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := LatencyHTTP
+		if withWebSocket {
+			expected = LatencyWebSocket
+		}
+		if server.LatencyMethod != expected || server.MinLatency <= 0 {
+			t.Errorf("got unexpected latency method '%v' and latency '%v', expected '%v'", server.LatencyMethod, server.MinLatency, expected)
+		}
+
+		if err := server.DownloadTest(true); err != nil {
+			t.Fatal(err)
+		}
+		if r := server.Result(); r.DLSpeed <= 0 || r.DLBytes != 6*2*librespeedChunkSize {
+			t.Errorf("got unexpected DLSpeed '%v' and DLBytes '%v'", r.DLSpeed, r.DLBytes)
+		}
+
+		if err := server.UploadTest(true); err != nil {
+			t.Fatal(err)
+		}
+		if server.ULSpeed <= 0 {
+			t.Errorf("got unexpected server.ULSpeed '%v'", server.ULSpeed)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestLibrespeedWebSocketURL(t *testing.T) {
+	server := &Server{Type: LibrespeedServer, URL: "https://example.com/backend"}
+	if u := server.librespeedWebSocketURL(); u != "wss://example.com/backend/ws" {
+		t.Errorf("got unexpected url %v", u)
+	}
+}
+
+func TestLibrespeedClientInfoAndTelemetry(t *testing.T) {
+	ts := newLibrespeedTestServer(false)
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Type = LibrespeedServer
+
+	info, err := server.FetchClientInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IP != "192.0.2.1" || info.ISP != "Example ISP" || info.ASN != "AS64496" || info.Country != "JP" {
+		t.Errorf("got unexpected client info %+v", info)
+	}
+
+	cfg := NewTestConfig(WithPingCount(2), WithSavingMode(true), WithShareResult(true))
+	if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.UploadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	r := server.Result()
+	if r.Share == nil || r.Share.ResultID != "42" || r.Share.URL != ts.URL+"/backend/results/?id=42" {
+		t.Errorf("got unexpected share %+v", r.Share)
+	}
+	if r.ClientInfo == nil || r.ClientInfo.ASN != "AS64496" {
+		t.Errorf("got unexpected client info %+v", r.ClientInfo)
+	}
+}
+
+func TestParseLibrespeedIP(t *testing.T) {
+	if info := parseLibrespeedIP([]byte("192.0.2.1\n")); info.IP != "192.0.2.1" || info.Processed != "192.0.2.1" {
+		t.Errorf("got unexpected client info %+v", info)
+	}
+	info := parseLibrespeedIP([]byte(`{"processedString":"192.0.2.1 - Example ISP, JP","rawIspInfo":""}`))
+	if info.IP != "192.0.2.1" || info.ASN != "" {
+		t.Errorf("got unexpected client info %+v", info)
+	}
+}
+
+// newLibrespeedTestServer starts a LibreSpeed backend, optionally with the WebSocket latency endpoint.
+func newLibrespeedTestServer(withWebSocket bool) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/backend/garbage.php", func(w http.ResponseWriter, r *http.Request) {
+		chunks, _ := strconv.Atoi(r.URL.Query().Get("ckSize"))
+		io.Copy(w, newPayload(int64(chunks*librespeedChunkSize), PayloadRepeat))
+	})
+	mux.HandleFunc("/backend/empty.php", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+	})
+	mux.HandleFunc("/backend/getIP.php", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("isp") != "true" {
+			io.WriteString(w, "192.0.2.1")
+			return
+		}
+		io.WriteString(w, `{"processedString":"192.0.2.1 - Example ISP, JP (12 km)",`+
+			`"rawIspInfo":{"ip":"192.0.2.1","org":"AS64496 Example ISP","country":"JP"}}`)
+	})
+	mux.HandleFunc("/backend/results/telemetry.php", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Method != http.MethodPost || r.Form.Get("dl") == "" || r.Form.Get("ping") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, "id 42")
+	})
+	if withWebSocket {
+		mux.HandleFunc("/backend/ws", serveWebSocketEcho)
+	}
+	return httptest.NewServer(mux)
+}
+
+// serveWebSocketEcho upgrades the connection and answers ping frames with pongs.
+func serveWebSocketEcho(w http.ResponseWriter, r *http.Request) {
+	conn, brw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		wsAccept(r.Header.Get("Sec-WebSocket-Key")))
+
+	c := &wsConn{conn: conn, r: brw.Reader}
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil || opcode == wsOpClose {
+			return
+		}
+		if opcode == wsOpPing {
+			conn.Write(append([]byte{0x80 | wsOpPong, byte(len(payload))}, payload...))
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MultiResult holds the results of testing several servers.
+type MultiResult struct {
+	Results   []*Result       `json:"results"`
+	Aggregate AggregateResult `json:"aggregate"`
+}
+
+// AggregateResult summarizes the results of several servers.
+// Averages describe a typical server; totals describe the combined throughput, meaningful when servers were tested concurrently.
+type AggregateResult struct {
+	Servers       int           `json:"servers"`
+	AvgLatency    time.Duration `json:"avg_latency"`
+	AvgJitter     time.Duration `json:"avg_jitter"`
+	AvgPacketLoss float64       `json:"avg_packet_loss"`
+	AvgDLSpeed    float64       `json:"avg_dl_speed"`
+	AvgULSpeed    float64       `json:"avg_ul_speed"`
+	TotalDLSpeed  float64       `json:"total_dl_speed"`
+	TotalULSpeed  float64       `json:"total_ul_speed"`
+	DLBytes       int64         `json:"dl_bytes"`
+	ULBytes       int64         `json:"ul_bytes"`
+}
+
+// aggregateResultJSON is the wire format of AggregateResult.
+type aggregateResultJSON struct {
+	Servers       int     `json:"servers"`
+	AvgLatencyMs  float64 `json:"avg_latency_ms"`
+	AvgJitterMs   float64 `json:"avg_jitter_ms"`
+	AvgPacketLoss float64 `json:"avg_packet_loss"`
+	AvgDLSpeed    float64 `json:"avg_dl_speed"`
+	AvgULSpeed    float64 `json:"avg_ul_speed"`
+	TotalDLSpeed  float64 `json:"total_dl_speed"`
+	TotalULSpeed  float64 `json:"total_ul_speed"`
+	DLBytes       int64   `json:"dl_bytes"`
+	ULBytes       int64   `json:"ul_bytes"`
+}
+
+// MarshalJSON encodes the aggregate with durations in milliseconds.
+func (a AggregateResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(aggregateResultJSON{
+		a.Servers, milliseconds(a.AvgLatency), milliseconds(a.AvgJitter), a.AvgPacketLoss,
+		a.AvgDLSpeed, a.AvgULSpeed, a.TotalDLSpeed, a.TotalULSpeed, a.DLBytes, a.ULBytes,
+	})
+}
+
+// UnmarshalJSON decodes an aggregate encoded by MarshalJSON.
+func (a *AggregateResult) UnmarshalJSON(data []byte) error {
+	var v aggregateResultJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*a = AggregateResult{
+		v.Servers, fromMilliseconds(v.AvgLatencyMs), fromMilliseconds(v.AvgJitterMs), v.AvgPacketLoss,
+		v.AvgDLSpeed, v.AvgULSpeed, v.TotalDLSpeed, v.TotalULSpeed, v.DLBytes, v.ULBytes,
+	}
+	return nil
+}
+
+// TestMultiple pings every server, picks the cfg.ServerCount servers with the lowest latency and runs
+// download and upload tests against them, sequentially or concurrently as set by cfg.Concurrent.
+func TestMultiple(ctx context.Context, servers []*Server, cfg TestConfig) (*MultiResult, error) {
+	return Servers(servers).TestMultiple(ctx, cfg)
+}
+
+// TestMultiple pings every server, picks the cfg.ServerCount servers with the lowest latency and runs
+// download and upload tests against them, sequentially or concurrently as set by cfg.Concurrent.
+// If some of them fail, the results of the others are returned along with the error of the first that failed.
+// The results of earlier tests of the servers are cleared first, so that servers can be tested repeatedly.
+func (l Servers) TestMultiple(ctx context.Context, cfg TestConfig) (*MultiResult, error) {
+	if len(l) == 0 {
+		return nil, errors.New("no servers available")
+	}
+	for _, s := range l {
+		s.resetRun()
+	}
+
+	// Ping all candidates; servers that do not answer are not selected.
+	var mu sync.Mutex
+	var reachable Servers
+	wg := sync.WaitGroup{}
+	for _, s := range l {
+		wg.Add(1)
+		go func(s *Server) {
+			defer wg.Done()
+			if err := s.PingTestWithConfig(ctx, cfg); err == nil {
+				mu.Lock()
+				reachable = append(reachable, s)
+				mu.Unlock()
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(reachable) == 0 {
+		return nil, errors.New("no reachable servers")
+	}
+
+	sort.SliceStable(reachable, func(i, j int) bool {
+		return reachable[i].MinLatency < reachable[j].MinLatency
+	})
+	n := cfg.ServerCount
+	if n <= 0 {
+		n = 1
+	}
+	if n < len(reachable) {
+		reachable = reachable[:n]
+	}
+
+	run := func(s *Server) error {
+		if err := s.DownloadTestWithConfig(ctx, cfg); err != nil {
+			return err
+		}
+		return s.UploadTestWithConfig(ctx, cfg)
+	}
+
+	errs := make([]error, len(reachable))
+	if cfg.Concurrent {
+		wg := sync.WaitGroup{}
+		for i, s := range reachable {
+			wg.Add(1)
+			go func(i int, s *Server) {
+				defer wg.Done()
+				errs[i] = run(s)
+			}(i, s)
+		}
+		wg.Wait()
+	} else {
+		for i, s := range reachable {
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+				continue
+			}
+			errs[i] = run(s)
+		}
+	}
+
+	// A server that failed does not discard the results of the others.
+	mr := &MultiResult{}
+	var err error
+	for i, s := range reachable {
+		if errs[i] != nil {
+			if err == nil {
+				err = fmt.Errorf("server %s: %w", s.ID, errs[i])
+			}
+			continue
+		}
+		mr.Results = append(mr.Results, s.Result())
+	}
+	mr.Aggregate = aggregate(mr.Results)
+
+	return mr, err
+}
+
+func aggregate(results []*Result) AggregateResult {
+	a := AggregateResult{Servers: len(results)}
+	if len(results) == 0 {
+		return a
+	}
+
+	var latency, jitter time.Duration
+	for _, r := range results {
+		latency += r.Latency
+		jitter += r.Jitter
+		a.AvgPacketLoss += r.PacketLoss
+		a.TotalDLSpeed += r.DLSpeed
+		a.TotalULSpeed += r.ULSpeed
+		a.DLBytes += r.DLBytes
+		a.ULBytes += r.ULBytes
+	}
+
+	n := len(results)
+	a.AvgLatency = latency / time.Duration(n)
+	a.AvgJitter = jitter / time.Duration(n)
+	a.AvgPacketLoss /= float64(n)
+	a.AvgDLSpeed = a.TotalDLSpeed / float64(n)
+	a.AvgULSpeed = a.TotalULSpeed / float64(n)
+	return a
+}
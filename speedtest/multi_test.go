@@ -0,0 +1,110 @@
+package speedtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTestMultiple(t *testing.T) {
+	var servers []*Server
+	for _, delay := range []time.Duration{30 * time.Millisecond, 0, 10 * time.Millisecond} {
+		ts := newLibrespeedTestServer(false)
+		defer ts.Close()
+
+		delayed := httptest.NewServer(http.HandlerFunc(func(delay time.Duration) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(delay)
+				ts.Config.Handler.ServeHTTP(w, r)
+			}
+		}(delay)))
+		defer delayed.Close()
+
+		s, err := New().CustomServer(delayed.URL + "/backend")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Type = LibrespeedServer
+		servers = append(servers, s)
+	}
+
+	for _, concurrent := range []bool{false, true} {
+		cfg := NewTestConfig(WithServerCount(2), WithConcurrent(concurrent), WithSavingMode(true), WithPingCount(2))
+		mr, err := TestMultiple(context.Background(), servers, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(mr.Results) != 2 || mr.Results[0].URL != servers[1].URL || mr.Results[1].URL != servers[2].URL {
+			t.Fatalf("got unexpected servers selected %v", mr.Results)
+		}
+		a := mr.Aggregate
+		if a.Servers != 2 || a.AvgDLSpeed <= 0 || a.TotalDLSpeed != mr.Results[0].DLSpeed+mr.Results[1].DLSpeed {
+			t.Errorf("got unexpected aggregate %+v", a)
+		}
+		if a.DLBytes != mr.Results[0].DLBytes+mr.Results[1].DLBytes {
+			t.Errorf("got unexpected aggregate DLBytes %v", a.DLBytes)
+		}
+	}
+}
+
+func TestTestMultiplePartial(t *testing.T) {
+	healthy := newLibrespeedTestServer(false)
+	defer healthy.Close()
+	// Answers pings but fails every download.
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latency.txt" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer broken.Close()
+
+	var servers Servers
+	for i, u := range []string{healthy.URL + "/backend", broken.URL + "/upload.php"} {
+		s, err := New().CustomServer(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.ID = string(rune('a' + i))
+		servers = append(servers, s)
+	}
+	servers[0].Type = LibrespeedServer
+
+	for _, concurrent := range []bool{false, true} {
+		cfg := NewTestConfig(WithServerCount(2), WithConcurrent(concurrent), WithSavingMode(true), WithPingCount(2))
+		mr, err := servers.TestMultiple(context.Background(), cfg)
+		if !errors.Is(err, ErrHTTPStatus) || !strings.Contains(err.Error(), "server b") {
+			t.Errorf("got unexpected error '%v'", err)
+		}
+		if mr == nil || len(mr.Results) != 1 || mr.Results[0].ServerID != "a" || mr.Aggregate.Servers != 1 {
+			t.Fatalf("got unexpected results %+v, expected those of the healthy server", mr)
+		}
+	}
+}
+
+func TestAggregateResultJSON(t *testing.T) {
+	a := AggregateResult{Servers: 2, AvgLatency: 12500 * time.Microsecond, AvgJitter: 2 * time.Millisecond, AvgDLSpeed: 50, DLBytes: 1000}
+	b, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"avg_latency_ms":12.5`, `"avg_jitter_ms":2`, `"avg_dl_speed":50`} {
+		if !bytes.Contains(b, []byte(field)) {
+			t.Errorf("expected %s in %s", field, b)
+		}
+	}
+
+	var decoded AggregateResult
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != a {
+		t.Errorf("got: %+v, expected: %+v", decoded, a)
+	}
+}
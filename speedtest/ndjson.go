@@ -0,0 +1,78 @@
+package speedtest
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// NDJSONWriter writes newline-delimited JSON events for dashboards and command line tools to consume as a test runs:
+// a "progress" event for every report it receives as the ProgressReporter of a test, and a "result" event for every
+// result written with WriteResult. It is safe for concurrent use.
+//
+//	w := speedtest.NewNDJSONWriter(os.Stdout)
+//	cfg := speedtest.NewTestConfig(speedtest.WithProgressReporter(w, 250*time.Millisecond))
+//	// run the tests with cfg, then
+//	w.WriteResult(server.Result())
+type NDJSONWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// progressEvent is the wire format of a progress report.
+type progressEvent struct {
+	Type        string  `json:"type"`
+	Stage       string  `json:"stage"`
+	ElapsedMs   float64 `json:"elapsed_ms"`
+	Bytes       uint64  `json:"bytes"`
+	InstantMbps float64 `json:"instant_mbps"`
+	AvgMbps     float64 `json:"avg_mbps"`
+}
+
+// resultEvent is the wire format of a result, encoded by Result.MarshalJSON.
+type resultEvent struct {
+	Type   string  `json:"type"`
+	Result *Result `json:"result"`
+}
+
+// NewNDJSONWriter returns a writer emitting events to w.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{enc: json.NewEncoder(w)}
+}
+
+// OnProgress writes a progress event. Write errors are kept for Err.
+func (w *NDJSONWriter) OnProgress(stage Stage, bytesTotal uint64, instantMbps, avgMbps float64, elapsed time.Duration) {
+	_ = w.write(progressEvent{
+		Type:        "progress",
+		Stage:       stage.String(),
+		ElapsedMs:   milliseconds(elapsed),
+		Bytes:       bytesTotal,
+		InstantMbps: instantMbps,
+		AvgMbps:     avgMbps,
+	})
+}
+
+// WriteResult writes a result event.
+func (w *NDJSONWriter) WriteResult(r *Result) error {
+	return w.write(resultEvent{Type: "result", Result: r})
+}
+
+// Err returns the first error encountered writing an event, if any. Events are not written after an error.
+func (w *NDJSONWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *NDJSONWriter) write(v interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	// Encode terminates every event with a newline.
+	w.err = w.enc.Encode(v)
+	return w.err
+}
@@ -0,0 +1,80 @@
+package speedtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNDJSONWriter(t *testing.T) {
+	ts := newLibrespeedTestServer(false)
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Type = LibrespeedServer
+
+	var buf bytes.Buffer
+	w := NewNDJSONWriter(&buf)
+	cfg := NewTestConfig(WithPingCount(2), WithSavingMode(true), WithProgressReporter(w, 10*time.Millisecond))
+	if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteResult(server.Result()); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress int
+	var last struct {
+		Type   string  `json:"type"`
+		Stage  string  `json:"stage"`
+		Bytes  uint64  `json:"bytes"`
+		Result *Result `json:"result"`
+	}
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		last.Result = nil
+		if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+			t.Fatalf("got invalid event %q: %v", scanner.Text(), err)
+		}
+		if last.Type == "progress" {
+			progress++
+			if last.Stage != "download" {
+				t.Errorf("got unexpected stage %q", last.Stage)
+			}
+		}
+	}
+	if progress == 0 {
+		t.Error("no progress event was written")
+	}
+	if last.Type != "result" || last.Result == nil || last.Result.DLBytes != server.dlBytes {
+		t.Errorf("got unexpected final event %+v", last)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestNDJSONWriterError(t *testing.T) {
+	w := NewNDJSONWriter(failingWriter{})
+	w.OnProgress(StageUpload, 100, 1, 1, time.Second)
+	if w.Err() == nil {
+		t.Fatal("expected the write error to be kept")
+	}
+	if err := w.WriteResult(&Result{}); err == nil {
+		t.Error("expected writes to fail after an error")
+	}
+}
@@ -0,0 +1,142 @@
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// addressFamily returns the address family suffix, "4" or "6", of the network of ConnConfig.Network.
+func addressFamily(network string) (string, error) {
+	switch network {
+	case "tcp4", "tcp6":
+		return network[3:], nil
+	}
+	return "", fmt.Errorf("unsupported network %q, expected tcp4 or tcp6", network)
+}
+
+// dialFunc adapts a dial function to a ContextDialer.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (f dialFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+// familyDialer dials over a single address family, so that host names resolve to addresses of that family only.
+type familyDialer struct {
+	d      ContextDialer
+	family string // "4" or "6"
+}
+
+func (d familyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.d.DialContext(ctx, forceFamily(network, d.family), addr)
+}
+
+// forceFamily returns network restricted to family, e.g. "tcp4" for "tcp" and "4".
+func forceFamily(network, family string) string {
+	switch network {
+	case "tcp", "udp", "ip":
+		return network + family
+	}
+	return network
+}
+
+// dialer returns d restricted to the address family of cfg.Network, if set.
+func (cfg TestConfig) dialer(d ContextDialer) (ContextDialer, error) {
+	if cfg.Network == "" {
+		return d, nil
+	}
+	family, err := addressFamily(cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+	return familyDialer{d: d, family: family}, nil
+}
+
+// network returns base, e.g. "udp" or "ip", restricted to the address family of cfg.Network if set.
+func (cfg TestConfig) network(base string) string {
+	if family, err := addressFamily(cfg.Network); err == nil {
+		return base + family
+	}
+	return base
+}
+
+type remoteKey struct{}
+
+// remote records the address of the server a test connected to. Tests find it in their context.
+type remote struct {
+	mu sync.Mutex
+	ip net.IP
+}
+
+// withRemote returns a context recording the address of the connections made with it in r.
+func withRemote(ctx context.Context, r *remote) context.Context {
+	return context.WithValue(ctx, remoteKey{}, r)
+}
+
+// get returns the latest recorded address, nil if none.
+func (r *remote) get() net.IP {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ip
+}
+
+// recordRemote records the remote address of a connection in the stream or remote of ctx.
+func recordRemote(ctx context.Context, addr net.Addr) {
+	ip := addrIP(addr)
+	if ip == nil {
+		return
+	}
+	if st, ok := ctx.Value(streamKey{}).(*stream); ok {
+		st.mu.Lock()
+		st.stats.RemoteIP = ip.String()
+		st.mu.Unlock()
+	}
+	if r, ok := ctx.Value(remoteKey{}).(*remote); ok {
+		r.mu.Lock()
+		r.ip = ip
+		r.mu.Unlock()
+	}
+}
+
+// addrIP returns the IP of addr, or nil if it has none.
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	case nil:
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// setRemote records ip as the address the server was tested at. A nil ip is ignored.
+func (s *Server) setRemote(ip net.IP) {
+	if ip == nil {
+		return
+	}
+	s.RemoteIP = ip.String()
+	s.IPVersion = 6
+	if ip.To4() != nil {
+		s.IPVersion = 4
+	}
+}
+
+// setStreamsRemote records the address the first of streams connected to.
+func (s *Server) setStreamsRemote(streams []StreamStats) {
+	for _, st := range streams {
+		if st.RemoteIP != "" {
+			s.setRemote(net.ParseIP(st.RemoteIP))
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package speedtest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestForcedNetwork(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(serveRandomImage))
+	defer ts.Close()
+
+	server := &Server{URL: ts.URL + "/speedtest/upload.php", doer: &http.Client{}}
+	cfg := NewTestConfig(WithPingCount(2), WithSavingMode(true), WithNetwork("tcp4"))
+	if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if server.RemoteIP != "127.0.0.1" || server.IPVersion != 4 {
+		t.Errorf("got unexpected remote '%v' and IP version '%v'", server.RemoteIP, server.IPVersion)
+	}
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	r := server.Result()
+	if r.RemoteIP != "127.0.0.1" || r.IPVersion != 4 || r.DLStreams[0].RemoteIP != "127.0.0.1" {
+		t.Errorf("got unexpected remote '%v', IP version '%v' and streams %+v", r.RemoteIP, r.IPVersion, r.DLStreams)
+	}
+
+	// The server only listens on IPv4.
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	server = &Server{URL: "http://localhost:" + port + "/speedtest/upload.php", doer: &http.Client{}}
+	if err := server.PingTestWithConfig(context.Background(), NewTestConfig(WithPingCount(1), WithNetwork("tcp6"))); err == nil {
+		t.Error("expected IPv6 to fail")
+	}
+
+	err := server.PingTestWithConfig(context.Background(), NewTestConfig(WithNetwork("udp")))
+	if err == nil || !strings.Contains(err.Error(), "unsupported network") {
+		t.Errorf("got unexpected error %v", err)
+	}
+}
+
+func TestForcedNetworkSocket(t *testing.T) {
+	l := newSocketTestServer(t)
+	defer l.Close()
+
+	server := &Server{Type: OoklaSocketServer, Host: l.Addr().String()}
+	cfg := NewTestConfig(WithPingCount(2), WithSavingMode(true), WithNetwork("tcp4"))
+	if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.UploadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if r := server.Result(); r.RemoteIP != "127.0.0.1" || r.IPVersion != 4 || r.ULStreams[0].RemoteIP != "127.0.0.1" {
+		t.Errorf("got unexpected remote '%v', IP version '%v' and streams %+v", r.RemoteIP, r.IPVersion, r.ULStreams)
+	}
+}
+
+func TestForceFamily(t *testing.T) {
+	for _, c := range []struct{ network, family, expected string }{
+		{"tcp", "4", "tcp4"},
+		{"udp", "6", "udp6"},
+		{"tcp6", "4", "tcp6"},
+		{"unix", "4", "unix"},
+	} {
+		if got := forceFamily(c.network, c.family); got != c.expected {
+			t.Errorf("forceFamily(%q, %q) = %q, expected %q", c.network, c.family, got, c.expected)
+		}
+	}
+}
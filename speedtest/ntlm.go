@@ -0,0 +1,242 @@
+package speedtest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	ntlmNegotiateUnicode      = 0x00000001
+	ntlmRequestTarget         = 0x00000004
+	ntlmNegotiateNTLM         = 0x00000200
+	ntlmNegotiateAlwaysSign   = 0x00008000
+	ntlmNegotiateExtendedSess = 0x00080000
+	ntlmNegotiateTargetInfo   = 0x00800000
+	ntlmNegotiate128          = 0x20000000
+	ntlmNegotiate56           = 0x80000000
+
+	ntlmAvEOL       = 0
+	ntlmAvTimestamp = 7
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+var errInvalidNTLMChallenge = errors.New("invalid NTLM challenge message")
+
+// ntlmChallenge is the decoded content of a type 2 (CHALLENGE) message.
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+// ntlmNegotiateMessage builds the type 1 (NEGOTIATE) message that starts the handshake.
+func ntlmNegotiateMessage() []byte {
+	flags := uint32(ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign |
+		ntlmNegotiateExtendedSess | ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56)
+
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], flags)
+	// Domain and workstation security buffers are left empty.
+	return msg
+}
+
+// parseNTLMChallenge decodes a type 2 (CHALLENGE) message sent by the proxy.
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, errInvalidNTLMChallenge
+	}
+
+	c := &ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(msg[20:]),
+		serverChallenge: msg[24:32],
+	}
+
+	if len(msg) >= 48 {
+		l := int(binary.LittleEndian.Uint16(msg[40:]))
+		off := int(binary.LittleEndian.Uint32(msg[44:]))
+		if off+l > len(msg) {
+			return nil, errInvalidNTLMChallenge
+		}
+		c.targetInfo = msg[off : off+l]
+	}
+
+	return c, nil
+}
+
+// ntlmAuthenticateMessage builds the type 3 (AUTHENTICATE) message answering the challenge with an NTLMv2 response.
+func ntlmAuthenticateMessage(c *ntlmChallenge, domain, user, password, workstation string) ([]byte, error) {
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	timestamp, hasTimestamp := ntlmTargetTimestamp(c.targetInfo)
+	if !hasTimestamp {
+		timestamp = ntlmFiletime(time.Now())
+	}
+
+	key := ntowfv2(domain, user, password)
+	ntResponse := ntlmv2Response(key, c.serverChallenge, clientChallenge, timestamp, c.targetInfo)
+
+	// When the server supplies a timestamp the LMv2 response must be zeroed (MS-NLMP 3.1.5.1.2).
+	lmResponse := make([]byte, 24)
+	if !hasTimestamp {
+		mac := hmac.New(md5.New, key)
+		mac.Write(c.serverChallenge)
+		mac.Write(clientChallenge)
+		lmResponse = append(mac.Sum(nil), clientChallenge...)
+	}
+
+	payloads := [][]byte{
+		lmResponse,
+		ntResponse,
+		utf16le(domain),
+		utf16le(user),
+		utf16le(workstation),
+		nil, // EncryptedRandomSessionKey
+	}
+
+	const headerLen = 64
+	msg := make([]byte, headerLen)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+
+	offset := headerLen
+	for i, p := range payloads {
+		field := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[field:], uint16(len(p)))
+		binary.LittleEndian.PutUint16(msg[field+2:], uint16(len(p)))
+		binary.LittleEndian.PutUint32(msg[field+4:], uint32(offset))
+		offset += len(p)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], c.flags&^ntlmRequestTarget|ntlmNegotiateUnicode)
+
+	for _, p := range payloads {
+		msg = append(msg, p...)
+	}
+
+	return msg, nil
+}
+
+// ntowfv2 derives the NTLMv2 response key from the user's credentials.
+func ntowfv2(domain, user, password string) []byte {
+	mac := hmac.New(md5.New, md4Sum(utf16le(password)))
+	mac.Write(utf16le(strings.ToUpper(user) + domain))
+	return mac.Sum(nil)
+}
+
+// ntlmv2Response computes NTProofStr followed by the client blob.
+func ntlmv2Response(key, serverChallenge, clientChallenge, timestamp, targetInfo []byte) []byte {
+	blob := []byte{0x01, 0x01, 0, 0, 0, 0, 0, 0}
+	blob = append(blob, timestamp...)
+	blob = append(blob, clientChallenge...)
+	blob = append(blob, 0, 0, 0, 0)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+
+	mac := hmac.New(md5.New, key)
+	mac.Write(serverChallenge)
+	mac.Write(blob)
+	return append(mac.Sum(nil), blob...)
+}
+
+// ntlmTargetTimestamp extracts MsvAvTimestamp from the challenge's AV_PAIR list.
+func ntlmTargetTimestamp(targetInfo []byte) ([]byte, bool) {
+	for len(targetInfo) >= 4 {
+		id := binary.LittleEndian.Uint16(targetInfo)
+		l := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if id == ntlmAvEOL || len(targetInfo) < 4+l {
+			break
+		}
+		if id == ntlmAvTimestamp && l == 8 {
+			return targetInfo[4:12], true
+		}
+		targetInfo = targetInfo[4+l:]
+	}
+	return nil, false
+}
+
+// ntlmFiletime encodes t as a Windows FILETIME (100ns intervals since 1601-01-01).
+func ntlmFiletime(t time.Time) []byte {
+	const epochDelta = 116444736000000000
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(t.UnixNano()/100+epochDelta))
+	return b
+}
+
+func utf16le(s string) []byte {
+	codes := utf16.Encode([]rune(s))
+	b := make([]byte, len(codes)*2)
+	for i, c := range codes {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+// md4Sum implements RFC 1320. MD4 is only used to derive the NT hash required by NTLM.
+func md4Sum(data []byte) []byte {
+	a, b, c, d := uint32(0x67452301), uint32(0xefcdab89), uint32(0x98badcfe), uint32(0x10325476)
+
+	msg := append([]byte{}, data...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(data))*8)
+	msg = append(msg, length[:]...)
+
+	f := func(x, y, z uint32) uint32 { return x&y | ^x&z }
+	g := func(x, y, z uint32) uint32 { return x&y | x&z | y&z }
+	h := func(x, y, z uint32) uint32 { return x ^ y ^ z }
+
+	var x [16]uint32
+	for chunk := msg; len(chunk) > 0; chunk = chunk[64:] {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(chunk[i*4:])
+		}
+		aa, bb, cc, dd := a, b, c, d
+
+		for _, i := range []int{0, 4, 8, 12} {
+			a = bits.RotateLeft32(a+f(b, c, d)+x[i], 3)
+			d = bits.RotateLeft32(d+f(a, b, c)+x[i+1], 7)
+			c = bits.RotateLeft32(c+f(d, a, b)+x[i+2], 11)
+			b = bits.RotateLeft32(b+f(c, d, a)+x[i+3], 19)
+		}
+		for _, i := range []int{0, 1, 2, 3} {
+			a = bits.RotateLeft32(a+g(b, c, d)+x[i]+0x5a827999, 3)
+			d = bits.RotateLeft32(d+g(a, b, c)+x[i+4]+0x5a827999, 5)
+			c = bits.RotateLeft32(c+g(d, a, b)+x[i+8]+0x5a827999, 9)
+			b = bits.RotateLeft32(b+g(c, d, a)+x[i+12]+0x5a827999, 13)
+		}
+		for _, i := range []int{0, 2, 1, 3} {
+			a = bits.RotateLeft32(a+h(b, c, d)+x[i]+0x6ed9eba1, 3)
+			d = bits.RotateLeft32(d+h(a, b, c)+x[i+8]+0x6ed9eba1, 9)
+			c = bits.RotateLeft32(c+h(d, a, b)+x[i+4]+0x6ed9eba1, 11)
+			b = bits.RotateLeft32(b+h(c, d, a)+x[i+12]+0x6ed9eba1, 15)
+		}
+
+		a += aa
+		b += bb
+		c += cc
+		d += dd
+	}
+
+	sum := make([]byte, 16)
+	binary.LittleEndian.PutUint32(sum[0:], a)
+	binary.LittleEndian.PutUint32(sum[4:], b)
+	binary.LittleEndian.PutUint32(sum[8:], c)
+	binary.LittleEndian.PutUint32(sum[12:], d)
+	return sum
+}
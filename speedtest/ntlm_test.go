@@ -0,0 +1,75 @@
+package speedtest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestMD4Sum(t *testing.T) {
+	cases := map[string]string{
+		"":               "31d6cfe0d16ae931b73c59d7e0c089c0",
+		"abc":            "a448017aaf21d8525fc10ae87aa6729d",
+		"message digest": "d9130a8164549fe818874806e1c7014b",
+		"12345678901234567890123456789012345678901234567890123456789012345678901234567890": "e33b4ddc9c38f2199c3e7b164fcc0536",
+	}
+
+	for in, expected := range cases {
+		got := hex.EncodeToString(md4Sum([]byte(in)))
+		if got != expected {
+			t.Errorf("md4(%q) got: %v, expected: %v", in, got, expected)
+		}
+	}
+}
+
+// Test vectors from MS-NLMP 4.2.4 (NTLMv2 Authentication).
+func TestNTLMv2Response(t *testing.T) {
+	key := ntowfv2("Domain", "User", "Password")
+	if hex.EncodeToString(key) != "0c868a403bfd7a93a3001ef22ef02e3f" {
+		t.Errorf("unexpected NTOWFv2 %x", key)
+	}
+
+	serverChallenge, _ := hex.DecodeString("0123456789abcdef")
+	clientChallenge := bytes.Repeat([]byte{0xaa}, 8)
+	targetInfo := []byte{0x02, 0x00, 0x0c, 0x00}
+	targetInfo = append(targetInfo, utf16le("Domain")...)
+	targetInfo = append(targetInfo, 0x01, 0x00, 0x0c, 0x00)
+	targetInfo = append(targetInfo, utf16le("Server")...)
+	targetInfo = append(targetInfo, 0, 0, 0, 0)
+
+	resp := ntlmv2Response(key, serverChallenge, clientChallenge, make([]byte, 8), targetInfo)
+	if hex.EncodeToString(resp[:16]) != "68cd0ab851e51c96aabc927bebef6a1c" {
+		t.Errorf("unexpected NTProofStr %x", resp[:16])
+	}
+}
+
+func TestParseNTLMChallenge(t *testing.T) {
+	if _, err := parseNTLMChallenge(ntlmNegotiateMessage()); err == nil {
+		t.Error("expected error for a non-challenge message")
+	}
+
+	msg := ntlmTestChallenge([]byte{ntlmAvTimestamp, 0, 8, 0, 1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0})
+	c, err := parseNTLMChallenge(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(c.serverChallenge) != "0123456789abcdef" {
+		t.Errorf("unexpected server challenge %x", c.serverChallenge)
+	}
+	ts, ok := ntlmTargetTimestamp(c.targetInfo)
+	if !ok || !bytes.Equal(ts, []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("unexpected timestamp %x", ts)
+	}
+}
+
+func ntlmTestChallenge(targetInfo []byte) []byte {
+	msg := make([]byte, 48)
+	copy(msg, ntlmSignature)
+	msg[8] = 2
+	msg[20] = ntlmNegotiateUnicode
+	copy(msg[24:], []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef})
+	msg[40] = byte(len(targetInfo))
+	msg[42] = byte(len(targetInfo))
+	msg[44] = 48
+	return append(msg, targetInfo...)
+}
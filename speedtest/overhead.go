@@ -0,0 +1,94 @@
+package speedtest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Overhead models the bytes every packet of a transfer carries on the wire besides its TCP payload,
+// to estimate the link layer rate of a test from its goodput, the rate of payload its speeds are measured in.
+type Overhead struct {
+	// MTU is the size of the largest IP packet, headers included. 0 means 1500.
+	MTU int
+	// LinkHeader is the per-frame overhead of the link layer: headers, trailers, preamble and inter-frame gap.
+	LinkHeader int
+	// IPHeader is the size of the IP header. 0 means 20 or 40, after the IP version of the test.
+	IPHeader int
+	// TCPHeader is the size of the TCP header. 0 means 32, the header with the timestamp option most stacks send.
+	TCPHeader int
+}
+
+var (
+	// OverheadEthernet is the overhead of untagged Ethernet: 8 bytes of preamble, a 14 byte header, a 4 byte FCS
+	// and a 12 byte inter-frame gap.
+	OverheadEthernet = Overhead{MTU: 1500, LinkHeader: 38}
+	// OverheadVLAN is the overhead of 802.1Q tagged Ethernet.
+	OverheadVLAN = Overhead{MTU: 1500, LinkHeader: 42}
+	// OverheadPPPoE is the overhead of PPPoE over Ethernet, whose 8 bytes of PPPoE and PPP headers lower the MTU to 1492.
+	OverheadPPPoE = Overhead{MTU: 1492, LinkHeader: 46}
+	// OverheadIPv6 is the overhead of IPv6 over Ethernet, whatever the IP version of the test.
+	OverheadIPv6 = Overhead{MTU: 1500, LinkHeader: 38, IPHeader: 40}
+	// OverheadDOCSIS is the overhead of a DOCSIS cable link: a 6 byte DOCSIS header and an Ethernet frame
+	// without preamble and inter-frame gap.
+	OverheadDOCSIS = Overhead{MTU: 1500, LinkHeader: 24}
+)
+
+var overheadPresets = map[string]Overhead{
+	"ethernet": OverheadEthernet,
+	"vlan":     OverheadVLAN,
+	"pppoe":    OverheadPPPoE,
+	"ipv6":     OverheadIPv6,
+	"docsis":   OverheadDOCSIS,
+}
+
+// OverheadPreset returns the preset named ethernet, vlan, pppoe, ipv6 or docsis.
+func OverheadPreset(name string) (Overhead, error) {
+	o, ok := overheadPresets[strings.ToLower(name)]
+	if !ok {
+		return Overhead{}, fmt.Errorf("unknown overhead preset %q", name)
+	}
+	return o, nil
+}
+
+// Efficiency returns the share of payload in the frames of a full-sized TCP segment over IP of the given version.
+func (o Overhead) Efficiency(ipVersion int) float64 {
+	mtu := o.MTU
+	if mtu <= 0 {
+		mtu = 1500
+	}
+	ipHeader := o.IPHeader
+	if ipHeader <= 0 {
+		ipHeader = 20
+		if ipVersion == 6 {
+			ipHeader = 40
+		}
+	}
+	tcpHeader := o.TCPHeader
+	if tcpHeader <= 0 {
+		tcpHeader = 32
+	}
+
+	payload := mtu - ipHeader - tcpHeader
+	if payload <= 0 {
+		return 0
+	}
+	return float64(payload) / float64(mtu+o.LinkHeader)
+}
+
+// WireSpeed returns the link layer rate in Mbit/s of a transfer of the given goodput in Mbit/s over IP of the given version.
+// Transfers are assumed to be of full-sized segments, which bulk transfers mostly are.
+func (o Overhead) WireSpeed(goodput float64, ipVersion int) float64 {
+	efficiency := o.Efficiency(ipVersion)
+	if efficiency <= 0 {
+		return 0
+	}
+	return goodput / efficiency
+}
+
+// overhead returns the overhead model of the test, OverheadEthernet by default.
+func (cfg TestConfig) overhead() Overhead {
+	if cfg.Overhead == nil {
+		return OverheadEthernet
+	}
+	return *cfg.Overhead
+}
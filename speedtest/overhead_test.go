@@ -0,0 +1,68 @@
+package speedtest
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestOverhead(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		overhead   Overhead
+		ipVersion  int
+		efficiency float64
+	}{
+		{"ethernet", OverheadEthernet, 4, 1448.0 / 1538},
+		{"ethernet over IPv6", OverheadEthernet, 6, 1428.0 / 1538},
+		{"vlan", OverheadVLAN, 4, 1448.0 / 1542},
+		{"pppoe", OverheadPPPoE, 4, 1440.0 / 1538},
+		{"ipv6", OverheadIPv6, 4, 1428.0 / 1538},
+		{"docsis", OverheadDOCSIS, 4, 1448.0 / 1524},
+		{"small MTU", Overhead{MTU: 576, LinkHeader: 38, TCPHeader: 20}, 4, 536.0 / 614},
+		{"raw IP", Overhead{}, 0, 1448.0 / 1500},
+		{"no payload", Overhead{MTU: 40}, 4, 0},
+	} {
+		if e := tc.overhead.Efficiency(tc.ipVersion); math.Abs(e-tc.efficiency) > 1e-9 {
+			t.Errorf("%s: got efficiency %v, expected %v", tc.name, e, tc.efficiency)
+		}
+		if tc.efficiency > 0 {
+			if w := tc.overhead.WireSpeed(100, tc.ipVersion); math.Abs(w-100/tc.efficiency) > 1e-9 {
+				t.Errorf("%s: got wire speed %v", tc.name, w)
+			}
+		} else if w := tc.overhead.WireSpeed(100, tc.ipVersion); w != 0 {
+			t.Errorf("%s: got wire speed %v, expected 0", tc.name, w)
+		}
+	}
+
+	if o, err := OverheadPreset("PPPoE"); err != nil || o != OverheadPPPoE {
+		t.Errorf("got %+v, %v for pppoe", o, err)
+	}
+	if _, err := OverheadPreset("token-ring"); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+}
+
+func TestDownloadWireSpeed(t *testing.T) {
+	ts := newLibrespeedTestServer(false)
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Type = LibrespeedServer
+	if err := server.DownloadTestWithConfig(context.Background(), NewTestConfig(WithSavingMode(true))); err != nil {
+		t.Fatal(err)
+	}
+	if r := server.Result(); r.DLWireSpeed != OverheadEthernet.WireSpeed(r.DLSpeed, server.IPVersion) || r.DLWireSpeed <= r.DLSpeed {
+		t.Errorf("got wire speed %v for %v", r.DLWireSpeed, r.DLSpeed)
+	}
+
+	if err := server.DownloadTestWithConfig(context.Background(), NewTestConfig(WithSavingMode(true), WithOverhead(OverheadDOCSIS))); err != nil {
+		t.Fatal(err)
+	}
+	if server.DLWireSpeed != OverheadDOCSIS.WireSpeed(server.DLSpeed, server.IPVersion) {
+		t.Errorf("got wire speed %v for %v over DOCSIS", server.DLWireSpeed, server.DLSpeed)
+	}
+}
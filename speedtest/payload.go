@@ -0,0 +1,82 @@
+package speedtest
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// PayloadPattern selects the content of generated upload payloads.
+type PayloadPattern int
+
+const (
+	// PayloadRepeat repeats the digits 0 to 9, as speedtest.net clients do.
+	PayloadRepeat PayloadPattern = iota
+	// PayloadRandom generates pseudo-random URL-safe characters, which compressing middleboxes cannot shrink much.
+	PayloadRandom
+)
+
+const (
+	payloadDigits   = "0123456789"
+	payloadAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	// uploadFormPrefix starts the form-encoded body posted to upload.php.
+	uploadFormPrefix = "content="
+)
+
+// payloadReader generates size bytes of a pattern on the fly, using constant memory whatever the size.
+type payloadReader struct {
+	pattern   PayloadPattern
+	remaining int64
+	off       int
+	rnd       *rand.Rand
+}
+
+// newPayload returns a reader of size bytes of pattern.
+func newPayload(size int64, pattern PayloadPattern) io.Reader {
+	p := &payloadReader{pattern: pattern, remaining: size}
+	if pattern == PayloadRandom {
+		p.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return p
+}
+
+func (p *payloadReader) Read(b []byte) (int, error) {
+	if p.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > p.remaining {
+		b = b[:p.remaining]
+	}
+
+	switch p.pattern {
+	case PayloadRandom:
+		p.rnd.Read(b)
+		for i := range b {
+			b[i] = payloadAlphabet[b[i]&63]
+		}
+	default:
+		for i := range b {
+			b[i] = payloadDigits[(p.off+i)%len(payloadDigits)]
+		}
+		p.off = (p.off + len(b)) % len(payloadDigits)
+	}
+
+	p.remaining -= int64(len(b))
+	return len(b), nil
+}
+
+// uploadBody returns a function creating the form-encoded body of an upload of size kB, filled by payload, and the body length.
+// Each call of the function starts a new body, so that it can serve as http.Request.GetBody.
+func uploadBody(size int, payload func(int64) io.Reader) (func() io.ReadCloser, int64) {
+	// The length matches the original client's strings.Repeat("0123456789", size*100-51).
+	filler := int64(len(payloadDigits) * (size*100 - 51))
+	body := func() io.ReadCloser {
+		return ioutil.NopCloser(io.MultiReader(
+			strings.NewReader(uploadFormPrefix),
+			payload(filler),
+		))
+	}
+	return body, int64(len(uploadFormPrefix)) + filler
+}
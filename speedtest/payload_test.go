@@ -0,0 +1,66 @@
+package speedtest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPayload(t *testing.T) {
+	b, err := ioutil.ReadAll(newPayload(25, PayloadRepeat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "0123456789012345678901234" {
+		t.Errorf("got unexpected payload %q", b)
+	}
+
+	b, err = ioutil.ReadAll(newPayload(100000, PayloadRandom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 100000 || strings.Trim(string(b), payloadAlphabet) != "" {
+		t.Errorf("got unexpected random payload of %v bytes", len(b))
+	}
+}
+
+func TestUploadBody(t *testing.T) {
+	// The body must match what the form encoding of the original payload produced.
+	v := url.Values{}
+	v.Add("content", strings.Repeat("0123456789", ulSizes[4]*100-51))
+	expected := v.Encode()
+
+	newBody, length := uploadBody(ulSizes[4], patternPayload(PayloadRepeat))
+	b, err := ioutil.ReadAll(newBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length != int64(len(expected)) || string(b) != expected {
+		t.Errorf("got body of %v bytes, expected %v", length, len(expected))
+	}
+}
+
+func TestPostPayload(t *testing.T) {
+	var received int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if int64(len(b)) == r.ContentLength && strings.HasPrefix(string(b), uploadFormPrefix) {
+			received = r.ContentLength
+		}
+	}))
+	defer ts.Close()
+
+	server := &Server{URL: ts.URL + "/upload.php"}
+	_, upload := server.httpUploadFuncs(standardProtocol{}, patternPayload(PayloadRandom))
+	m := &meter{}
+	if err := upload(context.Background(), http.DefaultClient, 1, m); err != nil {
+		t.Fatal(err)
+	}
+	if received == 0 || m.total() != uint64(received) {
+		t.Errorf("got %v bytes received and %v counted", received, m.total())
+	}
+}
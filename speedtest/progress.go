@@ -0,0 +1,151 @@
+package speedtest
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const defaultReportInterval = 500 * time.Millisecond
+
+// Stage identifies the test phase a progress report belongs to.
+type Stage int
+
+const (
+	StageDownload Stage = iota
+	StageUpload
+	// StageBidirectional is the simultaneous download and upload of BidirectionalTest.
+	// Progress of that test is reported per direction, as StageDownload and StageUpload.
+	StageBidirectional
+)
+
+// String representation of Stage
+func (s Stage) String() string {
+	switch s {
+	case StageDownload:
+		return "download"
+	case StageUpload:
+		return "upload"
+	case StageBidirectional:
+		return "bidirectional"
+	default:
+		return "unknown"
+	}
+}
+
+// ProgressReporter receives periodic progress of the main phase of a download or upload test.
+// instantMbps is the rate since the previous report and avgMbps the rate since the phase started.
+type ProgressReporter interface {
+	OnProgress(stage Stage, bytesTotal uint64, instantMbps, avgMbps float64, elapsed time.Duration)
+}
+
+// ProgressReporterFunc is an adapter to allow the use of ordinary functions as ProgressReporter.
+type ProgressReporterFunc func(stage Stage, bytesTotal uint64, instantMbps, avgMbps float64, elapsed time.Duration)
+
+// OnProgress calls f(stage, bytesTotal, instantMbps, avgMbps, elapsed).
+func (f ProgressReporterFunc) OnProgress(stage Stage, bytesTotal uint64, instantMbps, avgMbps float64, elapsed time.Duration) {
+	f(stage, bytesTotal, instantMbps, avgMbps, elapsed)
+}
+
+// meter counts the bytes moved by all streams of a test, holding them back to the rate of limit if set.
+// A meter with a parent counts the bytes of one stream and forwards them to the parent.
+// As an io.Writer it counts what is written to it and passes it on to sink, discarding it if sink is nil.
+type meter struct {
+	bytes  uint64
+	limit  *tokenBucket
+	parent *meter
+	sink   io.Writer
+}
+
+func (m *meter) Write(p []byte) (int, error) {
+	if m.sink != nil {
+		if n, err := m.sink.Write(p); err != nil {
+			m.count(n)
+			return n, err
+		}
+	}
+	m.count(len(p))
+	return len(p), nil
+}
+
+func (m *meter) count(n int) {
+	if m.limit != nil {
+		m.limit.wait(n)
+	}
+	atomic.AddUint64(&m.bytes, uint64(n))
+	if m.parent != nil {
+		m.parent.count(n)
+	}
+}
+
+// total returns the number of bytes counted so far.
+func (m *meter) total() uint64 {
+	return atomic.LoadUint64(&m.bytes)
+}
+
+// countReader returns a reader that counts the bytes read from r.
+func (m *meter) countReader(r io.Reader) io.Reader {
+	return &meterReader{r: r, m: m}
+}
+
+type meterReader struct {
+	r io.Reader
+	m *meter
+}
+
+func (r *meterReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.m.count(n)
+	return n, err
+}
+
+// reportProgress calls the configured ProgressReporter every ReportInterval until the returned function is called,
+// which sends a final report. It does nothing if no reporter is configured.
+func reportProgress(cfg TestConfig, stage Stage, m *meter) func() {
+	if cfg.Reporter == nil {
+		return func() {}
+	}
+	interval := cfg.ReportInterval
+	if interval <= 0 {
+		interval = defaultReportInterval
+	}
+
+	start := time.Now()
+	last, lastTime := uint64(0), start
+	report := func(now time.Time) {
+		total := m.total()
+		elapsed := now.Sub(start)
+		cfg.Reporter.OnProgress(stage, total, mbps(total-last, now.Sub(lastTime)), mbps(total, elapsed), elapsed)
+		last, lastTime = total, now
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				report(now)
+			case <-done:
+				report(time.Now())
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// mbps converts a byte count over a duration to Mbit/s.
+func mbps(bytes uint64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / 1000 / 1000 / d.Seconds()
+}
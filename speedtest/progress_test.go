@@ -0,0 +1,79 @@
+package speedtest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMeter(t *testing.T) {
+	m := &meter{}
+
+	if _, err := io.Copy(m, strings.NewReader("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, m.countReader(strings.NewReader("01234"))); err != nil {
+		t.Fatal(err)
+	}
+	if m.total() != 15 {
+		t.Errorf("got: %v, expected: 15", m.total())
+	}
+}
+
+func TestReportProgress(t *testing.T) {
+	type report struct {
+		stage        Stage
+		total        uint64
+		instant, avg float64
+		elapsed      time.Duration
+	}
+	var mu sync.Mutex
+	var reports []report
+	reporter := ProgressReporterFunc(func(stage Stage, total uint64, instant, avg float64, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, report{stage, total, instant, avg, elapsed})
+	})
+
+	m := &meter{}
+	stop := reportProgress(NewTestConfig(WithProgressReporter(reporter, 10*time.Millisecond)), StageUpload, m)
+	for i := 0; i < 5; i++ {
+		m.Write(make([]byte, 125000))
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	if len(reports) < 3 {
+		t.Fatalf("got %v reports, expected at least 3", len(reports))
+	}
+	last := reports[len(reports)-1]
+	if last.stage != StageUpload || last.total != 625000 {
+		t.Errorf("got unexpected final report %+v", last)
+	}
+	if last.avg <= 0 || last.elapsed < 50*time.Millisecond {
+		t.Errorf("got unexpected final report %+v", last)
+	}
+}
+
+func TestDownloadTestWithConfigProgress(t *testing.T) {
+	l := newSocketTestServer(t)
+	defer l.Close()
+
+	var final uint64
+	reporter := ProgressReporterFunc(func(stage Stage, total uint64, instant, avg float64, elapsed time.Duration) {
+		final = total
+	})
+
+	server := &Server{Type: OoklaSocketServer, Host: l.Addr().String()}
+	err := server.DownloadTestWithConfig(context.Background(), NewTestConfig(WithSavingMode(true), WithProgressReporter(reporter, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final == 0 || final != uint64(server.Result().DLBytes) {
+		t.Errorf("got final progress %v, expected %v", final, server.Result().DLBytes)
+	}
+}
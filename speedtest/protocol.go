@@ -0,0 +1,78 @@
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ServerProtocol builds the HTTP requests testing a type of server. The test loops send the requests and
+// measure them, so a backend is added by implementing ServerProtocol and registering it with RegisterServerProtocol.
+type ServerProtocol interface {
+	// BuildDownloadRequest returns a request for the download payload of weight w, from 0 (smallest) to 9.
+	BuildDownloadRequest(ctx context.Context, s *Server, w int) (*http.Request, error)
+	// BuildUploadRequest returns a request for an upload of size bytes. Its body is set by the test.
+	BuildUploadRequest(ctx context.Context, s *Server, size int64) (*http.Request, error)
+	// BuildPingRequest returns a request whose round trip measures the latency to the server.
+	BuildPingRequest(ctx context.Context, s *Server) (*http.Request, error)
+	// PayloadSize returns the size in bytes of the download payload of weight w.
+	PayloadSize(w int) int
+}
+
+var (
+	protocolsMu sync.RWMutex
+	protocols   = map[ServerType]ServerProtocol{
+		StandardServer:   standardProtocol{},
+		LibrespeedServer: librespeedProtocol{},
+		CloudflareServer: cloudflareProtocol{},
+		FastComServer:    fastComProtocol{},
+	}
+)
+
+// RegisterServerProtocol makes p test the servers of type t, replacing the protocol registered for t if any.
+// Types defined outside this package should use values well above the ones defined here, such as 1000 and up.
+// OoklaSocketServer is tested over TCP and cannot be registered.
+func RegisterServerProtocol(t ServerType, p ServerProtocol) {
+	protocolsMu.Lock()
+	defer protocolsMu.Unlock()
+	protocols[t] = p
+}
+
+// protocol returns the protocol registered for the type of s.
+func (s *Server) protocol() (ServerProtocol, error) {
+	protocolsMu.RLock()
+	defer protocolsMu.RUnlock()
+	p, ok := protocols[s.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedServerType, s.Type)
+	}
+	return p, nil
+}
+
+// standardProtocol tests speedtest.net servers over the legacy HTTP endpoints.
+type standardProtocol struct{}
+
+func (standardProtocol) BuildDownloadRequest(ctx context.Context, s *Server, w int) (*http.Request, error) {
+	size := strconv.Itoa(dlSizes[w])
+	return http.NewRequestWithContext(ctx, http.MethodGet, s.standardBase()+"/random"+size+"x"+size+".jpg", nil)
+}
+
+func (standardProtocol) BuildUploadRequest(ctx context.Context, s *Server, _ int64) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodPost, s.URL, nil)
+}
+
+func (standardProtocol) BuildPingRequest(ctx context.Context, s *Server) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, s.standardBase()+"/latency.txt", nil)
+}
+
+func (standardProtocol) PayloadSize(w int) int {
+	return dlPayload(w)
+}
+
+// standardBase returns the directory of the server's upload.php.
+func (s *Server) standardBase() string {
+	return strings.Split(s.URL, "/upload.php")[0]
+}
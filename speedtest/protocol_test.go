@@ -0,0 +1,87 @@
+package speedtest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// pathProtocol serves downloads from /down/{bytes} and takes uploads and pings at /up and /ping.
+type pathProtocol struct{}
+
+func (pathProtocol) BuildDownloadRequest(ctx context.Context, s *Server, w int) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"/down/"+strconv.Itoa(dlPayload(w)), nil)
+}
+
+func (pathProtocol) BuildUploadRequest(ctx context.Context, s *Server, _ int64) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.URL+"/up", nil)
+	if err == nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return req, err
+}
+
+func (pathProtocol) BuildPingRequest(ctx context.Context, s *Server) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodHead, s.URL+"/ping", nil)
+}
+
+func (pathProtocol) PayloadSize(w int) int {
+	return dlPayload(w)
+}
+
+func TestRegisterServerProtocol(t *testing.T) {
+	const pathServer ServerType = 1000
+
+	var uploads int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/down/", func(w http.ResponseWriter, r *http.Request) {
+		size, _ := strconv.Atoi(r.URL.Path[len("/down/"):])
+		io.Copy(w, newPayload(int64(size), PayloadRepeat))
+	})
+	mux.HandleFunc("/up", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.Header.Get("Content-Type") == "application/octet-stream" {
+			atomic.AddInt64(&uploads, 1)
+		}
+		io.Copy(ioutil.Discard, r.Body)
+	})
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Type = pathServer
+	if err := server.PingTest(); err == nil {
+		t.Fatal("expected an error before the protocol is registered")
+	}
+
+	RegisterServerProtocol(pathServer, pathProtocol{})
+	defer func() {
+		protocolsMu.Lock()
+		delete(protocols, pathServer)
+		protocolsMu.Unlock()
+	}()
+
+	if err := server.PingTestWithConfig(context.Background(), NewTestConfig(WithPingCount(2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.DownloadTest(true); err != nil {
+		t.Fatal(err)
+	}
+	if r := server.Result(); r.DLSpeed <= 0 || r.DLBytes != 6*int64(dlPayload(3)) {
+		t.Errorf("got unexpected DLSpeed '%v' and DLBytes '%v'", r.DLSpeed, r.DLBytes)
+	}
+	if err := server.UploadTest(true); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&uploads); server.ULSpeed <= 0 || n == 0 {
+		t.Errorf("got unexpected server.ULSpeed '%v' after %v uploads", server.ULSpeed, n)
+	}
+}
@@ -0,0 +1,345 @@
+package speedtest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProxyAuthScheme selects the handshake used to authenticate against a proxy.
+type ProxyAuthScheme int
+
+const (
+	// ProxyAuthNTLM authenticates using the "NTLM" scheme.
+	ProxyAuthNTLM ProxyAuthScheme = iota
+	// ProxyAuthNegotiate authenticates using the "Negotiate" (SPNEGO) scheme.
+	// Kerberos is not supported, so the proxy must accept NTLM tokens inside Negotiate.
+	ProxyAuthNegotiate
+)
+
+// ProxyAuth holds the credentials for an authenticating proxy.
+// Username may be given as "DOMAIN\user" when Domain is empty.
+type ProxyAuth struct {
+	Scheme      ProxyAuthScheme
+	Domain      string
+	Username    string
+	Password    string
+	Workstation string
+}
+
+// WithProxyAuth routes every request through the proxy at proxyURL, tunnelling each
+// connection with CONNECT and authenticating with NTLM or Negotiate.
+// The proxy is dialed with the binding of WithSourceAddr or WithInterface, see Option.
+func WithProxyAuth(proxyURL *url.URL, auth ProxyAuth) Option {
+	return func(s *Speedtest) {
+		s.proxyURL, s.proxyAuth, s.proxyDialer = proxyURL, &auth, nil
+	}
+}
+
+func (p ProxyAuthScheme) String() string {
+	if p == ProxyAuthNegotiate {
+		return "Negotiate"
+	}
+	return "NTLM"
+}
+
+// ContextDialer opens connections, like *net.Dialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// WithProxy routes every connection through the proxy at proxyURL: an HTTP or HTTPS proxy, authenticated with
+// the username and password of the URL if present, or a SOCKS5 proxy for the socks5 and socks5h schemes.
+// Latency is measured on the full path through the proxy; the leg to the proxy is measured as well,
+// see Server.ProxyLatency. ICMP and UDP latency cannot be proxied, the server type's native method is used instead.
+// The proxy is dialed with the binding of WithSourceAddr or WithInterface, see Option.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(s *Speedtest) {
+		s.proxyURL, s.proxyAuth, s.proxyDialer = proxyURL, nil, nil
+	}
+}
+
+// WithProxyDialer routes every connection through d, which tunnels connections through a proxy at proxyAddr.
+// proxyAddr is used to measure the leg to the proxy; if empty, only the full path is measured.
+func WithProxyDialer(d ContextDialer, proxyAddr string) Option {
+	return func(s *Speedtest) {
+		s.proxyURL, s.proxyAuth = nil, nil
+		s.proxyDialer, s.proxyAddr = d, proxyAddr
+	}
+}
+
+// installProxy sets up the proxy of the latest proxy option, dialed with d, and returns the function routing
+// the requests of a transport through it, nil without proxy.
+func (s *Speedtest) installProxy(d net.Dialer) func(*http.Transport) {
+	switch {
+	case s.proxyDialer != nil:
+		pd := s.proxyDialer
+		s.proxy = &proxy{dialer: pd, addr: s.proxyAddr}
+		return func(t *http.Transport) {
+			t.Proxy = nil
+			t.DialContext = pd.DialContext
+		}
+	case s.proxyURL == nil:
+		return nil
+	case s.proxyAuth != nil:
+		cd := &connectDialer{proxy: s.proxyURL, auth: s.proxyAuth, dialer: d}
+		s.proxy = &proxy{dialer: cd, addr: cd.proxyAddr()}
+		return func(t *http.Transport) {
+			t.Proxy = nil
+			t.DialContext = cd.DialContext
+		}
+	case s.proxyURL.Scheme == "socks5" || s.proxyURL.Scheme == "socks5h":
+		sd := &socksDialer{proxy: s.proxyURL, dialer: d}
+		s.proxy = &proxy{dialer: sd, addr: sd.proxyAddr()}
+		return func(t *http.Transport) {
+			t.Proxy = nil
+			t.DialContext = sd.DialContext
+		}
+	default:
+		cd := &connectDialer{proxy: s.proxyURL, dialer: d}
+		s.proxy = &proxy{dialer: cd, addr: cd.proxyAddr()}
+		proxyURL := s.proxyURL
+		return func(t *http.Transport) {
+			t.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+}
+
+// proxy describes the proxy the connections of tests are routed through.
+type proxy struct {
+	dialer ContextDialer // opens connections through the proxy
+	addr   string        // address of the proxy, empty if unknown
+}
+
+// subtractLatency returns the round trip rtt less the leg to the proxy, which is never negative.
+func subtractLatency(rtt, proxyRTT time.Duration) time.Duration {
+	if rtt < proxyRTT {
+		return 0
+	}
+	return rtt - proxyRTT
+}
+
+// tcpDialer returns the dialer for TCP connections made outside doer, which go through the proxy if one is set
+// and the custom network stack otherwise, if set.
+func (s *Server) tcpDialer() ContextDialer {
+	if s.proxy != nil {
+		return s.proxy.dialer
+	}
+	if s.netDialer != nil {
+		return s.netDialer
+	}
+	if s.dialer != nil {
+		return s.dialer
+	}
+	return &net.Dialer{}
+}
+
+// proxyLatency returns the fastest of count TCP handshakes with the proxy, the round trip of the leg to the proxy.
+func (s *Server) proxyLatency(ctx context.Context, count int) (time.Duration, error) {
+	d := s.dialer
+	if d == nil {
+		d = &net.Dialer{}
+	}
+
+	// Resolve the proxy once, so that name resolution is not timed.
+	addr := s.proxy.addr
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, err
+	}
+	if net.ParseIP(host) == nil {
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return 0, connError(ctx, err)
+		}
+		addr = net.JoinHostPort(ips[0].IP.String(), port)
+	}
+
+	var best time.Duration
+	for i := 0; i < count; i++ {
+		sTime := time.Now()
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return 0, connError(ctx, err)
+		}
+		rtt := time.Since(sTime)
+		conn.Close()
+		if best == 0 || rtt < best {
+			best = rtt
+		}
+	}
+	return best, nil
+}
+
+// connectDialer opens CONNECT tunnels through an HTTP proxy, authenticating with NTLM or Negotiate if auth is set
+// and with the username and password of the proxy URL otherwise.
+type connectDialer struct {
+	proxy  *url.URL
+	auth   *ProxyAuth
+	dialer net.Dialer
+}
+
+// proxyAddr returns the address of the proxy, with the default port of its scheme if the URL has none.
+func (d *connectDialer) proxyAddr() string {
+	if d.proxy.Port() != "" {
+		return d.proxy.Host
+	}
+	if d.proxy.Scheme == "https" {
+		return net.JoinHostPort(d.proxy.Hostname(), "443")
+	}
+	return net.JoinHostPort(d.proxy.Hostname(), "80")
+}
+
+// DialContext connects to addr through the proxy.
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, "tcp", d.proxyAddr())
+	if err != nil {
+		return nil, err
+	}
+	if d.proxy.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: d.proxy.Hostname()})
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	br := bufio.NewReader(conn)
+	if err := d.handshake(conn, br, addr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// handshake performs the three-leg NTLM exchange over a single connection, or a single CONNECT without auth.
+func (d *connectDialer) handshake(conn net.Conn, br *bufio.Reader, addr string) error {
+	if d.auth == nil {
+		var authorization string
+		if u := d.proxy.User; u != nil {
+			password, _ := u.Password()
+			authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password))
+		}
+		resp, err := d.connect(conn, br, addr, authorization)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("proxy CONNECT failed: %s", resp.Status)
+		}
+		return nil
+	}
+
+	scheme := d.auth.Scheme.String()
+	domain, user := d.auth.Domain, d.auth.Username
+	if domain == "" {
+		if i := strings.Index(user, `\`); i >= 0 {
+			domain, user = user[:i], user[i+1:]
+		}
+	}
+
+	resp, err := d.connect(conn, br, addr, scheme+" "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		return fmt.Errorf("proxy CONNECT failed: %s", resp.Status)
+	}
+
+	var token string
+	for _, h := range resp.Header.Values("Proxy-Authenticate") {
+		if strings.HasPrefix(h, scheme+" ") {
+			token = strings.TrimSpace(h[len(scheme)+1:])
+			break
+		}
+	}
+	if token == "" {
+		return fmt.Errorf("proxy did not offer a %s challenge", scheme)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return err
+	}
+	challenge, err := parseNTLMChallenge(raw)
+	if err != nil {
+		return err
+	}
+	msg, err := ntlmAuthenticateMessage(challenge, domain, user, d.auth.Password, d.auth.Workstation)
+	if err != nil {
+		return err
+	}
+
+	resp, err = d.connect(conn, br, addr, scheme+" "+base64.StdEncoding.EncodeToString(msg))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy authentication failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// connect sends a CONNECT request carrying the given Proxy-Authorization value, if any, and reads the reply.
+func (d *connectDialer) connect(conn net.Conn, br *bufio.Reader, addr, authorization string) (*http.Response, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if authorization != "" {
+		req.Header.Set("Proxy-Authorization", authorization)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		// The body of a successful CONNECT is the tunnel itself.
+		return resp, nil
+	}
+
+	// Drain the body so the connection can carry the next leg.
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.Close && resp.StatusCode == http.StatusProxyAuthRequired {
+		return nil, errors.New("proxy closed the connection during authentication")
+	}
+	return resp, nil
+}
+
+// bufferedConn serves bytes the proxy sent right after the CONNECT reply before reading from the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
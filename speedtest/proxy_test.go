@@ -0,0 +1,369 @@
+package speedtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithProxyAuth(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "tunnelled")
+	}))
+	defer target.Close()
+
+	proxy := newNTLMTestProxy(t, "NTLM", "CORP", "alice", "secret")
+	defer proxy.Close()
+
+	client := New(WithProxyAuth(&url.URL{Scheme: "http", Host: proxy.Addr().String()}, ProxyAuth{
+		Username: `CORP\alice`,
+		Password: "secret",
+	}))
+
+	resp, err := client.doer.Get(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "tunnelled" {
+		t.Errorf("got unexpected body '%s'", body)
+	}
+
+	client = New(WithProxyAuth(&url.URL{Scheme: "http", Host: proxy.Addr().String()}, ProxyAuth{
+		Domain:   "CORP",
+		Username: "alice",
+		Password: "wrong",
+	}))
+	if _, err := client.doer.Get(target.URL); err == nil {
+		t.Error("expected authentication failure with a wrong password")
+	}
+}
+
+func TestWithProxyAuthNegotiate(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "tunnelled")
+	}))
+	defer target.Close()
+
+	proxy := newNTLMTestProxy(t, "Negotiate", "CORP", "alice", "secret")
+	defer proxy.Close()
+
+	client := New(WithProxyAuth(&url.URL{Scheme: "http", Host: proxy.Addr().String()}, ProxyAuth{
+		Scheme:   ProxyAuthNegotiate,
+		Username: `CORP\alice`,
+		Password: "secret",
+	}))
+	resp, err := client.doer.Get(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "tunnelled" {
+		t.Errorf("got unexpected body '%s'", body)
+	}
+
+	// A proxy offering only NTLM does not answer a Negotiate handshake.
+	ntlm := newNTLMTestProxy(t, "NTLM", "CORP", "alice", "secret")
+	defer ntlm.Close()
+	client = New(WithProxyAuth(&url.URL{Scheme: "http", Host: ntlm.Addr().String()}, ProxyAuth{
+		Scheme:   ProxyAuthNegotiate,
+		Username: `CORP\alice`,
+		Password: "secret",
+	}))
+	if _, err := client.doer.Get(target.URL); err == nil {
+		t.Error("expected a Negotiate handshake to fail with an NTLM proxy")
+	}
+}
+
+func TestConnectDialerProxyAddr(t *testing.T) {
+	for rawURL, expected := range map[string]string{
+		"http://proxy.example.com":      "proxy.example.com:80",
+		"https://proxy.example.com":     "proxy.example.com:443",
+		"http://proxy.example.com:3128": "proxy.example.com:3128",
+		"https://[2001:db8::1]":         "[2001:db8::1]:443",
+	} {
+		u, _ := url.Parse(rawURL)
+		d := &connectDialer{proxy: u}
+		if got := d.proxyAddr(); got != expected {
+			t.Errorf("got %v for %v, expected %v", got, rawURL, expected)
+		}
+	}
+}
+
+// newNTLMTestProxy starts a CONNECT proxy that requires NTLMv2 authentication with the given scheme, NTLM or Negotiate.
+func newNTLMTestProxy(t *testing.T, scheme, domain, user, password string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := ntlmTestChallenge([]byte{0, 0, 0, 0})
+	key := ntowfv2(domain, user, password)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+
+				req, err := http.ReadRequest(br)
+				if err != nil || !strings.HasPrefix(req.Header.Get("Proxy-Authorization"), scheme+" ") {
+					return
+				}
+				fmt.Fprintf(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: %s %s\r\nContent-Length: 0\r\n\r\n",
+					scheme, base64.StdEncoding.EncodeToString(challenge))
+
+				req, err = http.ReadRequest(br)
+				if err != nil {
+					return
+				}
+				msg, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.Header.Get("Proxy-Authorization"), scheme+" "))
+				if len(msg) < 28 {
+					return
+				}
+				l := int(binary.LittleEndian.Uint16(msg[20:]))
+				off := int(binary.LittleEndian.Uint32(msg[24:]))
+				nt := msg[off : off+l]
+
+				mac := hmac.New(md5.New, key)
+				mac.Write(challenge[24:32])
+				mac.Write(nt[16:])
+				if !bytes.Equal(mac.Sum(nil), nt[:16]) {
+					fmt.Fprint(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+					return
+				}
+
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				fmt.Fprint(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+				go io.Copy(upstream, br)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	return l
+}
+
+func TestWithProxySOCKS5(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(serveRandomImage))
+	defer target.Close()
+
+	var tunnels int64
+	proxy := newSOCKSTestProxy(t, "alice", "secret", &tunnels)
+	defer proxy.Close()
+
+	client := New(WithProxy(&url.URL{Scheme: "socks5", User: url.UserPassword("alice", "secret"), Host: proxy.Addr().String()}))
+	server, err := client.CustomServer(target.URL + "/speedtest/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NewTestConfig(WithPingCount(3), WithSavingMode(true), WithProxyLatencyCorrection(true))
+	if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if server.ProxyLatency <= 0 || server.FullPathLatency < server.MinLatency {
+		t.Errorf("got unexpected proxy latency '%v', full path latency '%v' and latency '%v'",
+			server.ProxyLatency, server.FullPathLatency, server.MinLatency)
+	}
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&tunnels) == 0 {
+		t.Error("expected connections through the proxy")
+	}
+
+	client = New(WithProxy(&url.URL{Scheme: "socks5", User: url.UserPassword("alice", "wrong"), Host: proxy.Addr().String()}))
+	if _, err := client.doer.Get(target.URL); err == nil {
+		t.Error("expected authentication failure with a wrong password")
+	}
+}
+
+func TestWithProxyHTTP(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(serveRandomImage))
+	defer target.Close()
+
+	var forwarded, tunnels int64
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("alice:secret")) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		if r.Method != http.MethodConnect {
+			atomic.AddInt64(&forwarded, 1)
+			r.RequestURI = ""
+			r.Header.Del("Proxy-Authorization")
+			resp, err := http.DefaultTransport.RoundTrip(r)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			return
+		}
+
+		atomic.AddInt64(&tunnels, 1)
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		w.WriteHeader(http.StatusOK)
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go io.Copy(upstream, brw)
+		io.Copy(conn, upstream)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("alice", "secret")
+	client := New(WithProxy(proxyURL))
+	server, err := client.CustomServer(target.URL + "/speedtest/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.PingTestWithConfig(context.Background(), NewTestConfig(WithPingCount(3))); err != nil {
+		t.Fatal(err)
+	}
+	if server.ProxyLatency <= 0 || server.FullPathLatency != server.MinLatency {
+		t.Errorf("got unexpected proxy latency '%v', full path latency '%v' and latency '%v'",
+			server.ProxyLatency, server.FullPathLatency, server.MinLatency)
+	}
+	if atomic.LoadInt64(&forwarded) != 3 {
+		t.Errorf("got %v forwarded requests, expected 3", forwarded)
+	}
+
+	// Connections made outside the HTTP client are tunnelled with CONNECT.
+	conn, err := server.tcpDialer().DialContext(context.Background(), "tcp", target.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /speedtest/latency.txt HTTP/1.0\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt64(&tunnels) != 1 {
+		t.Errorf("got unexpected status '%v' and %v tunnels", resp.Status, tunnels)
+	}
+}
+
+func TestSubtractLatency(t *testing.T) {
+	if d := subtractLatency(30*time.Millisecond, 10*time.Millisecond); d != 20*time.Millisecond {
+		t.Errorf("got %v, expected 20ms", d)
+	}
+	if d := subtractLatency(5*time.Millisecond, 10*time.Millisecond); d != 0 {
+		t.Errorf("got %v, expected 0", d)
+	}
+}
+
+// newSOCKSTestProxy starts a SOCKS5 proxy requiring username/password authentication, counting its tunnels.
+func newSOCKSTestProxy(t *testing.T, user, password string, tunnels *int64) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+
+				head := make([]byte, 2)
+				if _, err := io.ReadFull(br, head); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(br, make([]byte, head[1])); err != nil {
+					return
+				}
+				conn.Write([]byte{socksVersion, socksAuthPassword})
+
+				readString := func() string {
+					n, _ := br.ReadByte()
+					b := make([]byte, n)
+					io.ReadFull(br, b)
+					return string(b)
+				}
+				br.ReadByte()
+				if readString() != user || readString() != password {
+					conn.Write([]byte{1, 1})
+					return
+				}
+				conn.Write([]byte{1, 0})
+
+				req := make([]byte, 4)
+				if _, err := io.ReadFull(br, req); err != nil || req[1] != socksCmdConnect {
+					return
+				}
+				var host string
+				switch req[3] {
+				case socksAddrIPv4:
+					ip := make([]byte, net.IPv4len)
+					io.ReadFull(br, ip)
+					host = net.IP(ip).String()
+				case socksAddrDomain:
+					host = readString()
+				default:
+					return
+				}
+				port := make([]byte, 2)
+				io.ReadFull(br, port)
+
+				upstream, err := net.Dial("tcp", net.JoinHostPort(host, fmt.Sprint(binary.BigEndian.Uint16(port))))
+				if err != nil {
+					conn.Write([]byte{socksVersion, 5, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+				atomic.AddInt64(tunnels, 1)
+				conn.Write([]byte{socksVersion, 0, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+
+				go io.Copy(upstream, br)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	return l
+}
@@ -0,0 +1,105 @@
+package speedtest
+
+import (
+	"math"
+	"time"
+)
+
+// QoE rates how well the connection suits common applications, from the speeds, round trips and loss of a Result.
+// Round trips are the median under load when loaded latency was measured, and the fastest idle round trip otherwise.
+// Ratings that lack the tests they depend on are left zero.
+type QoE struct {
+	// Streaming is the highest video quality the download speed sustains: "4K" from 25 Mbit/s, "HD" from 5 Mbit/s,
+	// "SD" from 3 Mbit/s and "none" below.
+	Streaming string `json:"streaming,omitempty"`
+	// VoIPMOS estimates the mean opinion score of a voice call, from 1 (bad) to 4.5 (excellent), with a simplified
+	// ITU-T G.107 E-model of the round trip, jitter and loss.
+	VoIPMOS float64 `json:"voip_mos,omitempty"`
+	// Gaming rates online gaming from "A" to "F" after the round trip, jitter and loss.
+	Gaming string `json:"gaming,omitempty"`
+}
+
+// streamingQualities are the download speeds in Mbit/s sustaining each video quality, as recommended by streaming services.
+var streamingQualities = []struct {
+	min     float64
+	quality string
+}{
+	{25, "4K"},
+	{5, "HD"},
+	{3, "SD"},
+}
+
+// gamingGrades are the upper bounds of the round trip, jitter and loss percentage for each gaming grade.
+var gamingGrades = []struct {
+	rtt, jitter time.Duration
+	loss        float64
+	grade       string
+}{
+	{30 * time.Millisecond, 5 * time.Millisecond, 0.5, "A"},
+	{60 * time.Millisecond, 10 * time.Millisecond, 1, "B"},
+	{100 * time.Millisecond, 20 * time.Millisecond, 2, "C"},
+	{150 * time.Millisecond, 40 * time.Millisecond, 5, "D"},
+}
+
+// qoe rates the result, or returns nil when neither the latency nor the download test ran.
+func (r *Result) qoe() *QoE {
+	if r.MinLatency <= 0 && r.DLSpeed <= 0 {
+		return nil
+	}
+	q := &QoE{}
+	if r.DLSpeed > 0 {
+		q.Streaming = "none"
+		for _, s := range streamingQualities {
+			if r.DLSpeed >= s.min {
+				q.Streaming = s.quality
+				break
+			}
+		}
+	}
+	if r.MinLatency > 0 {
+		rtt := r.qoeRoundTrip()
+		q.VoIPMOS = voipMOS(rtt, r.Jitter, r.PacketLoss)
+		q.Gaming = "F"
+		for _, g := range gamingGrades {
+			if rtt <= g.rtt && r.Jitter <= g.jitter && r.PacketLoss <= g.loss {
+				q.Gaming = g.grade
+				break
+			}
+		}
+	}
+	return q
+}
+
+// qoeRoundTrip returns the larger median round trip under load if it was measured, and the fastest round trip otherwise.
+func (r *Result) qoeRoundTrip() time.Duration {
+	rtt := r.MinLatency
+	if b := r.Bufferbloat; b != nil {
+		if b.Download.P50 > rtt {
+			rtt = b.Download.P50
+		}
+		if b.Upload.P50 > rtt {
+			rtt = b.Upload.P50
+		}
+	}
+	return rtt
+}
+
+// voipMOS estimates the mean opinion score of a call over a path of the given round trip, jitter and loss percentage.
+// The effective latency weighs jitter twice, as it is absorbed by the jitter buffer, and adds 10ms of codec delay.
+func voipMOS(rtt, jitter time.Duration, loss float64) float64 {
+	latency := float64(rtt+2*jitter)/float64(time.Millisecond) + 10
+	r := 93.2 - latency/40
+	if latency >= 160 {
+		r = 93.2 - (latency-120)/10
+	}
+	r -= 2.5 * loss
+
+	switch {
+	case r <= 0:
+		return 1
+	case r >= 100:
+		return 4.5
+	}
+	mos := math.Max(1, 1+0.035*r+0.000007*r*(r-60)*(100-r))
+	return math.Round(mos*100) / 100
+}
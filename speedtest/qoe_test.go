@@ -0,0 +1,59 @@
+package speedtest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestQoE(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		server Server
+		qoe    *QoE
+	}{
+		{"not tested", Server{}, nil},
+		{"download only", Server{DLSpeed: 12}, &QoE{Streaming: "HD"}},
+		{"fiber", Server{DLSpeed: 940, MinLatency: 8 * time.Millisecond, Jitter: time.Millisecond},
+			&QoE{Streaming: "4K", VoIPMOS: 4.4, Gaming: "A"}},
+		{"satellite", Server{DLSpeed: 2, MinLatency: 600 * time.Millisecond, Jitter: 30 * time.Millisecond, PacketLoss: 1},
+			&QoE{Streaming: "none", VoIPMOS: 1.86, Gaming: "F"}},
+		{"lossy", Server{DLSpeed: 50, MinLatency: 40 * time.Millisecond, Jitter: 5 * time.Millisecond, PacketLoss: 10},
+			&QoE{Streaming: "4K", VoIPMOS: 3.44, Gaming: "F"}},
+		{"bufferbloat", Server{DLSpeed: 4, MinLatency: 20 * time.Millisecond, Jitter: 2 * time.Millisecond,
+			Bufferbloat: &Bufferbloat{Download: LatencyPercentiles{P50: 90 * time.Millisecond}}},
+			&QoE{Streaming: "SD", VoIPMOS: 4.35, Gaming: "C"}},
+	} {
+		got := tc.server.Result().QoE
+		if (got == nil) != (tc.qoe == nil) || got != nil && *got != *tc.qoe {
+			t.Errorf("%s: got %+v, expected %+v", tc.name, got, tc.qoe)
+		}
+	}
+}
+
+func TestVoIPMOS(t *testing.T) {
+	if mos := voipMOS(0, 0, 0); mos != 4.4 {
+		t.Errorf("got MOS %v for a perfect path", mos)
+	}
+	if mos := voipMOS(2*time.Second, 0, 0); mos != 1 {
+		t.Errorf("got MOS %v for an unusable path", mos)
+	}
+	if a, b := voipMOS(100*time.Millisecond, 0, 0), voipMOS(200*time.Millisecond, 0, 0); a <= b {
+		t.Errorf("got MOS %v and %v, expected the score to fall with latency", a, b)
+	}
+}
+
+func TestQoEJSON(t *testing.T) {
+	r := (&Server{DLSpeed: 30, MinLatency: 20 * time.Millisecond}).Result()
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.QoE == nil || *decoded.QoE != *r.QoE {
+		t.Errorf("got %+v, expected %+v", decoded.QoE, r.QoE)
+	}
+}
@@ -0,0 +1,130 @@
+package speedtest
+
+import (
+	"fmt"
+	"math"
+)
+
+// ByteRate is a transfer rate in bytes per second.
+type ByteRate float64
+
+// RateFromMbps returns the rate of mbps Mbit/s, the unit of the speeds of Server and Result.
+func RateFromMbps(mbps float64) ByteRate {
+	return ByteRate(mbps * 1000 * 1000 / 8)
+}
+
+// Kbps returns the rate in kbit/s.
+func (r ByteRate) Kbps() float64 {
+	return float64(r) * 8 / 1000
+}
+
+// Mbps returns the rate in Mbit/s.
+func (r ByteRate) Mbps() float64 {
+	return float64(r) * 8 / 1000 / 1000
+}
+
+// Gbps returns the rate in Gbit/s.
+func (r ByteRate) Gbps() float64 {
+	return float64(r) * 8 / 1000 / 1000 / 1000
+}
+
+// MBps returns the rate in megabytes per second.
+func (r ByteRate) MBps() float64 {
+	return float64(r) / 1000 / 1000
+}
+
+// String formats the rate in bits per second with the largest fitting decimal prefix, e.g. "94.21 Mbps".
+func (r ByteRate) String() string {
+	return r.Format(UnitDecimalBits)
+}
+
+// Format formats the rate in the given unit with the largest fitting prefix and two decimals.
+func (r ByteRate) Format(unit RateUnit) string {
+	v := float64(r)
+	if unit == UnitDecimalBits || unit == UnitBinaryBits {
+		v *= 8
+	}
+	base := 1000.0
+	if unit == UnitBinaryBits || unit == UnitBinaryBytes {
+		base = 1024
+	}
+
+	prefixes := rateUnitPrefixes[unit]
+	i := 0
+	for i < len(prefixes)-1 && math.Abs(v) >= base {
+		v /= base
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", v, prefixes[i])
+}
+
+// RateUnit selects the unit ByteRate.Format formats rates in.
+type RateUnit int
+
+const (
+	// UnitDecimalBits formats rates in bits per second with SI prefixes: bps, Kbps, Mbps, Gbps.
+	UnitDecimalBits RateUnit = iota
+	// UnitDecimalBytes formats rates in bytes per second with SI prefixes: B/s, KB/s, MB/s, GB/s.
+	UnitDecimalBytes
+	// UnitBinaryBits formats rates in bits per second with binary prefixes: bps, Kibps, Mibps, Gibps.
+	UnitBinaryBits
+	// UnitBinaryBytes formats rates in bytes per second with binary prefixes: B/s, KiB/s, MiB/s, GiB/s.
+	UnitBinaryBytes
+)
+
+var rateUnitPrefixes = map[RateUnit][]string{
+	UnitDecimalBits:  {"bps", "Kbps", "Mbps", "Gbps", "Tbps"},
+	UnitDecimalBytes: {"B/s", "KB/s", "MB/s", "GB/s", "TB/s"},
+	UnitBinaryBits:   {"bps", "Kibps", "Mibps", "Gibps", "Tibps"},
+	UnitBinaryBytes:  {"B/s", "KiB/s", "MiB/s", "GiB/s", "TiB/s"},
+}
+
+// String representation of RateUnit
+func (u RateUnit) String() string {
+	switch u {
+	case UnitDecimalBytes:
+		return "decimal-bytes"
+	case UnitBinaryBits:
+		return "binary-bits"
+	case UnitBinaryBytes:
+		return "binary-bytes"
+	default:
+		return "decimal-bits"
+	}
+}
+
+// MarshalText encodes the unit as its string representation.
+func (u RateUnit) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText decodes a unit encoded by MarshalText.
+func (u *RateUnit) UnmarshalText(text []byte) error {
+	for _, unit := range []RateUnit{UnitDecimalBits, UnitDecimalBytes, UnitBinaryBits, UnitBinaryBytes} {
+		if unit.String() == string(text) {
+			*u = unit
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown rate unit %q", text)
+}
+
+// DLRate returns the download speed as a ByteRate.
+func (s *Server) DLRate() ByteRate {
+	return RateFromMbps(s.DLSpeed)
+}
+
+// ULRate returns the upload speed as a ByteRate.
+func (s *Server) ULRate() ByteRate {
+	return RateFromMbps(s.ULSpeed)
+}
+
+// DLRate returns the download speed as a ByteRate.
+func (r *Result) DLRate() ByteRate {
+	return RateFromMbps(r.DLSpeed)
+}
+
+// ULRate returns the upload speed as a ByteRate.
+func (r *Result) ULRate() ByteRate {
+	return RateFromMbps(r.ULSpeed)
+}
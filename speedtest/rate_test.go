@@ -0,0 +1,50 @@
+package speedtest
+
+import "testing"
+
+func TestByteRate(t *testing.T) {
+	r := RateFromMbps(100)
+	if r != 12500000 || r.Mbps() != 100 || r.Kbps() != 100000 || r.Gbps() != 0.1 || r.MBps() != 12.5 {
+		t.Errorf("got unexpected conversions of %v", float64(r))
+	}
+
+	for _, tc := range []struct {
+		rate     ByteRate
+		unit     RateUnit
+		expected string
+	}{
+		{RateFromMbps(94.214), UnitDecimalBits, "94.21 Mbps"},
+		{RateFromMbps(0.5), UnitDecimalBits, "500.00 Kbps"},
+		{RateFromMbps(2500), UnitDecimalBits, "2.50 Gbps"},
+		{RateFromMbps(100), UnitDecimalBytes, "12.50 MB/s"},
+		{ByteRate(1024 * 1024 / 8), UnitBinaryBits, "1.00 Mibps"},
+		{ByteRate(1536), UnitBinaryBytes, "1.50 KiB/s"},
+		{0, UnitDecimalBytes, "0.00 B/s"},
+	} {
+		if s := tc.rate.Format(tc.unit); s != tc.expected {
+			t.Errorf("got %q for %v in %v, expected %q", s, float64(tc.rate), tc.unit, tc.expected)
+		}
+	}
+	if s := RateFromMbps(94.214).String(); s != "94.21 Mbps" {
+		t.Errorf("got unexpected string %q", s)
+	}
+
+	server := &Server{DLSpeed: 80, ULSpeed: 8}
+	if server.DLRate().MBps() != 10 || server.Result().ULRate().MBps() != 1 {
+		t.Errorf("got unexpected rates %v and %v", server.DLRate(), server.Result().ULRate())
+	}
+}
+
+func TestRateUnitText(t *testing.T) {
+	for _, unit := range []RateUnit{UnitDecimalBits, UnitDecimalBytes, UnitBinaryBits, UnitBinaryBytes} {
+		text, _ := unit.MarshalText()
+		var decoded RateUnit
+		if err := decoded.UnmarshalText(text); err != nil || decoded != unit {
+			t.Errorf("got %v, %v for %q", decoded, err, text)
+		}
+	}
+	var u RateUnit
+	if err := u.UnmarshalText([]byte("furlongs")); err == nil {
+		t.Error("expected an error for an unknown unit")
+	}
+}
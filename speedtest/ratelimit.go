@@ -0,0 +1,66 @@
+package speedtest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// capReachedRatio is the fraction of the rate limit above which a capped test is considered to have hit the cap.
+const capReachedRatio = 0.8
+
+// tokenBucket limits the byte rate shared by all streams of a test.
+// Transfers reserve tokens ahead of time, so concurrent streams queue for the available rate instead of bursting.
+type tokenBucket struct {
+	ctx context.Context
+
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a bucket admitting mbps Mbit/s, or nil if mbps is not positive.
+// Waiting is abandoned when ctx is done.
+func newTokenBucket(ctx context.Context, mbps float64) *tokenBucket {
+	if mbps <= 0 {
+		return nil
+	}
+	rate := mbps * 1000 * 1000 / 8
+	return &tokenBucket{
+		ctx:   ctx,
+		rate:  rate,
+		burst: rate / 20, // 50ms of traffic
+		last:  time.Now(),
+	}
+}
+
+// wait blocks until n bytes may be transferred.
+func (b *tokenBucket) wait(n int) {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	debt := b.tokens
+	b.mu.Unlock()
+
+	if debt >= 0 {
+		return
+	}
+	t := time.NewTimer(time.Duration(-debt / b.rate * float64(time.Second)))
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-b.ctx.Done():
+	}
+}
+
+// capReached reports whether a test capped at limit Mbit/s reached the cap, its speed being within the ratio of it.
+func capReached(speed, limit float64) bool {
+	return limit > 0 && speed >= limit*capReachedRatio
+}
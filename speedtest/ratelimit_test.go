@@ -0,0 +1,98 @@
+package speedtest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	if newTokenBucket(context.Background(), 0) != nil {
+		t.Error("expected no bucket without a rate")
+	}
+
+	// 8 Mbit/s admits 1MB per second.
+	m := &meter{limit: newTokenBucket(context.Background(), 8)}
+	sTime := time.Now()
+	for i := 0; i < 10; i++ {
+		m.Write(make([]byte, 50000))
+	}
+	if d := time.Since(sTime); d < 400*time.Millisecond || 700*time.Millisecond < d {
+		t.Errorf("got unexpected duration %v for 500kB at 1MB/s", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m = &meter{limit: newTokenBucket(ctx, 8)}
+	sTime = time.Now()
+	m.Write(make([]byte, 1000000))
+	if d := time.Since(sTime); d > 100*time.Millisecond {
+		t.Errorf("waiting was not abandoned on a done context, took %v", d)
+	}
+}
+
+func TestWarmUpRateLimit(t *testing.T) {
+	server := &Server{URL: "http://dummy.com/upload.php"}
+	request := func(ctx context.Context, doer *http.Client, m *meter) error {
+		m.Write(make([]byte, 50000))
+		return nil
+	}
+
+	// 8 Mbit/s admits 1MB per second, shared by both streams.
+	cfg := NewTestConfig(WithWarmUp(time.Minute, 500000), WithRateLimit(8))
+	speed, bytes, elapsed, err := server.warmUp(context.Background(), cfg, nil, 50000, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed < 400*time.Millisecond || speed > 12 {
+		t.Errorf("got %v bytes in '%v' at %v Mbit/s, expected the warm-up to be capped at 8 Mbit/s", bytes, elapsed, speed)
+	}
+}
+
+func TestCapReached(t *testing.T) {
+	for _, tc := range []struct {
+		speed, limit float64
+		expected     bool
+	}{
+		{speed: 50, limit: 0, expected: false},
+		{speed: 9.5, limit: 10, expected: true},
+		{speed: 5, limit: 10, expected: false},
+	} {
+		if got := capReached(tc.speed, tc.limit); got != tc.expected {
+			t.Errorf("capReached(%v, %v) = %v, expected %v", tc.speed, tc.limit, got, tc.expected)
+		}
+	}
+}
+
+func TestUploadTestContextRateLimit(t *testing.T) {
+	server := Server{
+		URL:     "http://dummy.com/upload.php",
+		Latency: 5 * time.Millisecond,
+	}
+
+	err := server.uploadTestContext(
+		context.Background(),
+		NewTestConfig(WithMaxStreams(2), WithPayloadSize(1000000), WithRateLimit(16)),
+		mockWarmUp,
+		mockMeteredUpload,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.ULSpeed < 12 || 17 < server.ULSpeed {
+		t.Errorf("got unexpected server.ULSpeed '%v', expected about 16", server.ULSpeed)
+	}
+	if !server.ULCapReached {
+		t.Error("expected the cap to be reported as reached")
+	}
+}
+
+// mockMeteredUpload reads the upload payload of weight w through the meter as fast as the meter allows.
+func mockMeteredUpload(ctx context.Context, doer *http.Client, w int, m *meter) error {
+	_, err := io.Copy(ioutil.Discard, m.countReader(strings.NewReader(strings.Repeat("0", ulPayload(w)))))
+	return err
+}
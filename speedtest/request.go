@@ -2,72 +2,104 @@ package speedtest
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/url"
-	"strconv"
-	"strings"
+	"net/http/httptrace"
+	"os"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 )
 
-type downloadWarmUpFunc func(context.Context, *http.Client, string) error
-type downloadFunc func(context.Context, *http.Client, string, int) error
-type uploadWarmUpFunc func(context.Context, *http.Client, string) error
-type uploadFunc func(context.Context, *http.Client, string, int) error
+type downloadWarmUpFunc func(context.Context, *http.Client, *meter) error
+type downloadFunc func(context.Context, *http.Client, int, *meter) error
+type uploadWarmUpFunc func(context.Context, *http.Client, *meter) error
+type uploadFunc func(context.Context, *http.Client, int, *meter) error
+
+const (
+	defaultPingCount = 3
+	pingTimeout      = 5 * time.Second
+)
 
 var dlSizes = [...]int{350, 500, 750, 1000, 1500, 2000, 2500, 3000, 3500, 4000}
 var ulSizes = [...]int{100, 300, 500, 800, 1000, 1500, 2500, 3000, 3500, 4000} //kB
 
+// Weights of the payloads of warm-up requests.
+const (
+	dlWarmUpWeight = 2
+	ulWarmUpWeight = 4
+)
+
 // DownloadTest executes the test to measure download speed
 func (s *Server) DownloadTest(savingMode bool) error {
-	return s.downloadTestContext(context.Background(), savingMode, dlWarmUp, downloadRequest)
+	return s.DownloadTestWithConfig(context.Background(), TestConfig{SavingMode: savingMode})
 }
 
 // DownloadTestContext executes the test to measure download speed, observing the given context.
 func (s *Server) DownloadTestContext(ctx context.Context, savingMode bool) error {
-	return s.downloadTestContext(ctx, savingMode, dlWarmUp, downloadRequest)
+	return s.DownloadTestWithConfig(ctx, TestConfig{SavingMode: savingMode})
+}
+
+// DownloadTestWithConfig executes the test to measure download speed as configured by cfg, observing the given context.
+func (s *Server) DownloadTestWithConfig(ctx context.Context, cfg TestConfig) error {
+	warmUp, request, err := s.downloadFuncs(cfg)
+	if err != nil {
+		return err
+	}
+	return s.downloadTestContext(ctx, cfg, warmUp, request)
+}
+
+// downloadFuncs returns the warm-up and request functions of the download test for the server type.
+func (s *Server) downloadFuncs(cfg TestConfig) (downloadWarmUpFunc, downloadFunc, error) {
+	if s.Type == OoklaSocketServer {
+		d, err := cfg.dialer(s.tcpDialer())
+		if err != nil {
+			return nil, nil, err
+		}
+		warmUp, request := s.socketDownloadFuncs(d)
+		return warmUp, request, nil
+	}
+	p, err := s.protocol()
+	if err != nil {
+		return nil, nil, err
+	}
+	warmUp, request := s.httpDownloadFuncs(p)
+	return warmUp, request, nil
 }
 
 func (s *Server) downloadTestContext(
 	ctx context.Context,
-	savingMode bool,
+	cfg TestConfig,
 	dlWarmUp downloadWarmUpFunc,
 	downloadRequest downloadFunc,
 ) error {
-	dlURL := strings.Split(s.URL, "/upload.php")[0]
-	eg := errgroup.Group{}
+	doer, release, err := cfg.testClient(s.doer)
+	if err != nil {
+		return err
+	}
+	defer release()
+	timing := &timingCollector{}
+	ctx = withBufferBudget(withTiming(ctx, timing), newBufferBudget(cfg.MaxBufferMemory))
 
 	// Warming up
 	sTime := time.Now()
-	for i := 0; i < 2; i++ {
-		eg.Go(func() error {
-			return dlWarmUp(ctx, s.doer, dlURL)
-		})
-	}
-	if err := eg.Wait(); err != nil {
+	wuSpeed, wuBytes, wuDuration, err := s.warmUp(ctx, cfg, doer, s.downloadPayload(dlWarmUpWeight), dlWarmUp)
+	if err != nil {
+		if ctx.Err() != nil {
+			return &InterruptedError{Stage: StageDownload, Result: s.Result(), Err: ctx.Err()}
+		}
 		return err
 	}
-	fTime := time.Now()
-
-	// If the bandwidth is too large, the download sometimes finish earlier than the latency.
-	// In this case, we ignore the the latency that is included server information.
-	// This is not affected to the final result since this is a warm up test.
-	timeToSpend := fTime.Sub(sTime.Add(s.Latency)).Seconds()
-	if timeToSpend < 0 {
-		timeToSpend = fTime.Sub(sTime).Seconds()
-	}
-
-	// 1.125MB for each request (750 * 750 * 2)
-	wuSpeed := 1.125 * 8 * 2 / timeToSpend
 
 	// Decide workload by warm up speed
 	workload := 0
 	weight := 0
 	skip := false
-	if savingMode {
+	if cfg.SavingMode {
 		workload = 6
 		weight = 3
 	} else if 50.0 < wuSpeed {
@@ -85,64 +117,160 @@ func (s *Server) downloadTestContext(
 	} else {
 		skip = true
 	}
+	workload, weight = cfg.workload(workload, weight, s.downloadPayload)
+	// Adaptive scaling finds the number of streams itself, even on links too slow for the ladder.
+	skip = skip && !cfg.adaptive()
 
 	// Main speedtest
 	dlSpeed := wuSpeed
+	dlBytes := wuBytes
+	dlDuration := wuDuration
+	dlStable := wuSpeed
+	var interrupted error
 	if !skip {
-		sTime = time.Now()
-		for i := 0; i < workload; i++ {
-			eg.Go(func() error {
-				return downloadRequest(ctx, s.doer, dlURL, weight)
-			})
-		}
-		if err := eg.Wait(); err != nil {
+		sink, closeSink, err := cfg.downloadSink()
+		if err != nil {
 			return err
 		}
-		fTime = time.Now()
+		defer closeSink()
+		m := &meter{limit: newTokenBucket(ctx, cfg.RateLimit), sink: sink}
+		stop := reportProgress(cfg, StageDownload, m)
+		stopProbe := s.probeLatency(ctx, cfg)
+		stopSampling := sampleThroughput(m)
+		streams := newStreamSet(m)
+		soak := startSoak(cfg, StageDownload, m, doer)
+		requests, elapsed, err := cfg.runStreams(ctx, workload, streams, soak.retry(func(ctx context.Context, m *meter) error {
+			return downloadRequest(ctx, doer, weight, m)
+		}))
+		samples := stopSampling()
+		loaded := stopProbe()
+		stop()
+		s.recordSoak(StageDownload, soak.stop())
+		if err != nil {
+			if ctx.Err() == nil {
+				return err
+			}
+			interrupted = ctx.Err()
+		}
 
-		reqMB := dlSizes[weight] * dlSizes[weight] * 2 / 1000 / 1000
-		dlSpeed = float64(reqMB) * 8 * float64(workload) / fTime.Sub(sTime).Seconds()
+		dlBytes = requests * int64(s.downloadPayload(weight))
+		if interrupted != nil || soak != nil {
+			// Count the bytes of the requests cut short too, by the context or by the errors of a soak test.
+			dlBytes = int64(m.total())
+		}
+		dlDuration = elapsed
+		dlSpeed = mbps(uint64(dlBytes), elapsed)
+		if w := streams.drainWindow(); w != nil {
+			// The requests drained past the deadline count, but not towards the speed.
+			dlBytes = int64(m.total())
+			dlSpeed = mbps(w.bytes, w.length)
+			samples = w.samples(samples)
+		}
+		if speed, ok := estimateThroughput(samples, cfg.Estimator); ok {
+			dlSpeed = speed
+		}
+		dlStable = dlSpeed
+		if speed, ok := smoothThroughput(samples); ok {
+			dlStable = speed
+		}
+		s.dlSamples = samples
+		s.dlStreams = streams.stats()
+		s.setStreamsRemote(s.dlStreams)
+		s.recordLoadedLatency(StageDownload, loaded)
 	}
 
 	s.DLSpeed = dlSpeed
+	s.DLCapReached = capReached(dlSpeed, cfg.RateLimit)
+	s.DLSpeedStable = dlStable
+	s.DLWireSpeed = cfg.overhead().WireSpeed(dlSpeed, s.IPVersion)
+	s.dlBytes = dlBytes
+	s.dlDuration = dlDuration
+	if t, ok := timing.summary(); ok {
+		s.timings().Download = t
+	}
+	s.markTest(sTime)
+	if interrupted != nil {
+		return &InterruptedError{Stage: StageDownload, Result: s.Result(), Err: interrupted}
+	}
 	return nil
 }
 
 // UploadTest executes the test to measure upload speed
 func (s *Server) UploadTest(savingMode bool) error {
-	return s.uploadTestContext(context.Background(), savingMode, ulWarmUp, uploadRequest)
+	return s.UploadTestWithConfig(context.Background(), TestConfig{SavingMode: savingMode})
 }
 
 // UploadTestContext executes the test to measure upload speed, observing the given context.
 func (s *Server) UploadTestContext(ctx context.Context, savingMode bool) error {
-	return s.uploadTestContext(ctx, savingMode, ulWarmUp, uploadRequest)
+	return s.UploadTestWithConfig(ctx, TestConfig{SavingMode: savingMode})
+}
+
+// UploadTestWithConfig executes the test to measure upload speed as configured by cfg, observing the given context.
+func (s *Server) UploadTestWithConfig(ctx context.Context, cfg TestConfig) error {
+	if err := s.uploadTestWithConfig(ctx, cfg); err != nil {
+		return err
+	}
+	if cfg.ShareResult {
+		_, _ = s.ShareResultContext(ctx)
+	}
+	return nil
 }
+
+func (s *Server) uploadTestWithConfig(ctx context.Context, cfg TestConfig) error {
+	warmUp, request, err := s.uploadFuncs(cfg)
+	if err != nil {
+		return err
+	}
+	return s.uploadTestContext(ctx, cfg, warmUp, request)
+}
+
+// uploadFuncs returns the warm-up and request functions of the upload test for the server type.
+func (s *Server) uploadFuncs(cfg TestConfig) (uploadWarmUpFunc, uploadFunc, error) {
+	if s.Type == OoklaSocketServer {
+		d, err := cfg.dialer(s.tcpDialer())
+		if err != nil {
+			return nil, nil, err
+		}
+		warmUp, request := s.socketUploadFuncs(d)
+		return warmUp, request, nil
+	}
+	p, err := s.protocol()
+	if err != nil {
+		return nil, nil, err
+	}
+	warmUp, request := s.httpUploadFuncs(p, cfg.uploadPayload())
+	return warmUp, request, nil
+}
+
 func (s *Server) uploadTestContext(
 	ctx context.Context,
-	savingMode bool,
+	cfg TestConfig,
 	ulWarmUp uploadWarmUpFunc,
 	uploadRequest uploadFunc,
 ) error {
+	doer, release, err := cfg.testClient(s.doer)
+	if err != nil {
+		return err
+	}
+	defer release()
+	timing := &timingCollector{}
+	ctx = withTiming(ctx, timing)
+
 	// Warm up
 	sTime := time.Now()
-	eg := errgroup.Group{}
-	for i := 0; i < 2; i++ {
-		eg.Go(func() error {
-			return ulWarmUp(ctx, s.doer, s.URL)
-		})
-	}
-	if err := eg.Wait(); err != nil {
+	wuSpeed, wuBytes, wuDuration, err := s.warmUp(ctx, cfg, doer, ulPayload(ulWarmUpWeight), ulWarmUp)
+	if err != nil {
+		if ctx.Err() != nil {
+			return &InterruptedError{Stage: StageUpload, Result: s.Result(), Err: ctx.Err()}
+		}
 		return err
 	}
-	fTime := time.Now()
-	// 1.0 MB for each request
-	wuSpeed := 1.0 * 8 * 2 / fTime.Sub(sTime.Add(s.Latency)).Seconds()
 
 	// Decide workload by warm up speed
 	workload := 0
 	weight := 0
 	skip := false
-	if savingMode {
+	if cfg.SavingMode {
 		workload = 1
 		weight = 7
 	} else if 50.0 < wuSpeed {
@@ -160,102 +288,199 @@ func (s *Server) uploadTestContext(
 	} else {
 		skip = true
 	}
+	workload, weight = cfg.workload(workload, weight, ulPayload)
+	// Adaptive scaling finds the number of streams itself, even on links too slow for the ladder.
+	skip = skip && !cfg.adaptive()
 
 	// Main speedtest
 	ulSpeed := wuSpeed
+	ulBytes := wuBytes
+	ulDuration := wuDuration
+	ulStable := wuSpeed
+	var interrupted error
 	if !skip {
-		sTime = time.Now()
-		for i := 0; i < workload; i++ {
-			eg.Go(func() error {
-				return uploadRequest(ctx, s.doer, s.URL, weight)
-			})
-		}
-		if err := eg.Wait(); err != nil {
-			return err
+		m := &meter{limit: newTokenBucket(ctx, cfg.RateLimit)}
+		stop := reportProgress(cfg, StageUpload, m)
+		stopProbe := s.probeLatency(ctx, cfg)
+		stopSampling := sampleThroughput(m)
+		streams := newStreamSet(m)
+		soak := startSoak(cfg, StageUpload, m, doer)
+		requests, elapsed, err := cfg.runStreams(ctx, workload, streams, soak.retry(func(ctx context.Context, m *meter) error {
+			return uploadRequest(ctx, doer, weight, m)
+		}))
+		samples := stopSampling()
+		loaded := stopProbe()
+		stop()
+		s.recordSoak(StageUpload, soak.stop())
+		if err != nil {
+			if ctx.Err() == nil {
+				return err
+			}
+			interrupted = ctx.Err()
 		}
-		fTime = time.Now()
 
-		reqMB := float64(ulSizes[weight]) / 1000
-		ulSpeed = reqMB * 8 * float64(workload) / fTime.Sub(sTime).Seconds()
+		ulBytes = requests * int64(ulPayload(weight))
+		if interrupted != nil || soak != nil {
+			// Count the bytes of the requests cut short too, by the context or by the errors of a soak test.
+			ulBytes = int64(m.total())
+		}
+		ulDuration = elapsed
+		ulSpeed = mbps(uint64(ulBytes), elapsed)
+		if w := streams.drainWindow(); w != nil {
+			// The requests drained past the deadline count, but not towards the speed.
+			ulBytes = int64(m.total())
+			ulSpeed = mbps(w.bytes, w.length)
+			samples = w.samples(samples)
+		}
+		if speed, ok := estimateThroughput(samples, cfg.Estimator); ok {
+			ulSpeed = speed
+		}
+		ulStable = ulSpeed
+		if speed, ok := smoothThroughput(samples); ok {
+			ulStable = speed
+		}
+		s.ulSamples = samples
+		s.ulStreams = streams.stats()
+		s.setStreamsRemote(s.ulStreams)
+		s.recordLoadedLatency(StageUpload, loaded)
 	}
 
 	s.ULSpeed = ulSpeed
+	s.ULCapReached = capReached(ulSpeed, cfg.RateLimit)
+	s.ULSpeedStable = ulStable
+	s.ULWireSpeed = cfg.overhead().WireSpeed(ulSpeed, s.IPVersion)
+	s.ulBytes = ulBytes
+	s.ulDuration = ulDuration
+	if t, ok := timing.summary(); ok {
+		s.timings().Upload = t
+	}
+	s.markTest(sTime)
+	if interrupted != nil {
+		return &InterruptedError{Stage: StageUpload, Result: s.Result(), Err: interrupted}
+	}
 
 	return nil
 }
 
-func dlWarmUp(ctx context.Context, doer *http.Client, dlURL string) error {
-	size := dlSizes[2]
-	xdlURL := dlURL + "/random" + strconv.Itoa(size) + "x" + strconv.Itoa(size) + ".jpg"
+// runStreams runs request on the given number of concurrent streams of set and returns how many requests completed and how long it took,
+// along with the first error of a request, if any.
+// With a zero duration every stream issues a single request; otherwise streams keep issuing requests until duration has elapsed.
+func runStreams(ctx context.Context, streams int, duration time.Duration, set *streamSet, request func(context.Context, *meter) error) (int64, time.Duration, error) {
+	var requests int64
+	eg := errgroup.Group{}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, xdlURL, nil)
-	if err != nil {
-		return err
+	sTime := time.Now()
+	for i := 0; i < streams; i++ {
+		st := set.add()
+		eg.Go(func() error {
+			for {
+				if err := st.do(ctx, request); err != nil {
+					return err
+				}
+				atomic.AddInt64(&requests, 1)
+
+				if duration <= 0 || time.Since(sTime) >= duration || ctx.Err() != nil {
+					return nil
+				}
+			}
+		})
 	}
+	err := eg.Wait()
+	return requests, time.Since(sTime), err
+}
 
-	resp, err := doer.Do(req)
-	if err != nil {
-		return err
+// httpDownloadFuncs returns the warm-up and request functions downloading the payloads built by p.
+// Warm-up requests download the payload of weight dlWarmUpWeight.
+func (s *Server) httpDownloadFuncs(p ServerProtocol) (downloadWarmUpFunc, downloadFunc) {
+	download := func(ctx context.Context, doer *http.Client, w int, dst io.Writer) error {
+		req, err := p.BuildDownloadRequest(ctx, s, w)
+		if err != nil {
+			return err
+		}
+		return fetchPayload(doer, req, p.PayloadSize(w), dst)
 	}
-	defer resp.Body.Close()
-	_, err = io.Copy(ioutil.Discard, resp.Body)
-	return err
+	warmUp := func(ctx context.Context, doer *http.Client, m *meter) error {
+		return download(ctx, doer, dlWarmUpWeight, m)
+	}
+	request := func(ctx context.Context, doer *http.Client, w int, m *meter) error {
+		return download(ctx, doer, w, m)
+	}
+	return warmUp, request
 }
 
-func ulWarmUp(ctx context.Context, doer *http.Client, ulURL string) error {
-	size := ulSizes[4]
-	v := url.Values{}
-	v.Add("content", strings.Repeat("0123456789", size*100-51))
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ulURL, strings.NewReader(v.Encode()))
+// fetchPayload sends req and copies the payload of about expected bytes it downloads into dst.
+func fetchPayload(doer *http.Client, req *http.Request, expected int, dst io.Writer) error {
+	req, st := traceStream(traceTiming(req))
+	resp, err := doer.Do(req)
 	if err != nil {
+		return connError(req.Context(), err)
+	}
+	defer resp.Body.Close()
+	st.observe(resp)
+	if err := checkStatus(resp); err != nil {
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := doer.Do(req)
+	n, err := copyPayload(req.Context(), dst, resp.Body)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	_, err = io.Copy(ioutil.Discard, resp.Body)
-	return err
+	return checkPayload(req.URL.String(), n, expected)
 }
 
-func downloadRequest(ctx context.Context, doer *http.Client, dlURL string, w int) error {
-	size := dlSizes[w]
-	xdlURL := dlURL + "/random" + strconv.Itoa(size) + "x" + strconv.Itoa(size) + ".jpg"
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, xdlURL, nil)
-	if err != nil {
-		return err
+// checkPayload returns ErrPayloadTooSmall if n bytes are less than half of the expected payload.
+// The images served by speedtest.net are compressed, so their size only approximates the expected one.
+func checkPayload(rawURL string, n int64, expected int) error {
+	if n < int64(expected)/2 {
+		return fmt.Errorf("%w: got %d bytes from %s, expected about %d", ErrPayloadTooSmall, n, rawURL, expected)
 	}
+	return nil
+}
 
-	resp, err := doer.Do(req)
-	if err != nil {
-		return err
+// httpUploadFuncs returns the warm-up and request functions posting payloads filled by payload with the requests built by p.
+// Warm-up requests upload the payload of weight ulWarmUpWeight.
+func (s *Server) httpUploadFuncs(p ServerProtocol, payload func(int64) io.Reader) (uploadWarmUpFunc, uploadFunc) {
+	upload := func(ctx context.Context, doer *http.Client, w int, m *meter) error {
+		newBody, length := uploadBody(ulSizes[w], payload)
+		req, err := p.BuildUploadRequest(ctx, s, length)
+		if err != nil {
+			return err
+		}
+		return postPayload(doer, req, newBody, length, m)
 	}
-	defer resp.Body.Close()
-	_, err = io.Copy(ioutil.Discard, resp.Body)
-	return err
+	warmUp := func(ctx context.Context, doer *http.Client, m *meter) error {
+		return upload(ctx, doer, ulWarmUpWeight, m)
+	}
+	return warmUp, upload
 }
 
-func uploadRequest(ctx context.Context, doer *http.Client, ulURL string, w int) error {
-	size := ulSizes[w]
-	v := url.Values{}
-	v.Add("content", strings.Repeat("0123456789", size*100-51))
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ulURL, strings.NewReader(v.Encode()))
-	if err != nil {
-		return err
+// postPayload sends req with the length bytes of the bodies returned by newBody, counting the bytes sent with m if not nil.
+// The body is form encoded unless req sets another Content-Type.
+func postPayload(doer *http.Client, req *http.Request, newBody func() io.ReadCloser, length int64, m *meter) error {
+	getBody := func() (io.ReadCloser, error) {
+		body := newBody()
+		if m == nil {
+			return body, nil
+		}
+		return ioutil.NopCloser(m.countReader(body)), nil
+	}
+	req.Body, _ = getBody()
+	req.GetBody = getBody
+	req.ContentLength = length
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req, st := traceStream(traceTiming(req))
 	resp, err := doer.Do(req)
 	if err != nil {
-		return err
+		return connError(req.Context(), err)
 	}
 	defer resp.Body.Close()
+	st.observe(resp)
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
 
 	_, err = io.Copy(ioutil.Discard, resp.Body)
 	return err
@@ -268,31 +493,219 @@ func (s *Server) PingTest() error {
 
 // PingTestContext executes test to measure latency, observing the given context.
 func (s *Server) PingTestContext(ctx context.Context) error {
-	pingURL := strings.Split(s.URL, "/upload.php")[0] + "/latency.txt"
+	return s.LatencyTestContext(ctx, defaultPingCount)
+}
+
+// LatencyTest executes test to measure latency, jitter and packet loss over count round trips
+func (s *Server) LatencyTest(count int) error {
+	return s.LatencyTestContext(context.Background(), count)
+}
+
+// LatencyTestContext executes test to measure latency, jitter and packet loss over count round trips, observing the given context.
+// A round trip that fails or takes longer than pingTimeout is counted as lost; an error is returned only if every round trip is lost.
+func (s *Server) LatencyTestContext(ctx context.Context, count int) error {
+	return s.PingTestWithConfig(ctx, TestConfig{PingCount: count})
+}
+
+// PingTestICMP executes test to measure latency with ICMP echo requests, observing the given context.
+// ICMP requires a raw socket; without the privilege to open one, the server type's native method is used instead.
+func (s *Server) PingTestICMP(ctx context.Context) error {
+	return s.PingTestWithConfig(ctx, TestConfig{LatencyMethod: LatencyICMP})
+}
 
-	l := time.Second * 10
-	for i := 0; i < 3; i++ {
-		sTime := time.Now()
+// PingTestWithConfig executes test to measure latency, jitter and packet loss as configured by cfg, observing the given context.
+// The method that produced the result is recorded in Server.LatencyMethod.
+func (s *Server) PingTestWithConfig(ctx context.Context, cfg TestConfig) error {
+	count := cfg.PingCount
+	if count <= 0 {
+		count = defaultPingCount
+	}
+
+	if cfg.TracePath {
+		if err := s.TracePath(ctx, cfg); err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	r := &remote{}
+	ctx = withRemote(ctx, r)
+	timing := &timingCollector{}
+	ctx = withTiming(ctx, timing)
+	ping, method, closer, err := s.pinger(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
 
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, pingURL, nil)
+	start := time.Now()
+	samples := make([]time.Duration, count)
+	var lastErr error
+	for i := range samples {
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		rtt, err := ping(pingCtx)
+		cancel()
 		if err != nil {
-			return err
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = &kindError{kind: ErrTestTimeout, err: err}
+			}
+			lastErr = err
+			continue
 		}
+		samples[i] = rtt
+	}
 
-		resp, err := s.doer.Do(req)
+	st := latencyStats(samples)
+	if st.Loss == 100 {
+		return lastErr
+	}
+
+	s.ProxyLatency, s.FullPathLatency = 0, 0
+	if s.proxy != nil && s.proxy.addr != "" {
+		proxyRTT, err := s.proxyLatency(ctx, count)
 		if err != nil {
 			return err
 		}
+		s.ProxyLatency = proxyRTT
+		s.FullPathLatency = st.Min
+		if cfg.ProxyLatencyCorrection {
+			st.Min = subtractLatency(st.Min, proxyRTT)
+			st.Max = subtractLatency(st.Max, proxyRTT)
+		}
+	}
+
+	s.Latency = time.Duration(int64(st.Min.Nanoseconds() / 2))
+	s.MinLatency = st.Min
+	s.MaxLatency = st.Max
+	s.Jitter = st.Jitter
+	s.PacketLoss = st.Loss
+	s.LatencyMethod = method
+	s.setRemote(r.get())
+	s.idleSamples = samples
+	if t, ok := timing.summary(); ok {
+		s.timings().Latency = t
+	}
+	s.markTest(start)
+
+	return nil
+}
 
-		fTime := time.Now()
-		if fTime.Sub(sTime) < l {
-			l = fTime.Sub(sTime)
+// pinger returns the function measuring a single round trip with the method requested by cfg, and the method actually used.
+// Methods that keep a connection open measure every round trip on it, so that connection setup is not included;
+// the returned closer, if not nil, must be closed when done.
+func (s *Server) pinger(ctx context.Context, cfg TestConfig) (func(context.Context) (time.Duration, error), LatencyMethod, io.Closer, error) {
+	method := cfg.LatencyMethod
+	d, err := cfg.dialer(s.tcpDialer())
+	if err != nil {
+		return nil, method, nil, err
+	}
+	switch {
+	case method == LatencyWebSocket && s.Type == LibrespeedServer:
+		c, err := dialWebSocket(ctx, d, s.librespeedWebSocketURL(), cfg.ConnConfig.TLS)
+		if err == nil {
+			return c.ping, LatencyWebSocket, c, nil
+		}
+		// The WebSocket endpoint is optional, fall back to HTTP.
+	case method == LatencyICMP && s.proxy == nil && s.netDialer == nil:
+		c, err := dialICMP(ctx, s.dialer, s.hostname(), cfg.network("ip"))
+		if err == nil {
+			return c.ping, LatencyICMP, c, nil
+		}
+		if !errors.Is(err, os.ErrPermission) {
+			return nil, LatencyICMP, nil, err
 		}
+		// Raw sockets require privileges, fall back to the native method.
+	case method == LatencyUDP && (s.Type == StandardServer || s.Type == OoklaSocketServer) && s.proxy == nil:
+		c, err := dialUDP(ctx, s.udpDialer(), s.socketAddr(), cfg.network("udp"))
+		if err != nil {
+			return nil, LatencyUDP, nil, err
+		}
+		return c.ping, LatencyUDP, c, nil
+	}
 
-		resp.Body.Close()
+	if s.Type == OoklaSocketServer {
+		c, err := dialSocket(ctx, d, s.socketAddr())
+		if err != nil {
+			return nil, LatencySocket, nil, err
+		}
+		return c.ping, LatencySocket, c, nil
+	}
+	if _, err := s.protocol(); err != nil {
+		return nil, method, nil, err
 	}
+	doer, release, err := cfg.testClient(s.doer)
+	if err != nil {
+		return nil, LatencyHTTP, nil, err
+	}
+	ping := func(ctx context.Context) (time.Duration, error) {
+		return s.httpPing(ctx, doer)
+	}
+	return ping, LatencyHTTP, releaser(release), nil
+}
 
-	s.Latency = time.Duration(int64(l.Nanoseconds() / 2))
+// releaser adapts a function releasing resources to an io.Closer.
+type releaser func()
 
+func (r releaser) Close() error {
+	r()
 	return nil
 }
+
+// ping measures a single round trip to the server's latency endpoint.
+func (s *Server) ping(ctx context.Context) (time.Duration, error) {
+	if s.Type == OoklaSocketServer {
+		c, err := dialSocket(ctx, s.tcpDialer(), s.socketAddr())
+		if err != nil {
+			return 0, err
+		}
+		defer c.Close()
+		return c.ping(ctx)
+	}
+
+	return s.httpPing(ctx, s.doer)
+}
+
+// httpPing measures a single round trip to the server's HTTP latency endpoint with doer.
+func (s *Server) httpPing(ctx context.Context, doer *http.Client) (time.Duration, error) {
+	p, err := s.protocol()
+	if err != nil {
+		return 0, err
+	}
+	req, err := p.BuildPingRequest(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+
+	req = traceTiming(req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			recordRemote(ctx, info.Conn.RemoteAddr())
+		},
+	})))
+
+	sTime := time.Now()
+	resp, err := doer.Do(req)
+	if err != nil {
+		return 0, connError(ctx, err)
+	}
+	fTime := time.Now()
+
+	resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return 0, err
+	}
+
+	return fTime.Sub(sTime), nil
+}
+
+// downloadPayload returns the size in bytes of a download request with weight w.
+func (s *Server) downloadPayload(w int) int {
+	if p, err := s.protocol(); err == nil {
+		return p.PayloadSize(w)
+	}
+	return dlPayload(w)
+}
@@ -2,10 +2,15 @@ package speedtest
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/showwin/speedtest-go/speedtest/speedtesttest"
 )
 
 func TestDownloadTestContext(t *testing.T) {
@@ -17,15 +22,15 @@ func TestDownloadTestContext(t *testing.T) {
 
 	err := server.downloadTestContext(
 		context.Background(),
-		false,
+		TestConfig{},
 		mockWarmUp,
 		mockRequest,
 	)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
-	if server.DLSpeed < 6000 || 6300 < server.DLSpeed {
-		t.Errorf("got unexpected server.DLSpeed '%v', expected between 6000 and 6300", server.DLSpeed)
+	if server.DLSpeed < 6200 || 6400 < server.DLSpeed {
+		t.Errorf("got unexpected server.DLSpeed '%v', expected between 6200 and 6400", server.DLSpeed)
 	}
 }
 
@@ -38,7 +43,7 @@ func TestDownloadTestContextSavingMode(t *testing.T) {
 
 	err := server.downloadTestContext(
 		context.Background(),
-		true,
+		TestConfig{SavingMode: true},
 		mockWarmUp,
 		mockRequest,
 	)
@@ -59,7 +64,7 @@ func TestUploadTestContext(t *testing.T) {
 
 	err := server.uploadTestContext(
 		context.Background(),
-		false,
+		TestConfig{},
 		mockWarmUp,
 		mockRequest,
 	)
@@ -80,7 +85,7 @@ func TestUploadTestContextSavingMode(t *testing.T) {
 
 	err := server.uploadTestContext(
 		context.Background(),
-		true,
+		TestConfig{SavingMode: true},
 		mockWarmUp,
 		mockRequest,
 	)
@@ -92,13 +97,179 @@ func TestUploadTestContextSavingMode(t *testing.T) {
 	}
 }
 
-func mockWarmUp(ctx context.Context, doer *http.Client, dlURL string) error {
+func TestDownloadTestContextWithConfig(t *testing.T) {
+	latency, _ := time.ParseDuration("5ms")
+	server := Server{
+		URL:     "http://dummy.com/upload.php",
+		Latency: latency,
+	}
+
+	err := server.downloadTestContext(
+		context.Background(),
+		NewTestConfig(WithMaxStreams(4)),
+		mockWarmUp,
+		mockRequest,
+	)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if server.DLSpeed < 770 || 800 < server.DLSpeed {
+		t.Errorf("got unexpected server.DLSpeed '%v', expected between 770 and 800", server.DLSpeed)
+	}
+
+	err = server.downloadTestContext(
+		context.Background(),
+		NewTestConfig(WithMaxStreams(2), WithPayloadSize(2000000), WithDuration(time.Second)),
+		mockWarmUp,
+		mockRequest,
+	)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if server.DLSpeed < 60 || 66 < server.DLSpeed {
+		t.Errorf("got unexpected server.DLSpeed '%v', expected between 60 and 66", server.DLSpeed)
+	}
+	if r := server.Result(); r.DLBytes != 8000000 || r.DLDuration < time.Second {
+		t.Errorf("got unexpected DLBytes '%v' and DLDuration '%v'", r.DLBytes, r.DLDuration)
+	}
+}
+
+func TestDownloadTestContextInterrupted(t *testing.T) {
+	server := Server{URL: "http://dummy.com/upload.php"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err := server.downloadTestContext(
+		ctx,
+		NewTestConfig(WithMaxStreams(2), WithDuration(5*time.Second)),
+		mockWarmUp,
+		mockStreamingRequest,
+	)
+	if !errors.Is(err, ErrTestInterrupted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got unexpected error '%v'", err)
+	}
+	var ie *InterruptedError
+	if !errors.As(err, &ie) || ie.Stage != StageDownload {
+		t.Fatalf("got unexpected error '%#v'", err)
+	}
+	if r := ie.Result; r.DLSpeed <= 0 || r.DLBytes <= 0 || r.DLDuration >= time.Second {
+		t.Errorf("got unexpected DLSpeed '%v', DLBytes '%v' and DLDuration '%v'", r.DLSpeed, r.DLBytes, r.DLDuration)
+	}
+	if server.DLSpeed != ie.Result.DLSpeed {
+		t.Errorf("got unexpected server.DLSpeed '%v', expected '%v'", server.DLSpeed, ie.Result.DLSpeed)
+	}
+}
+
+func TestUploadTestContextInterrupted(t *testing.T) {
+	server := Server{URL: "http://dummy.com/upload.php"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := server.uploadTestContext(ctx, TestConfig{}, mockWarmUp, mockStreamingRequest)
+	var ie *InterruptedError
+	if !errors.As(err, &ie) || ie.Stage != StageUpload || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got unexpected error '%v'", err)
+	}
+	if server.ULSpeed != 0 {
+		t.Errorf("got unexpected server.ULSpeed '%v'", server.ULSpeed)
+	}
+}
+
+func mockWarmUp(ctx context.Context, doer *http.Client, m *meter) error {
 	time.Sleep(100 * time.Millisecond)
 	return nil
 }
 
-func mockRequest(ctx context.Context, doer *http.Client, dlURL string, w int) error {
+func mockRequest(ctx context.Context, doer *http.Client, w int, m *meter) error {
 	fmt.Sprintln(w)
 	time.Sleep(500 * time.Millisecond)
 	return nil
 }
+
+// mockStreamingRequest writes 10KB every 10ms to m until ctx is done.
+func mockStreamingRequest(ctx context.Context, doer *http.Client, w int, m *meter) error {
+	buf := make([]byte, 10000)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			m.Write(buf)
+		}
+	}
+}
+
+func TestLatencyTestContext(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail every fourth request to simulate packet loss.
+		i := atomic.AddInt32(&n, 1)
+		if i%4 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(time.Duration(i%2) * 10 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = server.LatencyTestContext(context.Background(), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.PacketLoss != 25 {
+		t.Errorf("got unexpected server.PacketLoss '%v', expected 25", server.PacketLoss)
+	}
+	if server.MaxLatency < 10*time.Millisecond || server.MinLatency > server.MaxLatency {
+		t.Errorf("got unexpected min/max latency '%v'/'%v'", server.MinLatency, server.MaxLatency)
+	}
+	if server.Jitter <= 0 {
+		t.Errorf("got unexpected server.Jitter '%v'", server.Jitter)
+	}
+	if server.Latency != server.MinLatency/2 {
+		t.Errorf("got unexpected server.Latency '%v', expected half of '%v'", server.Latency, server.MinLatency)
+	}
+
+	ts.Close()
+	if err := server.LatencyTestContext(context.Background(), 2); err == nil {
+		t.Error("expected an error when every round trip is lost")
+	}
+}
+
+func TestShapedServer(t *testing.T) {
+	ts := speedtesttest.NewServer(speedtesttest.Config{DownloadMbps: 40, UploadMbps: 20, Latency: 5 * time.Millisecond})
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.SpeedtestURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewTestConfig(WithDuration(500*time.Millisecond), WithDrain(100*time.Millisecond), WithPingCount(3))
+	if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.UploadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if server.MinLatency < 5*time.Millisecond {
+		t.Errorf("got latency %v below the injected 5ms", server.MinLatency)
+	}
+	if server.DLSpeed < 20 || server.DLSpeed > 44 {
+		t.Errorf("got download speed %v for a 40 Mbit/s link", server.DLSpeed)
+	}
+	// The upload is measured as handed to the socket, so only the server sees it shaped.
+	st := ts.Stats()
+	if server.ULSpeed <= 0 || st.BytesUploaded == 0 || st.BytesUploaded > server.ulBytes {
+		t.Errorf("got upload of %v bytes at %v Mbit/s, server received %v bytes", server.ulBytes, server.ULSpeed, st.BytesUploaded)
+	}
+	if st.Pings < 3 || st.Downloads == 0 || st.Uploads == 0 {
+		t.Errorf("got unexpected server stats %+v", st)
+	}
+}
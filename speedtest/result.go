@@ -0,0 +1,412 @@
+package speedtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Result is a snapshot of the tests run against a server.
+type Result struct {
+	ServerID   string
+	ServerName string
+	Sponsor    string
+	Country    string
+	Host       string
+	URL        string
+	Distance   float64 // km
+
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	Latency    time.Duration
+	MinLatency time.Duration
+	MaxLatency time.Duration
+	Jitter     time.Duration
+	PacketLoss float64 // percentage
+	// LatencyMethod is the method that produced the latency figures.
+	LatencyMethod LatencyMethod
+	// ProxyLatency and FullPathLatency are the fastest round trips to the proxy and through it to the server
+	// of a proxied test.
+	ProxyLatency    time.Duration
+	FullPathLatency time.Duration
+	// RemoteIP is the address the server was tested at and IPVersion its family, 4 or 6.
+	RemoteIP  string
+	IPVersion int
+	// Bufferbloat is set when loaded latency was measured.
+	Bufferbloat *Bufferbloat
+	// Bidirectional is set when the bidirectional test was run.
+	Bidirectional *Bidirectional
+	// UDP is set when the UDP test was run.
+	UDP *UDPThroughput
+	// Timings is set when a test was run over HTTP.
+	Timings *Timings
+	// Soak is set when a soak test was run.
+	Soak *Soak
+	// Path is set when the path to the server was traced.
+	Path *Path
+	// ClientInfo is set when the caller was located for the server list or by a LibreSpeed backend.
+	ClientInfo *ClientInfo
+	// Share is set when the result was submitted.
+	Share *Share
+	// QoE rates the suitability of the connection for streaming, calls and gaming. It is set once the latency
+	// or download test ran.
+	QoE *QoE
+
+	DLSpeed    float64 // Mbit/s
+	ULSpeed    float64 // Mbit/s
+	DLBytes    int64
+	ULBytes    int64
+	DLDuration time.Duration
+	ULDuration time.Duration
+
+	// DLCapReached and ULCapReached report whether rate limited tests reached the cap, see Server.DLCapReached.
+	DLCapReached bool
+	ULCapReached bool
+
+	// DLSpeedStable and ULSpeedStable are smoothed speeds of the main phase, in Mbit/s.
+	DLSpeedStable float64
+	ULSpeedStable float64
+
+	// DLWireSpeed and ULWireSpeed are the estimated link layer rates of DLSpeed and ULSpeed, in Mbit/s.
+	DLWireSpeed float64
+	ULWireSpeed float64
+
+	// DLSamples and ULSamples are the throughput of every 100ms of the main phase in Mbit/s, ramp-up included.
+	DLSamples []float64
+	ULSamples []float64
+
+	// DLStreams and ULStreams describe every stream of the main phase.
+	DLStreams []StreamStats
+	ULStreams []StreamStats
+
+	// LatencyServerID, DLServerID and ULServerID are the IDs of the servers that served each phase,
+	// which differ from ServerID when TestFailover moved to a backup server. Empty for phases not run.
+	LatencyServerID string
+	DLServerID      string
+	ULServerID      string
+}
+
+// Result returns a snapshot of the tests run against the server so far.
+func (s *Server) Result() *Result {
+	r := &Result{
+		ServerID:        s.ID,
+		ServerName:      s.Name,
+		Sponsor:         s.Sponsor,
+		Country:         s.Country,
+		Host:            s.Host,
+		URL:             s.URL,
+		Distance:        s.Distance,
+		StartedAt:       s.startedAt,
+		FinishedAt:      s.finishedAt,
+		Latency:         s.Latency,
+		MinLatency:      s.MinLatency,
+		MaxLatency:      s.MaxLatency,
+		Jitter:          s.Jitter,
+		PacketLoss:      s.PacketLoss,
+		LatencyMethod:   s.LatencyMethod,
+		ProxyLatency:    s.ProxyLatency,
+		FullPathLatency: s.FullPathLatency,
+		RemoteIP:        s.RemoteIP,
+		IPVersion:       s.IPVersion,
+		Bufferbloat:     s.Bufferbloat,
+		Bidirectional:   s.Bidirectional,
+		UDP:             s.UDP,
+		Timings:         s.Timings,
+		Soak:            s.Soak,
+		Path:            s.Path,
+		ClientInfo:      s.ClientInfo,
+		Share:           s.Share,
+		DLSpeed:         s.DLSpeed,
+		ULSpeed:         s.ULSpeed,
+		DLCapReached:    s.DLCapReached,
+		ULCapReached:    s.ULCapReached,
+		DLSpeedStable:   s.DLSpeedStable,
+		ULSpeedStable:   s.ULSpeedStable,
+		DLWireSpeed:     s.DLWireSpeed,
+		ULWireSpeed:     s.ULWireSpeed,
+		DLBytes:         s.dlBytes,
+		ULBytes:         s.ulBytes,
+		DLDuration:      s.dlDuration,
+		ULDuration:      s.ulDuration,
+		DLSamples:       s.dlSamples,
+		ULSamples:       s.ulSamples,
+		DLStreams:       s.dlStreams,
+		ULStreams:       s.ulStreams,
+		LatencyServerID: s.phaseID(s.MinLatency > 0),
+		DLServerID:      s.phaseID(s.dlDuration > 0),
+		ULServerID:      s.phaseID(s.ulDuration > 0),
+	}
+	r.QoE = r.qoe()
+	return r
+}
+
+// phaseID returns the server ID if the phase ran.
+func (s *Server) phaseID(ran bool) string {
+	if !ran {
+		return ""
+	}
+	return s.ID
+}
+
+// resultJSON is the wire format of Result. Durations are expressed in milliseconds.
+type resultJSON struct {
+	ServerID      string         `json:"server_id"`
+	ServerName    string         `json:"server_name"`
+	Sponsor       string         `json:"sponsor"`
+	Country       string         `json:"country"`
+	Host          string         `json:"host"`
+	URL           string         `json:"url"`
+	Distance      float64        `json:"distance_km"`
+	StartedAt     time.Time      `json:"started_at"`
+	FinishedAt    time.Time      `json:"finished_at"`
+	Latency       float64        `json:"latency_ms"`
+	MinLatency    float64        `json:"min_latency_ms"`
+	MaxLatency    float64        `json:"max_latency_ms"`
+	Jitter        float64        `json:"jitter_ms"`
+	PacketLoss    float64        `json:"packet_loss"`
+	LatencyMethod LatencyMethod  `json:"latency_method"`
+	ProxyLatency  float64        `json:"proxy_latency_ms,omitempty"`
+	FullPath      float64        `json:"full_path_latency_ms,omitempty"`
+	RemoteIP      string         `json:"remote_ip,omitempty"`
+	IPVersion     int            `json:"ip_version,omitempty"`
+	Bufferbloat   *Bufferbloat   `json:"bufferbloat,omitempty"`
+	Bidirectional *Bidirectional `json:"bidirectional,omitempty"`
+	UDP           *UDPThroughput `json:"udp,omitempty"`
+	Timings       *Timings       `json:"timings,omitempty"`
+	Soak          *Soak          `json:"soak,omitempty"`
+	Path          *Path          `json:"path,omitempty"`
+	ClientInfo    *ClientInfo    `json:"client_info,omitempty"`
+	Share         *Share         `json:"share,omitempty"`
+	QoE           *QoE           `json:"qoe,omitempty"`
+	DLSpeed       float64        `json:"dl_mbps"`
+	ULSpeed       float64        `json:"ul_mbps"`
+	DLCapReached  bool           `json:"dl_cap_reached,omitempty"`
+	ULCapReached  bool           `json:"ul_cap_reached,omitempty"`
+	DLStable      float64        `json:"dl_stable_mbps"`
+	ULStable      float64        `json:"ul_stable_mbps"`
+	DLWire        float64        `json:"dl_wire_mbps"`
+	ULWire        float64        `json:"ul_wire_mbps"`
+	DLBytes       int64          `json:"dl_bytes"`
+	ULBytes       int64          `json:"ul_bytes"`
+	DLDurationMs  float64        `json:"dl_duration_ms"`
+	ULDurationMs  float64        `json:"ul_duration_ms"`
+	DLSamples     []float64      `json:"dl_samples_mbps,omitempty"`
+	ULSamples     []float64      `json:"ul_samples_mbps,omitempty"`
+	DLStreams     []streamJSON   `json:"dl_streams,omitempty"`
+	ULStreams     []streamJSON   `json:"ul_streams,omitempty"`
+	LatencyServer string         `json:"latency_server_id,omitempty"`
+	DLServer      string         `json:"dl_server_id,omitempty"`
+	ULServer      string         `json:"ul_server_id,omitempty"`
+}
+
+// MarshalJSON encodes the result with durations in milliseconds.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(resultJSON{
+		ServerID:      r.ServerID,
+		ServerName:    r.ServerName,
+		Sponsor:       r.Sponsor,
+		Country:       r.Country,
+		Host:          r.Host,
+		URL:           r.URL,
+		Distance:      r.Distance,
+		StartedAt:     r.StartedAt,
+		FinishedAt:    r.FinishedAt,
+		Latency:       milliseconds(r.Latency),
+		MinLatency:    milliseconds(r.MinLatency),
+		MaxLatency:    milliseconds(r.MaxLatency),
+		Jitter:        milliseconds(r.Jitter),
+		PacketLoss:    r.PacketLoss,
+		LatencyMethod: r.LatencyMethod,
+		ProxyLatency:  milliseconds(r.ProxyLatency),
+		FullPath:      milliseconds(r.FullPathLatency),
+		RemoteIP:      r.RemoteIP,
+		IPVersion:     r.IPVersion,
+		Bufferbloat:   r.Bufferbloat,
+		Bidirectional: r.Bidirectional,
+		UDP:           r.UDP,
+		Timings:       r.Timings,
+		Soak:          r.Soak,
+		Path:          r.Path,
+		ClientInfo:    r.ClientInfo,
+		Share:         r.Share,
+		QoE:           r.QoE,
+		DLSpeed:       r.DLSpeed,
+		ULSpeed:       r.ULSpeed,
+		DLCapReached:  r.DLCapReached,
+		ULCapReached:  r.ULCapReached,
+		DLStable:      r.DLSpeedStable,
+		ULStable:      r.ULSpeedStable,
+		DLWire:        r.DLWireSpeed,
+		ULWire:        r.ULWireSpeed,
+		DLBytes:       r.DLBytes,
+		ULBytes:       r.ULBytes,
+		DLDurationMs:  milliseconds(r.DLDuration),
+		ULDurationMs:  milliseconds(r.ULDuration),
+		DLSamples:     r.DLSamples,
+		ULSamples:     r.ULSamples,
+		DLStreams:     toStreamJSON(r.DLStreams),
+		ULStreams:     toStreamJSON(r.ULStreams),
+		LatencyServer: r.LatencyServerID,
+		DLServer:      r.DLServerID,
+		ULServer:      r.ULServerID,
+	})
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var v resultJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*r = Result{
+		ServerID:        v.ServerID,
+		ServerName:      v.ServerName,
+		Sponsor:         v.Sponsor,
+		Country:         v.Country,
+		Host:            v.Host,
+		URL:             v.URL,
+		Distance:        v.Distance,
+		StartedAt:       v.StartedAt,
+		FinishedAt:      v.FinishedAt,
+		Latency:         fromMilliseconds(v.Latency),
+		MinLatency:      fromMilliseconds(v.MinLatency),
+		MaxLatency:      fromMilliseconds(v.MaxLatency),
+		Jitter:          fromMilliseconds(v.Jitter),
+		PacketLoss:      v.PacketLoss,
+		LatencyMethod:   v.LatencyMethod,
+		ProxyLatency:    fromMilliseconds(v.ProxyLatency),
+		FullPathLatency: fromMilliseconds(v.FullPath),
+		RemoteIP:        v.RemoteIP,
+		IPVersion:       v.IPVersion,
+		Bufferbloat:     v.Bufferbloat,
+		Bidirectional:   v.Bidirectional,
+		UDP:             v.UDP,
+		Timings:         v.Timings,
+		Soak:            v.Soak,
+		Path:            v.Path,
+		ClientInfo:      v.ClientInfo,
+		Share:           v.Share,
+		QoE:             v.QoE,
+		DLSpeed:         v.DLSpeed,
+		ULSpeed:         v.ULSpeed,
+		DLCapReached:    v.DLCapReached,
+		ULCapReached:    v.ULCapReached,
+		DLSpeedStable:   v.DLStable,
+		ULSpeedStable:   v.ULStable,
+		DLWireSpeed:     v.DLWire,
+		ULWireSpeed:     v.ULWire,
+		DLBytes:         v.DLBytes,
+		ULBytes:         v.ULBytes,
+		DLDuration:      fromMilliseconds(v.DLDurationMs),
+		ULDuration:      fromMilliseconds(v.ULDurationMs),
+		DLSamples:       v.DLSamples,
+		ULSamples:       v.ULSamples,
+		DLStreams:       fromStreamJSON(v.DLStreams),
+		ULStreams:       fromStreamJSON(v.ULStreams),
+		LatencyServerID: v.LatencyServer,
+		DLServerID:      v.DLServer,
+		ULServerID:      v.ULServer,
+	}
+	return nil
+}
+
+// streamJSON is the wire format of StreamStats.
+type streamJSON struct {
+	Requests    int     `json:"requests"`
+	Bytes       int64   `json:"bytes"`
+	DurationMs  float64 `json:"duration_ms"`
+	StatusCode  int     `json:"status_code,omitempty"`
+	ReusedConns int     `json:"reused_conns"`
+	RemoteIP    string  `json:"remote_ip,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+func toStreamJSON(streams []StreamStats) []streamJSON {
+	if streams == nil {
+		return nil
+	}
+	v := make([]streamJSON, len(streams))
+	for i, st := range streams {
+		v[i] = streamJSON{st.Requests, st.Bytes, milliseconds(st.Duration), st.StatusCode, st.ReusedConns, st.RemoteIP, st.Error}
+	}
+	return v
+}
+
+func fromStreamJSON(v []streamJSON) []StreamStats {
+	if v == nil {
+		return nil
+	}
+	streams := make([]StreamStats, len(v))
+	for i, st := range v {
+		streams[i] = StreamStats{st.Requests, st.Bytes, fromMilliseconds(st.DurationMs), st.StatusCode, st.ReusedConns, st.RemoteIP, st.Error}
+	}
+	return streams
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func fromMilliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+var csvHeader = []string{
+	"server_id", "server_name", "sponsor", "country", "host", "url", "distance_km",
+	"started_at", "finished_at",
+	"latency_ms", "min_latency_ms", "max_latency_ms", "jitter_ms", "packet_loss", "latency_method",
+	"dl_mbps", "ul_mbps", "dl_bytes", "ul_bytes", "dl_duration_ms", "ul_duration_ms",
+	"dl_cap_reached", "ul_cap_reached",
+	"bufferbloat_grade",
+}
+
+// CSVRecord returns the result as a CSV record with the columns of CSVEncoder's header.
+func (r *Result) CSVRecord() []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return []string{
+		r.ServerID, r.ServerName, r.Sponsor, r.Country, r.Host, r.URL, f(r.Distance),
+		r.StartedAt.Format(time.RFC3339Nano), r.FinishedAt.Format(time.RFC3339Nano),
+		f(milliseconds(r.Latency)), f(milliseconds(r.MinLatency)), f(milliseconds(r.MaxLatency)), f(milliseconds(r.Jitter)), f(r.PacketLoss), r.LatencyMethod.String(),
+		f(r.DLSpeed), f(r.ULSpeed), strconv.FormatInt(r.DLBytes, 10), strconv.FormatInt(r.ULBytes, 10),
+		f(milliseconds(r.DLDuration)), f(milliseconds(r.ULDuration)),
+		strconv.FormatBool(r.DLCapReached), strconv.FormatBool(r.ULCapReached),
+		bufferbloatGrade(r.Bufferbloat),
+	}
+}
+
+func bufferbloatGrade(b *Bufferbloat) string {
+	if b == nil {
+		return ""
+	}
+	return b.Grade
+}
+
+// CSVEncoder writes Results as CSV, emitting a header row before the first result.
+type CSVEncoder struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+// NewCSVEncoder returns an encoder that writes to w.
+func NewCSVEncoder(w io.Writer) *CSVEncoder {
+	return &CSVEncoder{w: csv.NewWriter(w)}
+}
+
+// Encode writes r as a CSV row.
+func (e *CSVEncoder) Encode(r *Result) error {
+	if !e.wroteHeader {
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+		e.wroteHeader = true
+	}
+	if err := e.w.Write(r.CSVRecord()); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
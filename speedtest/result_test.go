@@ -0,0 +1,80 @@
+package speedtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultJSON(t *testing.T) {
+	server := &Server{
+		ID:              "6691",
+		Name:            "Shizuoka",
+		Country:         "Japan",
+		Sponsor:         "sudosan",
+		Distance:        9.03,
+		Latency:         20 * time.Millisecond,
+		MinLatency:      40 * time.Millisecond,
+		Jitter:          1500 * time.Microsecond,
+		ProxyLatency:    12 * time.Millisecond,
+		FullPathLatency: 40 * time.Millisecond,
+		Path: &Path{Method: TraceUDP, Destination: "192.0.2.1", Reached: true, MTU: 1500,
+			Hops: []Hop{{TTL: 1, IP: "192.0.2.1", RTTs: []time.Duration{time.Millisecond}}}},
+		Bufferbloat:   &Bufferbloat{Idle: LatencyPercentiles{P50: 20 * time.Millisecond, P90: 25 * time.Millisecond, P99: 30 * time.Millisecond, Samples: 3}, Grade: "A"},
+		Bidirectional: &Bidirectional{DLSpeed: 60, ULSpeed: 30, Sum: 90, Duration: 10 * time.Second},
+		UDP:           &UDPThroughput{Download: UDPStats{TargetSpeed: 10, Speed: 9.5, Jitter: 2 * time.Millisecond}},
+		Timings:       &Timings{Download: PhaseTiming{DNS: 3 * time.Millisecond, TTFB: 45 * time.Millisecond, Requests: 4}},
+		Soak:          &Soak{Download: &SoakStats{Checkpoints: []Checkpoint{{Elapsed: time.Minute, Bytes: 1000}}}},
+		DLSpeed:       73.3,
+		ULSpeed:       35.26,
+		dlBytes:       100000000,
+		dlDuration:    10 * time.Second,
+		dlSamples:     []float64{70.5, 73.3},
+		dlStreams:     []StreamStats{{Requests: 4, Bytes: 100000000, Duration: 10 * time.Second, StatusCode: 200, ReusedConns: 3}},
+		startedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	b, err := json.Marshal(server.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"server_id":"6691"`, `"latency_ms":20`, `"jitter_ms":1.5`, `"dl_mbps":73.3`, `"dl_duration_ms":10000`, `"reused_conns":3`, `"proxy_latency_ms":12`, `"method":"udp"`,
+		`"rtts_ms":[1]`, `"p50_ms":20`, `"duration_ms":10000,"latency"`, `"jitter_ms":2}`, `"ttfb_ms":45`, `"elapsed_ms":60000`} {
+		if !bytes.Contains(b, []byte(field)) {
+			t.Errorf("expected %s in %s", field, b)
+		}
+	}
+
+	var decoded Result
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, *server.Result()) {
+		t.Errorf("got: %+v, expected: %+v", decoded, *server.Result())
+	}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewCSVEncoder(&buf)
+
+	for _, id := range []string{"1", "2"} {
+		if err := enc.Encode((&Server{ID: id, Name: "Tokyo, Japan", DLSpeed: 10.5}).Result()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %v lines, expected 3: %q", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "server_id,server_name,") {
+		t.Errorf("got unexpected header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[2], `2,"Tokyo, Japan",`) || !strings.Contains(lines[2], ",10.5,") {
+		t.Errorf("got unexpected record %q", lines[2])
+	}
+}
@@ -0,0 +1,133 @@
+package speedtest
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// sampleWindow is the interval over which throughput samples are taken.
+	sampleWindow = 100 * time.Millisecond
+	// rampUpFraction is the leading fraction of the samples discarded as ramp-up.
+	rampUpFraction = 0.25
+	// minStableSamples is the number of samples past ramp-up needed to compute the speed from samples.
+	minStableSamples = 3
+	// trimFraction is the fraction of the stable samples dropped from each end by EstimatorTrimmedMean.
+	trimFraction = 0.1
+	// smoothingFactor is the weight of the latest sample in the moving average of smoothThroughput.
+	smoothingFactor = 0.2
+)
+
+// SpeedEstimator selects how the speed is computed from the throughput samples of the main phase.
+type SpeedEstimator int
+
+const (
+	// EstimatorMean averages the stable samples, which equals the bytes moved over the stable period.
+	EstimatorMean SpeedEstimator = iota
+	// EstimatorTrimmedMean averages the stable samples after dropping the highest and lowest tenth.
+	EstimatorTrimmedMean
+	// EstimatorMedian takes the median of the stable samples.
+	EstimatorMedian
+)
+
+// sampleThroughput records the throughput counted by m in Mbit/s over every sampleWindow until
+// the returned function is called, which returns the samples. A trailing partial window is not sampled.
+func sampleThroughput(m *meter) func() []float64 {
+	sampler := newThroughputSampler(m, time.Now())
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(sampleWindow)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				sampler.sample(now)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() []float64 {
+		close(done)
+		<-finished
+		return sampler.samples
+	}
+}
+
+// throughputSampler computes the throughput counted by a meter between the times it is sampled at.
+type throughputSampler struct {
+	m        *meter
+	last     uint64
+	lastTime time.Time
+	samples  []float64
+}
+
+// newThroughputSampler returns a sampler of m whose first window starts at start.
+func newThroughputSampler(m *meter, start time.Time) *throughputSampler {
+	return &throughputSampler{m: m, last: m.total(), lastTime: start}
+}
+
+// sample records the throughput of the window ending at now.
+func (s *throughputSampler) sample(now time.Time) {
+	total := s.m.total()
+	s.samples = append(s.samples, mbps(total-s.last, now.Sub(s.lastTime)))
+	s.last, s.lastTime = total, now
+}
+
+// estimateThroughput computes the speed in Mbit/s from samples after discarding the ramp-up.
+// It reports false if there are too few stable samples or nothing was counted,
+// in which case the speed is computed from the total bytes and duration instead.
+func estimateThroughput(samples []float64, estimator SpeedEstimator) (float64, bool) {
+	stable := append([]float64(nil), samples[int(float64(len(samples))*rampUpFraction):]...)
+	if len(stable) < minStableSamples {
+		return 0, false
+	}
+	sort.Float64s(stable)
+	if stable[len(stable)-1] == 0 {
+		return 0, false
+	}
+
+	switch estimator {
+	case EstimatorMedian:
+		n := len(stable)
+		if n%2 == 1 {
+			return stable[n/2], true
+		}
+		return (stable[n/2-1] + stable[n/2]) / 2, true
+	case EstimatorTrimmedMean:
+		trim := int(float64(len(stable)) * trimFraction)
+		stable = stable[trim : len(stable)-trim]
+	}
+
+	var sum float64
+	for _, v := range stable {
+		sum += v
+	}
+	return sum / float64(len(stable)), true
+}
+
+// smoothThroughput computes the exponentially weighted moving average of the samples past ramp-up in Mbit/s,
+// a stable speed that follows the end of the main phase more closely than estimateThroughput.
+// It reports false under the same conditions as estimateThroughput.
+func smoothThroughput(samples []float64) (float64, bool) {
+	stable := samples[int(float64(len(samples))*rampUpFraction):]
+	if len(stable) < minStableSamples {
+		return 0, false
+	}
+	avg := stable[0]
+	var max float64
+	for _, v := range stable {
+		avg += smoothingFactor * (v - avg)
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		return 0, false
+	}
+	return avg, true
+}
@@ -0,0 +1,89 @@
+package speedtest
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEstimateThroughput(t *testing.T) {
+	// The first quarter is ramp-up; one stable sample is an outlier.
+	samples := []float64{1, 5, 50, 90, 95}
+	for i := 0; i < 14; i++ {
+		samples = append(samples, 100)
+	}
+	samples = append(samples, 500)
+
+	for _, tc := range []struct {
+		estimator SpeedEstimator
+		expected  float64
+	}{
+		{estimator: EstimatorMean, expected: 1900.0 / 15},
+		{estimator: EstimatorTrimmedMean, expected: 100},
+		{estimator: EstimatorMedian, expected: 100},
+	} {
+		speed, ok := estimateThroughput(samples, tc.estimator)
+		if !ok || speed != tc.expected {
+			t.Errorf("got %v, %v for estimator %v, expected %v", speed, ok, tc.estimator, tc.expected)
+		}
+	}
+
+	if _, ok := estimateThroughput([]float64{100, 100}, EstimatorMean); ok {
+		t.Error("expected too few stable samples")
+	}
+	if _, ok := estimateThroughput(make([]float64, 10), EstimatorMean); ok {
+		t.Error("expected no estimate without throughput")
+	}
+}
+
+func TestSmoothThroughput(t *testing.T) {
+	// The ramp-up is discarded and the average follows the rise of the stable samples.
+	samples := []float64{0, 100, 100, 100, 100, 200, 200, 200}
+	speed, ok := smoothThroughput(samples)
+	if !ok || speed <= 100 || speed >= 200 {
+		t.Errorf("got %v, %v", speed, ok)
+	}
+	if speed, ok := smoothThroughput([]float64{0, 50, 50, 50, 50}); !ok || speed != 50 {
+		t.Errorf("got %v, %v for a constant throughput", speed, ok)
+	}
+
+	if _, ok := smoothThroughput([]float64{100, 100}); ok {
+		t.Error("expected too few stable samples")
+	}
+	if _, ok := smoothThroughput(make([]float64, 10)); ok {
+		t.Error("expected no estimate without throughput")
+	}
+}
+
+func TestSampleThroughput(t *testing.T) {
+	m := &meter{}
+	start := time.Now()
+	sampler := newThroughputSampler(m, start)
+	for i := 1; i <= 5; i++ {
+		// 1 Mbit in every window but the third, which gets 2.
+		m.Write(make([]byte, 125000))
+		if i == 3 {
+			m.Write(make([]byte, 125000))
+		}
+		sampler.sample(start.Add(time.Duration(i) * sampleWindow))
+	}
+
+	expected := []float64{10, 10, 20, 10, 10}
+	if len(sampler.samples) != len(expected) {
+		t.Fatalf("got %v samples, expected %v", sampler.samples, expected)
+	}
+	for i, v := range sampler.samples {
+		if math.Abs(v-expected[i]) > 1e-9 {
+			t.Errorf("got samples %v, expected %v", sampler.samples, expected)
+			break
+		}
+	}
+
+	// The sampler runs on its own for whole windows only.
+	stop := sampleThroughput(m)
+	m.Write(make([]byte, 125000))
+	time.Sleep(sampleWindow / 2)
+	if samples := stop(); len(samples) != 0 {
+		t.Errorf("got samples %v of a partial window", samples)
+	}
+}
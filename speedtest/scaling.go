@@ -0,0 +1,159 @@
+package speedtest
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	adaptiveInitialStreams = 4
+	adaptiveMaxStreams     = 64
+	adaptiveWindow         = 500 * time.Millisecond
+	// adaptiveGain is the throughput increase added streams must bring to be kept.
+	adaptiveGain = 1.25
+	// defaultAdaptiveDuration is the main phase duration of adaptive tests without a Duration.
+	defaultAdaptiveDuration = 10 * time.Second
+)
+
+// StreamScaling selects how the number of concurrent streams of the main phase is chosen.
+type StreamScaling int
+
+const (
+	// ScalingAuto scales streams adaptively for tests with a Duration and uses the legacy ladder otherwise.
+	ScalingAuto StreamScaling = iota
+	// ScalingLegacy picks a fixed number of streams from the warm-up speed,
+	// 4, 8, 16 or 32 for downloads faster than 2.5, 4, 10 or 50 Mbit/s.
+	ScalingLegacy
+	// ScalingAdaptive starts with a few streams and keeps doubling them while throughput rises,
+	// removing the last streams added when they do not bring more throughput.
+	ScalingAdaptive
+)
+
+// adaptive reports whether the main phase scales streams adaptively.
+func (cfg TestConfig) adaptive() bool {
+	switch cfg.StreamScaling {
+	case ScalingAdaptive:
+		return true
+	case ScalingLegacy:
+		return false
+	default:
+		return cfg.Duration > 0
+	}
+}
+
+// runStreams runs the main phase with the streams chosen by cfg. workload is the number of streams of the legacy ladder.
+func (cfg TestConfig) runStreams(ctx context.Context, workload int, set *streamSet, request func(context.Context, *meter) error) (int64, time.Duration, error) {
+	adaptive := cfg.adaptive()
+	duration := cfg.Duration
+	if adaptive && duration <= 0 {
+		duration = defaultAdaptiveDuration
+	}
+	run := func(ctx context.Context, duration time.Duration) (int64, time.Duration, error) {
+		if !adaptive {
+			return runStreams(ctx, workload, duration, set, request)
+		}
+		maxStreams := cfg.MaxStreams
+		if maxStreams <= 0 {
+			maxStreams = adaptiveMaxStreams
+		}
+		return runAdaptiveStreams(ctx, maxStreams, duration, set, request)
+	}
+	if cfg.Drain {
+		return runDrained(ctx, duration, cfg.drainGrace(), set, run)
+	}
+	return run(ctx, duration)
+}
+
+// runAdaptiveStreams runs request on a varying number of streams until duration has elapsed and returns
+// how many requests completed and how long it took. Every adaptiveWindow the throughput counted by the meter of set is compared
+// with the previous window: streams are doubled while throughput rises by adaptiveGain, and the streams last added
+// are stopped once they no longer do, after which the number of streams is held. Counts are returned along with the first error of a request.
+func runAdaptiveStreams(ctx context.Context, maxStreams int, duration time.Duration, set *streamSet, request func(context.Context, *meter) error) (int64, time.Duration, error) {
+	m := set.m
+	var requests int64
+	eg, gctx := errgroup.WithContext(ctx)
+	sTime := time.Now()
+
+	var stops []chan struct{}
+	start := func(n int) {
+		for i := 0; i < n; i++ {
+			stop := make(chan struct{})
+			stops = append(stops, stop)
+			st := set.add()
+			eg.Go(func() error {
+				for {
+					select {
+					case <-stop:
+						return nil
+					default:
+					}
+					if err := st.do(gctx, request); err != nil {
+						return err
+					}
+					atomic.AddInt64(&requests, 1)
+
+					if time.Since(sTime) >= duration || gctx.Err() != nil {
+						return nil
+					}
+				}
+			})
+		}
+	}
+	// Stopped streams finish their current request, which still counts.
+	shrink := func(n int) {
+		for i := 0; i < n; i++ {
+			close(stops[len(stops)-1])
+			stops = stops[:len(stops)-1]
+		}
+	}
+
+	streams := adaptiveInitialStreams
+	if streams > maxStreams {
+		streams = maxStreams
+	}
+	start(streams)
+
+	ticker := time.NewTicker(adaptiveWindow)
+	defer ticker.Stop()
+	last, lastTime := m.total(), sTime
+	prev, added, hold := 0.0, 0, false
+control:
+	for {
+		select {
+		case <-gctx.Done():
+			break control
+		case now := <-ticker.C:
+			if now.Sub(sTime) >= duration {
+				break control
+			}
+			total := m.total()
+			rate := float64(total-last) / now.Sub(lastTime).Seconds()
+			last, lastTime = total, now
+
+			if hold {
+				continue
+			}
+			if added > 0 && rate <= prev*adaptiveGain {
+				shrink(added)
+				hold = true
+				continue
+			}
+			added = len(stops)
+			if len(stops)+added > maxStreams {
+				added = maxStreams - len(stops)
+			}
+			if added <= 0 {
+				hold = true
+				continue
+			}
+			start(added)
+			prev = rate
+		}
+	}
+
+	err := eg.Wait()
+	return requests, time.Since(sTime), err
+}
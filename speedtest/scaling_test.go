@@ -0,0 +1,61 @@
+package speedtest
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTestConfigAdaptive(t *testing.T) {
+	for _, tc := range []struct {
+		cfg      TestConfig
+		expected bool
+	}{
+		{cfg: TestConfig{}, expected: false},
+		{cfg: NewTestConfig(WithDuration(time.Second)), expected: true},
+		{cfg: NewTestConfig(WithDuration(time.Second), WithStreamScaling(ScalingLegacy)), expected: false},
+		{cfg: NewTestConfig(WithStreamScaling(ScalingAdaptive)), expected: true},
+	} {
+		if tc.cfg.adaptive() != tc.expected {
+			t.Errorf("got adaptive %v for %+v, expected %v", !tc.expected, tc.cfg, tc.expected)
+		}
+	}
+}
+
+func TestRunAdaptiveStreams(t *testing.T) {
+	// Every stream moves 10 Mbit/s on a link of 80 Mbit/s, so throughput stops rising above 8 streams.
+	ctx := context.Background()
+	m := &meter{limit: newTokenBucket(ctx, 80)}
+	sTime := time.Now()
+	var active, settled int64
+	request := func(_ context.Context, m *meter) error {
+		n := atomic.AddInt64(&active, 1)
+		defer atomic.AddInt64(&active, -1)
+		if time.Since(sTime) > 2*time.Second && n > atomic.LoadInt64(&settled) {
+			atomic.StoreInt64(&settled, n)
+		}
+		time.Sleep(100 * time.Millisecond)
+		m.Write(make([]byte, 125000))
+		return nil
+	}
+
+	set := newStreamSet(m)
+	requests, elapsed, err := runAdaptiveStreams(ctx, 64, 2500*time.Millisecond, set, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests == 0 || elapsed < 2500*time.Millisecond {
+		t.Errorf("got unexpected requests %v and elapsed %v", requests, elapsed)
+	}
+	if settled != 8 {
+		t.Errorf("got %v streams after settling, expected 8", settled)
+	}
+	var bytes int64
+	for _, st := range set.stats() {
+		bytes += st.Bytes
+	}
+	if bytes != int64(m.total()) {
+		t.Errorf("got %v bytes over all streams, expected %v", bytes, m.total())
+	}
+}
@@ -0,0 +1,59 @@
+package speedtest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2021, 1, 1, 10, 7, 30, 0, time.UTC) // a Friday
+
+	for _, tc := range []struct {
+		spec     string
+		expected time.Time
+	}{
+		{spec: "* * * * *", expected: time.Date(2021, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", expected: time.Date(2021, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{spec: "0 3 * * *", expected: time.Date(2021, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{spec: "30 9-17/4 * * 1-5", expected: time.Date(2021, 1, 1, 13, 30, 0, 0, time.UTC)},
+		{spec: "0 0 * * 0", expected: time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 15 * 0", expected: time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 1 3,6 *", expected: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		s, err := ParseCron(tc.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := s.Next(from); !next.Equal(tc.expected) {
+			t.Errorf("got %v for %q, expected %v", next, tc.spec, tc.expected)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+
+	s, _ := ParseCron("0 0 31 2 *")
+	if next := s.Next(from); !next.IsZero() {
+		t.Errorf("got %v for a date that never occurs", next)
+	}
+}
+
+func TestEvery(t *testing.T) {
+	from := time.Date(2021, 1, 1, 10, 7, 30, 0, time.UTC)
+	s, err := Every(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(from); !next.Equal(from.Add(time.Hour)) {
+		t.Errorf("got unexpected next run %v", next)
+	}
+
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		if _, err := Every(interval); err == nil {
+			t.Errorf("expected an error for interval %v", interval)
+		}
+	}
+}
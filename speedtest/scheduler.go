@@ -0,0 +1,202 @@
+package speedtest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultHistory = 100
+
+// ResultStore persists the results of a Scheduler, so that its history survives restarts.
+type ResultStore interface {
+	// Save stores a result.
+	Save(r *Result) error
+	// Load returns up to n of the most recent results, oldest first.
+	Load(n int) ([]*Result, error)
+}
+
+// Threshold describes unacceptable results. Zero fields are not checked.
+type Threshold struct {
+	MinDLSpeed    float64       // Mbit/s
+	MinULSpeed    float64       // Mbit/s
+	MaxLatency    time.Duration // fastest round trip
+	MaxPacketLoss float64       // percentage
+}
+
+// Breached reports whether r violates the threshold.
+func (th Threshold) Breached(r *Result) bool {
+	return th.MinDLSpeed > 0 && r.DLSpeed < th.MinDLSpeed ||
+		th.MinULSpeed > 0 && r.ULSpeed < th.MinULSpeed ||
+		th.MaxLatency > 0 && r.MinLatency > th.MaxLatency ||
+		th.MaxPacketLoss > 0 && r.PacketLoss > th.MaxPacketLoss
+}
+
+type thresholdHook struct {
+	threshold Threshold
+	fn        func(*Result, Threshold)
+}
+
+// Scheduler runs tests against a set of servers on a Schedule and keeps the latest results in memory.
+// Each run tests the cfg.ServerCount lowest latency servers, as TestMultiple does.
+type Scheduler struct {
+	schedule Schedule
+	servers  Servers
+	cfg      TestConfig
+	history  int
+	store    ResultStore
+
+	onComplete  []func(*Result)
+	onError     []func(error)
+	onThreshold []thresholdHook
+
+	mu      sync.Mutex
+	results []*Result
+}
+
+// SchedulerOption is a function that can be passed to NewScheduler to modify the Scheduler.
+type SchedulerOption func(*Scheduler)
+
+// WithSchedulerConfig sets the configuration of the tests.
+func WithSchedulerConfig(cfg TestConfig) SchedulerOption {
+	return func(s *Scheduler) {
+		s.cfg = cfg
+	}
+}
+
+// WithHistory sets the number of results kept in memory. It defaults to 100, as does an n that is not positive.
+func WithHistory(n int) SchedulerOption {
+	return func(s *Scheduler) {
+		if n <= 0 {
+			n = defaultHistory
+		}
+		s.history = n
+	}
+}
+
+// WithResultStore persists results to store and restores the history from it when the scheduler starts.
+func WithResultStore(store ResultStore) SchedulerOption {
+	return func(s *Scheduler) {
+		s.store = store
+	}
+}
+
+// OnComplete registers fn to be called with every result.
+func OnComplete(fn func(*Result)) SchedulerOption {
+	return func(s *Scheduler) {
+		s.onComplete = append(s.onComplete, fn)
+	}
+}
+
+// OnError registers fn to be called when a run fails, or a result cannot be stored.
+func OnError(fn func(error)) SchedulerOption {
+	return func(s *Scheduler) {
+		s.onError = append(s.onError, fn)
+	}
+}
+
+// OnThreshold registers fn to be called with every result breaching threshold.
+func OnThreshold(threshold Threshold, fn func(*Result, Threshold)) SchedulerOption {
+	return func(s *Scheduler) {
+		s.onThreshold = append(s.onThreshold, thresholdHook{threshold: threshold, fn: fn})
+	}
+}
+
+// NewScheduler creates a Scheduler testing servers on schedule.
+func NewScheduler(schedule Schedule, servers Servers, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		schedule: schedule,
+		servers:  servers,
+		history:  defaultHistory,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Run restores the history from the result store, if any, then runs the tests at every scheduled time until ctx is done.
+// Failed runs are reported to the OnError hooks and do not stop the scheduler. It returns ctx.Err().
+func (s *Scheduler) Run(ctx context.Context) error {
+	if s.store != nil {
+		results, err := s.store.Load(s.history)
+		if err != nil {
+			s.reportError(err)
+		}
+		s.mu.Lock()
+		s.results = results
+		s.mu.Unlock()
+	}
+
+	for {
+		next := s.schedule.Next(time.Now())
+		if next.IsZero() {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		if err := s.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			s.reportError(err)
+		}
+	}
+}
+
+// RunOnce runs the tests immediately, records the results and calls the hooks.
+// The results of the servers that completed are recorded even if others failed, whose error is returned.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	mr, err := s.servers.TestMultiple(ctx, s.cfg)
+	if mr == nil {
+		return err
+	}
+
+	for _, r := range mr.Results {
+		s.record(r)
+		if s.store != nil {
+			if err := s.store.Save(r); err != nil {
+				s.reportError(err)
+			}
+		}
+
+		for _, fn := range s.onComplete {
+			fn(r)
+		}
+		for _, h := range s.onThreshold {
+			if h.threshold.Breached(r) {
+				h.fn(r, h.threshold)
+			}
+		}
+	}
+	return err
+}
+
+// History returns the recorded results, oldest first.
+func (s *Scheduler) History() []*Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Result(nil), s.results...)
+}
+
+func (s *Scheduler) record(r *Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, r)
+	if len(s.results) > s.history {
+		s.results = append([]*Result(nil), s.results[len(s.results)-s.history:]...)
+	}
+}
+
+func (s *Scheduler) reportError(err error) {
+	for _, fn := range s.onError {
+		fn(err)
+	}
+}
@@ -0,0 +1,104 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	results []*Result
+}
+
+func (m *memoryStore) Save(r *Result) error {
+	m.results = append(m.results, r)
+	return nil
+}
+
+func (m *memoryStore) Load(n int) ([]*Result, error) {
+	if len(m.results) > n {
+		return m.results[len(m.results)-n:], nil
+	}
+	return m.results, nil
+}
+
+func TestThresholdBreached(t *testing.T) {
+	r := &Result{DLSpeed: 50, ULSpeed: 10, MinLatency: 20 * time.Millisecond, PacketLoss: 0}
+	for _, tc := range []struct {
+		threshold Threshold
+		expected  bool
+	}{
+		{threshold: Threshold{}, expected: false},
+		{threshold: Threshold{MinDLSpeed: 100}, expected: true},
+		{threshold: Threshold{MinDLSpeed: 10, MinULSpeed: 5}, expected: false},
+		{threshold: Threshold{MaxLatency: 10 * time.Millisecond}, expected: true},
+		{threshold: Threshold{MaxPacketLoss: 1}, expected: false},
+	} {
+		if got := tc.threshold.Breached(r); got != tc.expected {
+			t.Errorf("got %v for %+v, expected %v", got, tc.threshold, tc.expected)
+		}
+	}
+}
+
+func TestWithHistory(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		s := NewScheduler(nil, nil, WithHistory(n))
+		if s.history != defaultHistory {
+			t.Errorf("got history %v for %v, expected the default", s.history, n)
+		}
+		s.record(&Result{})
+		if len(s.History()) != 1 {
+			t.Errorf("got history %v for %v", s.History(), n)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	ts := newLibrespeedTestServer(false)
+	defer ts.Close()
+	server, err := New().CustomServer(ts.URL + "/backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Type = LibrespeedServer
+
+	store := &memoryStore{results: []*Result{{ServerID: "old"}}}
+	var completed, breached int
+	var errs []error
+	ctx, cancel := context.WithCancel(context.Background())
+	every, err := Every(50 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewScheduler(every, Servers{server},
+		WithSchedulerConfig(NewTestConfig(WithSavingMode(true), WithPingCount(2))),
+		WithHistory(2),
+		WithResultStore(store),
+		OnComplete(func(*Result) {
+			if completed++; completed == 3 {
+				cancel()
+			}
+		}),
+		OnThreshold(Threshold{MinDLSpeed: 1e9}, func(*Result, Threshold) { breached++ }),
+		OnError(func(err error) { errs = append(errs, err) }),
+	)
+
+	if err := s.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("got unexpected error %v", err)
+	}
+
+	history := s.History()
+	if len(history) != 2 || history[1].URL != server.URL {
+		t.Fatalf("got unexpected history %v", history)
+	}
+	if !history[1].StartedAt.After(history[0].StartedAt) {
+		t.Errorf("got runs started at %v and %v, expected each run to record its own start", history[0].StartedAt, history[1].StartedAt)
+	}
+	if len(store.results) != 4 {
+		t.Errorf("got %v stored results, expected 4", len(store.results))
+	}
+	if completed != 3 || breached != completed || len(errs) != 0 {
+		t.Errorf("got %v completed, %v breached and errors %v", completed, breached, errs)
+	}
+}
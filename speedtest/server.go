@@ -1,13 +1,17 @@
 package speedtest
 
 import (
+	"container/heap"
 	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"time"
@@ -23,6 +27,24 @@ const (
 	XMLPayload
 )
 
+// ServerType selects the protocol used to test against a server. Types are added with RegisterServerProtocol.
+type ServerType int
+
+const (
+	// StandardServer is a speedtest.net server tested over the legacy HTTP endpoints (random*.jpg, upload.php, latency.txt).
+	StandardServer ServerType = iota
+	// OoklaSocketServer is a speedtest.net server tested over the TCP protocol (HI/PING/DOWNLOAD/UPLOAD) at Host, usually port 8080.
+	OoklaSocketServer
+	// LibrespeedServer is a LibreSpeed backend. URL is the directory containing garbage.php and empty.php.
+	LibrespeedServer
+	// CloudflareServer is Cloudflare's speed test, tested over the __down, __up and /cdn-cgi/trace endpoints of URL.
+	// See FetchCloudflareServer.
+	CloudflareServer
+	// FastComServer is a Netflix Open Connect server assigned by fast.com. URL is the signed speedtest URL,
+	// from which byte ranges are downloaded and to which they are uploaded. See FetchFastComServers.
+	FastComServer
+)
+
 // Server information
 type Server struct {
 	URL      string        `xml:"url,attr" json:"url"`
@@ -34,12 +56,85 @@ type Server struct {
 	ID       string        `xml:"id,attr" json:"id"`
 	URL2     string        `xml:"url2,attr" json:"url_2"`
 	Host     string        `xml:"host,attr" json:"host"`
+	Type     ServerType    `json:"type"`
 	Distance float64       `json:"distance"`
 	Latency  time.Duration `json:"latency"`
 	DLSpeed  float64       `json:"dl_speed"`
 	ULSpeed  float64       `json:"ul_speed"`
 
-	doer *http.Client
+	// DLCapReached and ULCapReached report whether tests capped by TestConfig.RateLimit reached the cap.
+	// No traffic of a test exceeds the cap, so DLSpeed and ULSpeed then only show that the link is at least that fast.
+	DLCapReached bool `json:"dl_cap_reached"`
+	ULCapReached bool `json:"ul_cap_reached"`
+
+	// DLSpeedStable and ULSpeedStable are exponentially weighted moving averages of the throughput of the main phase
+	// past ramp-up, steadier than the instant throughput for display. See DLRate and ULRate for other units.
+	DLSpeedStable float64 `json:"dl_speed_stable"`
+	ULSpeedStable float64 `json:"ul_speed_stable"`
+
+	// DLWireSpeed and ULWireSpeed estimate the link layer rates of DLSpeed and ULSpeed, which are goodput,
+	// with the overhead model of TestConfig.Overhead.
+	DLWireSpeed float64 `json:"dl_wire_speed"`
+	ULWireSpeed float64 `json:"ul_wire_speed"`
+
+	// Latency is half of the fastest round trip; the fields below are round trip values as reported by speedtest.net.
+	MinLatency time.Duration `json:"min_latency"`
+	MaxLatency time.Duration `json:"max_latency"`
+	Jitter     time.Duration `json:"jitter"`
+	PacketLoss float64       `json:"packet_loss"` // percentage of lost round trips
+
+	LatencyMethod LatencyMethod `json:"latency_method"`
+
+	// RemoteIP is the address the server was tested at, the proxy's for proxied tests, and IPVersion its family, 4 or 6.
+	// See TestConfig.Network.
+	RemoteIP  string `json:"remote_ip,omitempty"`
+	IPVersion int    `json:"ip_version,omitempty"`
+
+	// ProxyLatency is the fastest round trip to the proxy of a proxied test, and FullPathLatency the fastest
+	// round trip through it to the server, whether or not TestConfig.ProxyLatencyCorrection is set. 0 without proxy.
+	ProxyLatency    time.Duration `json:"proxy_latency,omitempty"`
+	FullPathLatency time.Duration `json:"full_path_latency,omitempty"`
+
+	// Path holds the route to the server captured by TracePath, before the latency test if TestConfig.TracePath is set.
+	Path *Path `json:"path,omitempty"`
+
+	// ClientInfo describes the caller as located for the server list, or as seen by a LibreSpeed backend,
+	// see FetchClientInfo.
+	ClientInfo *ClientInfo `json:"client_info,omitempty"`
+	// Share identifies the result submitted by ShareResult, or after the upload test if TestConfig.ShareResult is set.
+	Share *Share `json:"share,omitempty"`
+
+	// Bufferbloat holds the round trips measured under load when TestConfig.LoadedLatency is set.
+	Bufferbloat *Bufferbloat `json:"bufferbloat,omitempty"`
+	// Bidirectional holds the throughput measured by BidirectionalTest.
+	Bidirectional *Bidirectional `json:"bidirectional,omitempty"`
+	// UDP holds the datagram rates, loss and reordering measured by UDPTest.
+	UDP *UDPThroughput `json:"udp,omitempty"`
+	// Timings breaks down the HTTP requests of the latency, download and upload tests.
+	Timings *Timings `json:"timings,omitempty"`
+	// Soak holds the checkpoints of the download and upload tests run with TestConfig.Soak.
+	Soak *Soak `json:"soak,omitempty"`
+
+	doer   *http.Client
+	dialer *net.Dialer // for connections made outside doer, nil for the default dialer
+	proxy  *proxy      // the proxy connections are routed through, nil for none
+	// the dialer of a custom network stack every connection is opened with, nil for the host's
+	netDialer ContextDialer
+
+	// round trips of the latest latency test, the idle baseline of Bufferbloat
+	idleSamples []time.Duration
+
+	// bookkeeping for Result
+	startedAt  time.Time
+	finishedAt time.Time
+	dlBytes    int64
+	ulBytes    int64
+	dlSamples  []float64
+	ulSamples  []float64
+	dlStreams  []StreamStats
+	ulStreams  []StreamStats
+	dlDuration time.Duration
+	ulDuration time.Duration
 }
 
 // ServerList list of Server
@@ -50,6 +145,9 @@ type ServerList struct {
 // Servers for sorting servers.
 type Servers []*Server
 
+// ServerFilter reports whether a server should be kept while the server list is decoded.
+type ServerFilter func(*Server) bool
+
 // ByDistance for sorting servers.
 type ByDistance struct {
 	Servers
@@ -70,6 +168,20 @@ func (b ByDistance) Less(i, j int) bool {
 	return b.Servers[i].Distance < b.Servers[j].Distance
 }
 
+// serverHeap is a max-heap on distance used to keep the closest servers during decoding.
+type serverHeap Servers
+
+func (h serverHeap) Len() int            { return len(h) }
+func (h serverHeap) Less(i, j int) bool  { return h[i].Distance > h[j].Distance }
+func (h serverHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *serverHeap) Push(x interface{}) { *h = append(*h, x.(*Server)) }
+func (h *serverHeap) Pop() interface{} {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
 // FetchServers retrieves a list of available servers
 func (client *Speedtest) FetchServers(user *User) (Servers, error) {
 	return client.FetchServerListContext(context.Background(), user)
@@ -112,47 +224,49 @@ func (client *Speedtest) FetchServerListContext(ctx context.Context, user *User)
 
 	defer resp.Body.Close()
 
-	var servers Servers
+	return client.decodeServers(resp.Body, payloadType, user, nil, 0)
+}
 
-	switch payloadType {
-	case JSONPayload:
-		// Decode xml
-		decoder := json.NewDecoder(resp.Body)
+// FetchServerListFilteredContext retrieves the limit servers closest to user that pass filter, observing the given context.
+// Unlike FetchServerListContext, which gets the few servers speedtest.net picks near the caller, it reads the full
+// static list of servers. The list is decoded incrementally, so memory use is bounded by limit rather than by the size
+// of the list. A nil filter keeps every server and a limit of 0 keeps all servers that pass the filter.
+func (client *Speedtest) FetchServerListFilteredContext(ctx context.Context, user *User, filter ServerFilter, limit int) (Servers, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, speedTestServersAlternativeUrl, nil)
+	if err != nil {
+		return Servers{}, err
+	}
 
-		if err := decoder.Decode(&servers); err != nil {
-			return servers, err
-		}
-	case XMLPayload:
-		var list ServerList
-		// Decode xml
-		decoder := xml.NewDecoder(resp.Body)
+	resp, err := client.doer.Do(req)
+	if err != nil {
+		return Servers{}, connError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return Servers{}, err
+	}
 
-		if err := decoder.Decode(&list); err != nil {
-			return servers, err
-		}
+	return client.decodeServers(resp.Body, XMLPayload, user, filter, limit)
+}
 
-		servers = list.Servers
-	default:
-		return servers, fmt.Errorf("response payload decoding not implemented")
+// decodeServers decodes a server list payload with decodeServerList and sets up the servers for the client.
+func (client *Speedtest) decodeServers(r io.Reader, payloadType PayloadType, user *User, filter ServerFilter, limit int) (Servers, error) {
+	servers, err := decodeServerList(r, payloadType, user, filter, limit)
+	if err != nil {
+		return servers, err
 	}
 
 	// set doer of server
 	for _, s := range servers {
 		s.doer = client.doer
+		s.dialer = client.dialer
+		s.proxy = client.proxy
+		s.netDialer = client.netDialer
+		if user != nil {
+			s.ClientInfo = user.ClientInfo()
+		}
 	}
 
-	// Calculate distance
-	for _, server := range servers {
-		sLat, _ := strconv.ParseFloat(server.Lat, 64)
-		sLon, _ := strconv.ParseFloat(server.Lon, 64)
-		uLat, _ := strconv.ParseFloat(user.Lat, 64)
-		uLon, _ := strconv.ParseFloat(user.Lon, 64)
-		server.Distance = distance(sLat, sLon, uLat, uLon)
-	}
-
-	// Sort by distance
-	sort.Sort(ByDistance{servers})
-
 	if len(servers) <= 0 {
 		return servers, errors.New("unable to retrieve server list")
 	}
@@ -165,6 +279,106 @@ func FetchServerListContext(ctx context.Context, user *User) (Servers, error) {
 	return defaultClient.FetchServerListContext(ctx, user)
 }
 
+// FetchServerListFilteredContext retrieves the limit servers closest to user that pass filter, observing the given context.
+func FetchServerListFilteredContext(ctx context.Context, user *User, filter ServerFilter, limit int) (Servers, error) {
+	return defaultClient.FetchServerListFilteredContext(ctx, user, filter, limit)
+}
+
+// decodeServerList decodes a server list payload, keeping the limit servers closest to user that pass filter.
+func decodeServerList(r io.Reader, payloadType PayloadType, user *User, filter ServerFilter, limit int) (Servers, error) {
+	var uLat, uLon float64
+	if user != nil {
+		uLat, _ = strconv.ParseFloat(user.Lat, 64)
+		uLon, _ = strconv.ParseFloat(user.Lon, 64)
+	}
+
+	// Servers are filtered and ranked while decoding so that only the kept entries are held in memory.
+	// Without a user location distances are unknown, so the first servers of the list are kept in order;
+	// speedtest.net already orders the list by proximity to the caller.
+	kept := &serverHeap{}
+	keep := func(server *Server) {
+		if user != nil {
+			sLat, _ := strconv.ParseFloat(server.Lat, 64)
+			sLon, _ := strconv.ParseFloat(server.Lon, 64)
+			server.Distance = distance(sLat, sLon, uLat, uLon)
+		}
+
+		if filter != nil && !filter(server) {
+			return
+		}
+		if user == nil {
+			if limit <= 0 || kept.Len() < limit {
+				*kept = append(*kept, server)
+			}
+			return
+		}
+		heap.Push(kept, server)
+		if limit > 0 && kept.Len() > limit {
+			heap.Pop(kept)
+		}
+	}
+
+	var err error
+	switch payloadType {
+	case JSONPayload:
+		err = decodeJSONServers(r, keep)
+	case XMLPayload:
+		err = decodeXMLServers(r, keep)
+	default:
+		err = fmt.Errorf("response payload decoding not implemented")
+	}
+
+	servers := Servers(*kept)
+	if user != nil {
+		sort.Sort(ByDistance{servers})
+	}
+
+	return servers, err
+}
+
+// decodeJSONServers decodes a JSON array of servers one element at a time.
+func decodeJSONServers(r io.Reader, keep func(*Server)) error {
+	decoder := json.NewDecoder(r)
+
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	for decoder.More() {
+		server := &Server{}
+		if err := decoder.Decode(server); err != nil {
+			return err
+		}
+		keep(server)
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+// decodeXMLServers decodes <server> elements one at a time.
+func decodeXMLServers(r io.Reader, keep func(*Server)) error {
+	decoder := xml.NewDecoder(r)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "server" {
+			continue
+		}
+		server := &Server{}
+		if err := decoder.DecodeElement(server, &start); err != nil {
+			return err
+		}
+		keep(server)
+	}
+}
+
 func distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
 	radius := 6378.137
 
@@ -177,6 +391,83 @@ func distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
 	return radius * math.Acos(x)
 }
 
+// CustomServer creates a Server for the speedtest server at rawURL (e.g. "http://host:8080/speedtest/upload.php"),
+// such as a self-hosted server or a fleet peer that is not part of the public server list.
+func (client *Speedtest) CustomServer(rawURL string) (*Server, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid server url %q", rawURL)
+	}
+
+	return &Server{
+		URL:       rawURL,
+		Name:      u.Hostname(),
+		Sponsor:   "Custom",
+		Host:      u.Host,
+		doer:      client.doer,
+		dialer:    client.dialer,
+		proxy:     client.proxy,
+		netDialer: client.netDialer,
+	}, nil
+}
+
+// CustomServer creates a Server for the speedtest server at rawURL.
+func CustomServer(rawURL string) (*Server, error) {
+	return defaultClient.CustomServer(rawURL)
+}
+
+// DiscoverServers retrieves the list of available servers, sorted by distance from the caller's geo-located IP
+func (client *Speedtest) DiscoverServers() (Servers, error) {
+	return client.DiscoverServersContext(context.Background())
+}
+
+// DiscoverServers retrieves the list of available servers, sorted by distance from the caller's geo-located IP
+func DiscoverServers() (Servers, error) {
+	return defaultClient.DiscoverServers()
+}
+
+// DiscoverServersContext retrieves the list of available servers, sorted by distance from the caller's geo-located IP,
+// observing the given context. If the caller cannot be located, servers are returned in the order speedtest.net lists them.
+func (client *Speedtest) DiscoverServersContext(ctx context.Context) (Servers, error) {
+	user, err := client.FetchUserInfoContext(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return Servers{}, ctx.Err()
+		}
+		user = nil
+	}
+	return client.FetchServerListContext(ctx, user)
+}
+
+// DiscoverServersContext retrieves the list of available servers, sorted by distance from the caller's geo-located IP,
+// observing the given context.
+func DiscoverServersContext(ctx context.Context) (Servers, error) {
+	return defaultClient.DiscoverServersContext(ctx)
+}
+
+// ClosestServers returns the n servers closest to the caller, or all servers by distance if n is not positive.
+func (l Servers) ClosestServers(n int) Servers {
+	servers := append(Servers{}, l...)
+	sort.Stable(ByDistance{servers})
+	if n > 0 && n < len(servers) {
+		servers = servers[:n]
+	}
+	return servers
+}
+
+// FindServerByID returns the server with the given id.
+func (l Servers) FindServerByID(id string) (*Server, error) {
+	for _, s := range l {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("server %s not found", id)
+}
+
 // FindServer finds server by serverID
 func (l Servers) FindServer(serverID []int) (Servers, error) {
 	servers := Servers{}
@@ -224,6 +515,37 @@ func (s *Server) String() string {
 	return fmt.Sprintf("[%4s] %8.2fkm \n%s (%s) by %s\n", s.ID, s.Distance, s.Name, s.Country, s.Sponsor)
 }
 
+// resetRun clears the results of earlier tests, so that a new run of tests against the server does not carry them over.
+// The server itself, its connections and ClientInfo are kept.
+func (s *Server) resetRun() {
+	*s = Server{
+		URL:        s.URL,
+		Lat:        s.Lat,
+		Lon:        s.Lon,
+		Name:       s.Name,
+		Country:    s.Country,
+		Sponsor:    s.Sponsor,
+		ID:         s.ID,
+		URL2:       s.URL2,
+		Host:       s.Host,
+		Type:       s.Type,
+		Distance:   s.Distance,
+		ClientInfo: s.ClientInfo,
+		doer:       s.doer,
+		dialer:     s.dialer,
+		proxy:      s.proxy,
+		netDialer:  s.netDialer,
+	}
+}
+
+// markTest records that a test started at start has just finished.
+func (s *Server) markTest(start time.Time) {
+	if s.startedAt.IsZero() {
+		s.startedAt = start
+	}
+	s.finishedAt = time.Now()
+}
+
 // CheckResultValid checks that results are logical given UL and DL speeds
 func (s Server) CheckResultValid() bool {
 	return !(s.DLSpeed*100 < s.ULSpeed) || !(s.DLSpeed > s.ULSpeed*100)
@@ -1,6 +1,12 @@
 package speedtest
 
-import "testing"
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
 
 func TestFetchServerList(t *testing.T) {
 	user := User{
@@ -99,3 +105,117 @@ func TestFindServer(t *testing.T) {
 		t.Errorf("Unexpected server ID. got: %v, expected: '1'", s[0].ID)
 	}
 }
+
+func TestDecodeServerList(t *testing.T) {
+	user := &User{Lat: "0.0", Lon: "0.0"}
+
+	jsonList := `[
+		{"id": "1", "lat": "3.0", "lon": "0.0", "country": "Japan"},
+		{"id": "2", "lat": "1.0", "lon": "0.0", "country": "Japan"},
+		{"id": "3", "lat": "2.0", "lon": "0.0", "country": "Korea"},
+		{"id": "4", "lat": "0.5", "lon": "0.0", "country": "Japan"}
+	]`
+	servers, err := decodeServerList(strings.NewReader(jsonList), JSONPayload, user, func(s *Server) bool {
+		return s.Country == "Japan"
+	}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 2 || servers[0].ID != "4" || servers[1].ID != "2" {
+		t.Errorf("got unexpected servers %v", servers)
+	}
+
+	xmlList := `<?xml version="1.0" encoding="UTF-8"?>
+<settings><servers>
+<server id="1" lat="3.0" lon="0.0" country="Japan" />
+<server id="2" lat="1.0" lon="0.0" country="Japan" />
+<server id="3" lat="2.0" lon="0.0" country="Korea" />
+</servers></settings>`
+	servers, err = decodeServerList(strings.NewReader(xmlList), XMLPayload, user, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 3 || servers[0].ID != "2" || servers[2].ID != "1" {
+		t.Errorf("got unexpected servers %v", servers)
+	}
+	if servers[0].Distance < 111 || 112 < servers[0].Distance {
+		t.Errorf("got unexpected distance %v", servers[0].Distance)
+	}
+}
+
+func TestFetchServerListFiltered(t *testing.T) {
+	xmlList := `<?xml version="1.0" encoding="UTF-8"?>
+<settings><servers>
+<server id="1" lat="3.0" lon="0.0" country="Japan" />
+<server id="2" lat="1.0" lon="0.0" country="Japan" />
+<server id="3" lat="2.0" lon="0.0" country="Korea" />
+<server id="4" lat="2.5" lon="0.0" country="Japan" />
+</servers></settings>`
+	var paths []string
+	doer := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		paths = append(paths, r.URL.String())
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(xmlList)), Request: r}, nil
+	})}
+
+	user := &User{Lat: "0.0", Lon: "0.0", IP: "192.0.2.1"}
+	servers, err := New(WithDoer(doer)).FetchServerListFilteredContext(context.Background(), user, func(s *Server) bool {
+		return s.Country == "Japan"
+	}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != speedTestServersAlternativeUrl {
+		t.Errorf("got requests %v, expected the static list only", paths)
+	}
+	if len(servers) != 2 || servers[0].ID != "2" || servers[1].ID != "4" {
+		t.Errorf("got unexpected servers %v", servers)
+	}
+	if servers[0].doer != doer || servers[0].ClientInfo == nil || servers[0].ClientInfo.IP != "192.0.2.1" {
+		t.Errorf("got server not set up for the client: %+v", servers[0])
+	}
+}
+
+func TestDecodeServerListWithoutUser(t *testing.T) {
+	jsonList := `[
+		{"id": "1", "lat": "3.0", "lon": "0.0"},
+		{"id": "2", "lat": "1.0", "lon": "0.0"},
+		{"id": "3", "lat": "2.0", "lon": "0.0"}
+	]`
+	servers, err := decodeServerList(strings.NewReader(jsonList), JSONPayload, nil, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 2 || servers[0].ID != "1" || servers[1].ID != "2" || servers[0].Distance != 0 {
+		t.Errorf("got unexpected servers %v", servers)
+	}
+}
+
+func TestClosestServers(t *testing.T) {
+	servers := Servers{
+		&Server{ID: "1", Distance: 30},
+		&Server{ID: "2", Distance: 10},
+		&Server{ID: "3", Distance: 20},
+	}
+
+	closest := servers.ClosestServers(2)
+	if len(closest) != 2 || closest[0].ID != "2" || closest[1].ID != "3" {
+		t.Errorf("got unexpected servers %v", closest)
+	}
+	if servers[0].ID != "1" {
+		t.Error("ClosestServers must not reorder the receiver")
+	}
+	if len(servers.ClosestServers(5)) != 3 {
+		t.Error("ClosestServers must return all servers when n exceeds the list")
+	}
+	if len(servers.ClosestServers(0)) != 3 || len(servers.ClosestServers(-1)) != 3 {
+		t.Error("ClosestServers must return all servers when n is not positive")
+	}
+
+	s, err := servers.FindServerByID("3")
+	if err != nil || s.Distance != 20 {
+		t.Errorf("got unexpected server %v, error %v", s, err)
+	}
+	if _, err := servers.FindServerByID("4"); err == nil {
+		t.Error("expected an error for an unknown server id")
+	}
+}
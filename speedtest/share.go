@@ -0,0 +1,119 @@
+package speedtest
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	speedTestResultApiUrl = "https://www.speedtest.net/api/api.php"
+	speedTestShareUrl     = "https://www.speedtest.net/result/%s.png"
+
+	// speedTestResultKey salts the hash speedtest.net verifies submitted results with.
+	speedTestResultKey = "297aae72"
+	speedTestReferer   = "http://c.speedtest.net/flash/speedtest.swf"
+)
+
+// Share identifies a result submitted to speedtest.net.
+type Share struct {
+	ResultID string `json:"result_id,omitempty"`
+	// URL is the link to the image of the result, which the result page of ResultID on speedtest.net also shows.
+	URL string `json:"url,omitempty"`
+	// Error is the error that prevented the submission, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// ShareResult submits the results of the latency, download and upload tests to speedtest.net, so that they appear
+// in the history of the caller, or to the telemetry of a LibreSpeed backend, and records the share link in Server.Share.
+// Other server types do not accept results.
+func (s *Server) ShareResult() (*Share, error) {
+	return s.ShareResultContext(context.Background())
+}
+
+// ShareResultContext submits the results of the latency, download and upload tests, observing the given context.
+// See ShareResult.
+func (s *Server) ShareResultContext(ctx context.Context) (*Share, error) {
+	share, err := s.shareResult(ctx, speedTestResultApiUrl)
+	if err != nil {
+		share = &Share{Error: err.Error()}
+	}
+	s.Share = share
+	return share, err
+}
+
+// shareResult submits the results of a speedtest.net server to apiURL, or those of a LibreSpeed backend to its telemetry.
+func (s *Server) shareResult(ctx context.Context, apiURL string) (*Share, error) {
+	if s.MinLatency <= 0 || s.dlDuration <= 0 || s.ulDuration <= 0 {
+		return nil, errors.New("the latency, download and upload tests must be run before sharing")
+	}
+	switch {
+	case s.Type == LibrespeedServer:
+		return s.librespeedTelemetry(ctx)
+	case (s.Type == StandardServer || s.Type == OoklaSocketServer) && s.ID != "":
+		return s.speedtestResult(ctx, apiURL)
+	}
+	return nil, fmt.Errorf("%w: %d does not accept results", ErrUnsupportedServerType, s.Type)
+}
+
+// speedtestResult submits the results to the speedtest.net results API at apiURL.
+func (s *Server) speedtestResult(ctx context.Context, apiURL string) (*Share, error) {
+	ping := int(math.Round(milliseconds(s.MinLatency)))
+	download := int(math.Round(s.DLSpeed * 1000)) // kbit/s
+	upload := int(math.Round(s.ULSpeed * 1000))
+	hash := md5.Sum([]byte(fmt.Sprintf("%d-%d-%d-%s", ping, upload, download, speedTestResultKey)))
+
+	form := url.Values{
+		"recommendedserverid": {s.ID},
+		"serverid":            {s.ID},
+		"ping":                {strconv.Itoa(ping)},
+		"download":            {strconv.Itoa(download)},
+		"upload":              {strconv.Itoa(upload)},
+		"bytesreceived":       {strconv.FormatInt(s.dlBytes, 10)},
+		"bytessent":           {strconv.FormatInt(s.ulBytes, 10)},
+		"hash":                {fmt.Sprintf("%x", hash)},
+		"testmethod":          {"http"},
+		"startmode":           {"pingselect"},
+		"accuracy":            {"1"},
+		"touchscreen":         {"none"},
+		"screenresolution":    {""},
+		"screendpi":           {""},
+		"promo":               {""},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", speedTestReferer)
+
+	resp, err := s.doer.Do(req)
+	if err != nil {
+		return nil, connError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	values, err := url.ParseQuery(strings.TrimSpace(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	id := values.Get("resultid")
+	if id == "" {
+		return nil, errors.New("speedtest.net did not return a result id")
+	}
+	return &Share{ResultID: id, URL: fmt.Sprintf(speedTestShareUrl, id)}, nil
+}
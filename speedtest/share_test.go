@@ -0,0 +1,86 @@
+package speedtest
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestShareResult(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		hash := fmt.Sprintf("%x", md5.Sum([]byte("21-35260-73300-"+speedTestResultKey)))
+		if r.Method != http.MethodPost || r.Referer() != speedTestReferer || r.Form.Get("hash") != hash ||
+			r.Form.Get("serverid") != "6691" || r.Form.Get("bytesreceived") != "100000000" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "resultid=12345&date=1%2F1%2F2021&time=12%3A00+AM&rating=0")
+	}))
+	defer ts.Close()
+
+	server := &Server{
+		ID:         "6691",
+		MinLatency: 20600 * time.Microsecond,
+		DLSpeed:    73.3,
+		ULSpeed:    35.26,
+		dlBytes:    100000000,
+		ulBytes:    50000000,
+		dlDuration: 10 * time.Second,
+		ulDuration: 10 * time.Second,
+		doer:       http.DefaultClient,
+	}
+	share, err := server.shareResult(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if share.ResultID != "12345" || share.URL != "https://www.speedtest.net/result/12345.png" {
+		t.Errorf("got unexpected share %+v", share)
+	}
+
+	server.ulDuration = 0
+	if _, err := server.shareResult(context.Background(), ts.URL); err == nil {
+		t.Error("expected an error without an upload test")
+	}
+}
+
+func TestShareResultUnsupported(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, _ := strconv.Atoi(r.URL.Query().Get("bytes"))
+		io.Copy(w, newPayload(int64(size), PayloadRepeat))
+		io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Type = CloudflareServer
+	cfg := NewTestConfig(WithPingCount(1), WithSavingMode(true))
+	if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed submission does not fail the upload test.
+	if err := server.UploadTestWithConfig(context.Background(), NewTestConfig(WithSavingMode(true), WithShareResult(true))); err != nil {
+		t.Fatal(err)
+	}
+	if server.Share == nil || server.Share.Error == "" {
+		t.Errorf("got unexpected share %+v", server.Share)
+	}
+	if _, err := server.ShareResult(); !errors.Is(err, ErrUnsupportedServerType) {
+		t.Errorf("got unexpected error %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCheckpointInterval = time.Minute
+	// soakMinBackoff and soakMaxBackoff bound the wait of a soak test stream before it retries a failed request.
+	// The wait doubles with every consecutive failure.
+	soakMinBackoff = 250 * time.Millisecond
+	soakMaxBackoff = 10 * time.Second
+)
+
+// Checkpoint is the state of the main phase of a soak test at the end of an interval, see TestConfig.Soak.
+type Checkpoint struct {
+	Stage Stage `json:"-"`
+	// Elapsed is the time since the main phase started, and Bytes the bytes moved since.
+	Elapsed time.Duration `json:"elapsed"`
+	Bytes   uint64        `json:"bytes"`
+	// Speed is the rate of the interval and AvgSpeed the rate since the main phase started, in Mbit/s.
+	Speed    float64 `json:"mbps"`
+	AvgSpeed float64 `json:"avg_mbps"`
+	// Errors is the number of requests that failed during the interval and were retried, and TotalErrors
+	// the number since the main phase started.
+	Errors      int `json:"errors"`
+	TotalErrors int `json:"total_errors"`
+	// LastError is the latest error of the interval, if any.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// checkpointJSON is the wire format of Checkpoint.
+type checkpointJSON struct {
+	ElapsedMs   float64 `json:"elapsed_ms"`
+	Bytes       uint64  `json:"bytes"`
+	Speed       float64 `json:"mbps"`
+	AvgSpeed    float64 `json:"avg_mbps"`
+	Errors      int     `json:"errors"`
+	TotalErrors int     `json:"total_errors"`
+	LastError   string  `json:"last_error,omitempty"`
+}
+
+// MarshalJSON encodes the checkpoint with its elapsed time in milliseconds.
+func (cp Checkpoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(checkpointJSON{milliseconds(cp.Elapsed), cp.Bytes, cp.Speed, cp.AvgSpeed, cp.Errors, cp.TotalErrors, cp.LastError})
+}
+
+// UnmarshalJSON decodes a checkpoint encoded by MarshalJSON. Its Stage is left zero.
+func (cp *Checkpoint) UnmarshalJSON(data []byte) error {
+	var v checkpointJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*cp = Checkpoint{
+		Elapsed:     fromMilliseconds(v.ElapsedMs),
+		Bytes:       v.Bytes,
+		Speed:       v.Speed,
+		AvgSpeed:    v.AvgSpeed,
+		Errors:      v.Errors,
+		TotalErrors: v.TotalErrors,
+		LastError:   v.LastError,
+	}
+	return nil
+}
+
+// SoakStats holds the checkpoints of the main phase of a soak test.
+type SoakStats struct {
+	Checkpoints []Checkpoint `json:"checkpoints"`
+	// Errors is the number of requests that failed and were retried.
+	Errors int `json:"errors"`
+}
+
+// Soak holds the checkpoints of the soak tests run against a server. A direction not soaked is nil.
+type Soak struct {
+	Download *SoakStats `json:"download,omitempty"`
+	Upload   *SoakStats `json:"upload,omitempty"`
+}
+
+// SoakReporter receives the checkpoints of a soak test.
+type SoakReporter interface {
+	OnCheckpoint(cp Checkpoint)
+}
+
+// SoakReporterFunc is an adapter to allow the use of ordinary functions as SoakReporter.
+type SoakReporterFunc func(cp Checkpoint)
+
+// OnCheckpoint calls f(cp).
+func (f SoakReporterFunc) OnCheckpoint(cp Checkpoint) {
+	f(cp)
+}
+
+// soakCollector counts the failed requests of the main phase of a soak test and records its checkpoints.
+type soakCollector struct {
+	cfg   TestConfig
+	stage Stage
+	m     *meter
+	doer  *http.Client
+	start time.Time
+
+	mu          sync.Mutex
+	errors      int
+	interval    int // errors of the current interval
+	lastError   string
+	checkpoints []Checkpoint
+	lastBytes   uint64
+	lastTime    time.Time
+
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// startSoak starts recording the checkpoints of the main phase of stage, whose bytes are counted by m, every
+// CheckpointInterval. It returns nil if cfg is not a soak test. doer is the client of HTTP requests, nil for others.
+func startSoak(cfg TestConfig, stage Stage, m *meter, doer *http.Client) *soakCollector {
+	if !cfg.Soak || cfg.Duration <= 0 {
+		return nil
+	}
+	interval := cfg.CheckpointInterval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	now := time.Now()
+	c := &soakCollector{
+		cfg:      cfg,
+		stage:    stage,
+		m:        m,
+		doer:     doer,
+		start:    now,
+		lastTime: now,
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go func() {
+		defer close(c.finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				c.checkpoint(now)
+			case <-c.done:
+				c.checkpoint(time.Now())
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// retry returns request retrying failed requests over new connections after a backoff, until they succeed or the
+// main phase has lasted Duration, when the stream gives up without error. A nil collector returns request as is.
+// Errors caused by ctx are returned as they are.
+func (c *soakCollector) retry(request func(context.Context, *meter) error) func(context.Context, *meter) error {
+	if c == nil {
+		return request
+	}
+	return func(ctx context.Context, m *meter) error {
+		backoff := soakMinBackoff
+		for {
+			err := request(ctx, m)
+			if err == nil || ctx.Err() != nil {
+				return err
+			}
+			c.fail(err)
+
+			left := c.cfg.Duration - time.Since(c.start)
+			if left <= 0 {
+				return nil
+			}
+			if backoff > left {
+				backoff = left
+			}
+			t := time.NewTimer(backoff)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+			if backoff *= 2; backoff > soakMaxBackoff {
+				backoff = soakMaxBackoff
+			}
+		}
+	}
+}
+
+// fail counts a failed request and drops the idle connections, so that the retry reconnects.
+func (c *soakCollector) fail(err error) {
+	c.mu.Lock()
+	c.errors++
+	c.interval++
+	c.lastError = err.Error()
+	c.mu.Unlock()
+	if c.doer != nil {
+		c.doer.CloseIdleConnections()
+	}
+}
+
+// checkpoint records the checkpoint of the interval ending at now and hands it to TestConfig.SoakReporter.
+func (c *soakCollector) checkpoint(now time.Time) {
+	total := c.m.total()
+	c.mu.Lock()
+	elapsed := now.Sub(c.start)
+	cp := Checkpoint{
+		Stage:       c.stage,
+		Elapsed:     elapsed,
+		Bytes:       total,
+		Speed:       mbps(total-c.lastBytes, now.Sub(c.lastTime)),
+		AvgSpeed:    mbps(total, elapsed),
+		Errors:      c.interval,
+		TotalErrors: c.errors,
+	}
+	if c.interval > 0 {
+		cp.LastError = c.lastError
+	}
+	c.checkpoints = append(c.checkpoints, cp)
+	c.interval = 0
+	c.lastBytes, c.lastTime = total, now
+	c.mu.Unlock()
+
+	if c.cfg.SoakReporter != nil {
+		c.cfg.SoakReporter.OnCheckpoint(cp)
+	}
+}
+
+// stop records the final checkpoint and returns the statistics of the phase. A nil collector returns nil.
+func (c *soakCollector) stop() *SoakStats {
+	if c == nil {
+		return nil
+	}
+	close(c.done)
+	<-c.finished
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &SoakStats{Checkpoints: c.checkpoints, Errors: c.errors}
+}
+
+// recordSoak stores the statistics of the soak test of stage, if it was one.
+func (s *Server) recordSoak(stage Stage, stats *SoakStats) {
+	if stats == nil {
+		return
+	}
+	if s.Soak == nil {
+		s.Soak = &Soak{}
+	}
+	switch stage {
+	case StageDownload:
+		s.Soak.Download = stats
+	case StageUpload:
+		s.Soak.Upload = stats
+	}
+}
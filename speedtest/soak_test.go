@@ -0,0 +1,98 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest/speedtesttest"
+)
+
+// newFlakyTestServer starts a server failing every third download past the warm-up.
+func newFlakyTestServer() *speedtesttest.Server {
+	var downloads int64
+	return speedtesttest.NewServer(speedtesttest.Config{
+		DownloadMbps: 50,
+		Inject: func(r *http.Request) int {
+			if !strings.Contains(r.URL.Path, "/random") {
+				return 0
+			}
+			if n := atomic.AddInt64(&downloads, 1); n > 2 && n%3 == 0 {
+				return http.StatusServiceUnavailable
+			}
+			return 0
+		},
+	})
+}
+
+func TestSoakDownload(t *testing.T) {
+	ts := newFlakyTestServer()
+	defer ts.Close()
+	server, err := New().CustomServer(ts.SpeedtestURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var checkpoints []Checkpoint
+	reporter := SoakReporterFunc(func(cp Checkpoint) {
+		mu.Lock()
+		checkpoints = append(checkpoints, cp)
+		mu.Unlock()
+	})
+	cfg := NewTestConfig(WithSoak(time.Second, 250*time.Millisecond, reporter), WithPayloadSize(500*1000), WithMaxStreams(2))
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	soak := server.Soak
+	if soak == nil || soak.Download == nil || soak.Upload != nil {
+		t.Fatalf("got unexpected soak %+v", soak)
+	}
+	if soak.Download.Errors == 0 || int64(soak.Download.Errors) > ts.Stats().Errors {
+		t.Errorf("got %v errors, server injected %v", soak.Download.Errors, ts.Stats().Errors)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(checkpoints) < 4 || len(checkpoints) != len(soak.Download.Checkpoints) {
+		t.Fatalf("got %v checkpoints reported, %v recorded", len(checkpoints), len(soak.Download.Checkpoints))
+	}
+	last := checkpoints[len(checkpoints)-1]
+	if last.Stage != StageDownload || last.TotalErrors != soak.Download.Errors || last.Bytes != uint64(server.Result().DLBytes) {
+		t.Errorf("got unexpected last checkpoint %+v", last)
+	}
+	if server.DLSpeed <= 0 || last.AvgSpeed <= 0 {
+		t.Errorf("got speed %v, average %v", server.DLSpeed, last.AvgSpeed)
+	}
+
+	data, err := json.Marshal(server.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Result
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Soak == nil || r.Soak.Download == nil || len(r.Soak.Download.Checkpoints) != len(checkpoints) {
+		t.Errorf("got unexpected soak after a JSON round trip: %s", data)
+	}
+}
+
+func TestSoakWithoutSoak(t *testing.T) {
+	ts := newFlakyTestServer()
+	defer ts.Close()
+	server, _ := New().CustomServer(ts.SpeedtestURL())
+
+	cfg := NewTestConfig(WithDuration(time.Second), WithPayloadSize(500*1000), WithMaxStreams(2))
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err == nil {
+		t.Error("expected the injected errors to fail the test")
+	}
+	if server.Soak != nil {
+		t.Errorf("got soak %+v without soak test", server.Soak)
+	}
+}
@@ -0,0 +1,201 @@
+package speedtest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultSocketPort is the port speedtest.net servers listen on for the TCP protocol.
+const defaultSocketPort = "8080"
+
+// socketConn is a connection speaking Ookla's line-based TCP protocol (HI/PING/DOWNLOAD/UPLOAD).
+type socketConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// socketAddr returns the host:port of the server's TCP protocol endpoint.
+func (s *Server) socketAddr() string {
+	host := s.Host
+	if host == "" {
+		host = strings.Split(strings.TrimPrefix(strings.TrimPrefix(s.URL, "http://"), "https://"), "/")[0]
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), defaultSocketPort)
+	}
+	return host
+}
+
+// hostname returns the host name or IP of the server, without port.
+func (s *Server) hostname() string {
+	host, _, err := net.SplitHostPort(s.socketAddr())
+	if err != nil {
+		return s.Host
+	}
+	return host
+}
+
+// dialSocket connects to addr with d, or the default dialer if d is nil, and performs the HI/HELLO greeting.
+func dialSocket(ctx context.Context, d ContextDialer, addr string) (*socketConn, error) {
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, connError(ctx, err)
+	}
+	recordRemote(ctx, conn.RemoteAddr())
+
+	c := &socketConn{conn: conn, r: bufio.NewReader(conn)}
+	defer c.watch(ctx)()
+
+	if _, err := io.WriteString(conn, "HI\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "HELLO") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting from %s: %q", addr, line)
+	}
+
+	return c, nil
+}
+
+// watch aborts blocking I/O on the connection when ctx is done. The returned function stops watching.
+func (c *socketConn) watch(ctx context.Context) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (c *socketConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	return strings.TrimSpace(line), err
+}
+
+// Close ends the session.
+func (c *socketConn) Close() error {
+	_, _ = io.WriteString(c.conn, "QUIT\n")
+	return c.conn.Close()
+}
+
+// ping measures a single PING/PONG round trip.
+func (c *socketConn) ping(ctx context.Context) (time.Duration, error) {
+	defer c.watch(ctx)()
+
+	sTime := time.Now()
+	if _, err := fmt.Fprintf(c.conn, "PING %d\n", sTime.UnixNano()/int64(time.Millisecond)); err != nil {
+		return 0, err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return 0, err
+	}
+	fTime := time.Now()
+
+	if !strings.HasPrefix(line, "PONG") {
+		return 0, fmt.Errorf("unexpected ping response: %q", line)
+	}
+	return fTime.Sub(sTime), nil
+}
+
+// download requests size bytes and reads them all into w.
+func (c *socketConn) download(ctx context.Context, size int, w io.Writer) error {
+	defer c.watch(ctx)()
+
+	if _, err := fmt.Fprintf(c.conn, "DOWNLOAD %d\n", size); err != nil {
+		return err
+	}
+	n, err := copyPayload(ctx, w, io.LimitReader(c.r, int64(size)))
+	if err == nil && n < int64(size) {
+		return io.EOF
+	}
+	return err
+}
+
+// upload sends size bytes, including the command line, and waits for the server's acknowledgement.
+// wrap, if not nil, wraps the payload reader.
+func (c *socketConn) upload(ctx context.Context, size int, wrap func(io.Reader) io.Reader) error {
+	defer c.watch(ctx)()
+
+	header := fmt.Sprintf("UPLOAD %d 0\n", size)
+	if _, err := io.WriteString(c.conn, header); err != nil {
+		return err
+	}
+	var payload io.Reader = io.MultiReader(newPayload(int64(size-len(header)-1), PayloadRepeat), strings.NewReader("\n"))
+	if wrap != nil {
+		payload = wrap(payload)
+	}
+	if _, err := io.Copy(c.conn, payload); err != nil {
+		return err
+	}
+
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK") {
+		return fmt.Errorf("unexpected upload response: %q", line)
+	}
+	return nil
+}
+
+func (s *Server) socketDownload(ctx context.Context, d ContextDialer, size int, w io.Writer) error {
+	c, err := dialSocket(ctx, d, s.socketAddr())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.download(ctx, size, w)
+}
+
+func (s *Server) socketUpload(ctx context.Context, d ContextDialer, size int, wrap func(io.Reader) io.Reader) error {
+	c, err := dialSocket(ctx, d, s.socketAddr())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.upload(ctx, size, wrap)
+}
+
+// The functions below mirror the HTTP request helpers so that the socket protocol plugs into the same test loops.
+// Payload sizes match the HTTP endpoints: random{N}x{N}.jpg is N*N*2 bytes and uploads are N kB.
+
+// socketDownloadFuncs returns the download warm-up and request functions of the socket protocol, connecting with d.
+func (s *Server) socketDownloadFuncs(d ContextDialer) (downloadWarmUpFunc, downloadFunc) {
+	warmUp := func(ctx context.Context, _ *http.Client, m *meter) error {
+		return s.socketDownload(ctx, d, dlPayload(dlWarmUpWeight), m)
+	}
+	request := func(ctx context.Context, _ *http.Client, w int, m *meter) error {
+		return s.socketDownload(ctx, d, dlPayload(w), m)
+	}
+	return warmUp, request
+}
+
+// socketUploadFuncs returns the upload warm-up and request functions of the socket protocol, connecting with d.
+func (s *Server) socketUploadFuncs(d ContextDialer) (uploadWarmUpFunc, uploadFunc) {
+	warmUp := func(ctx context.Context, _ *http.Client, m *meter) error {
+		return s.socketUpload(ctx, d, ulPayload(ulWarmUpWeight), m.countReader)
+	}
+	request := func(ctx context.Context, _ *http.Client, w int, m *meter) error {
+		return s.socketUpload(ctx, d, ulPayload(w), m.countReader)
+	}
+	return warmUp, request
+}
@@ -0,0 +1,120 @@
+package speedtest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSocketServer(t *testing.T) {
+	l := newSocketTestServer(t)
+	defer l.Close()
+
+	server := &Server{
+		Type: OoklaSocketServer,
+		Host: l.Addr().String(),
+	}
+
+	if err := server.LatencyTestContext(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+	if server.MinLatency <= 0 || server.PacketLoss != 0 {
+		t.Errorf("got unexpected latency '%v' and loss '%v'", server.MinLatency, server.PacketLoss)
+	}
+
+	if err := server.DownloadTestContext(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if server.DLSpeed <= 0 {
+		t.Errorf("got unexpected server.DLSpeed '%v'", server.DLSpeed)
+	}
+
+	if err := server.UploadTestContext(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if server.ULSpeed <= 0 {
+		t.Errorf("got unexpected server.ULSpeed '%v'", server.ULSpeed)
+	}
+}
+
+func TestSocketAddr(t *testing.T) {
+	cases := []struct {
+		server   Server
+		expected string
+	}{
+		{Server{Host: "speedtest.example.com:8080"}, "speedtest.example.com:8080"},
+		{Server{Host: "speedtest.example.com"}, "speedtest.example.com:8080"},
+		{Server{URL: "http://speedtest.example.com/speedtest/upload.php"}, "speedtest.example.com:8080"},
+	}
+
+	for _, c := range cases {
+		if got := c.server.socketAddr(); got != c.expected {
+			t.Errorf("got: %v, expected: %v", got, c.expected)
+		}
+	}
+}
+
+// newSocketTestServer starts a server speaking the HI/PING/DOWNLOAD/UPLOAD protocol.
+func newSocketTestServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSocketTestConn(conn)
+		}
+	}()
+
+	return l
+}
+
+func serveSocketTestConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "HI":
+			fmt.Fprint(conn, "HELLO 2.9 (2.9.0) 2021-01-01.0000.0000000\n")
+		case "PING":
+			fmt.Fprintf(conn, "PONG %s\n", fields[1])
+		case "DOWNLOAD":
+			var size int64
+			fmt.Sscan(fields[1], &size)
+			fmt.Fprint(conn, "DOWNLOAD ")
+			io.Copy(conn, newPayload(size-len64("DOWNLOAD ")-1, PayloadRepeat))
+			fmt.Fprint(conn, "\n")
+		case "UPLOAD":
+			var size int64
+			fmt.Sscan(fields[1], &size)
+			io.CopyN(ioutil.Discard, r, size-len64(line))
+			fmt.Fprintf(conn, "OK %d 0\n", size)
+		case "QUIT":
+			return
+		}
+	}
+}
+
+func len64(s string) int64 {
+	return int64(len(s))
+}
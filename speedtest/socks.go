@@ -0,0 +1,187 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	socksVersion = 5
+
+	socksAuthNone     = 0x00
+	socksAuthPassword = 0x02
+	socksAuthNoMethod = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksAddrIPv4   = 0x01
+	socksAddrDomain = 0x03
+	socksAddrIPv6   = 0x04
+)
+
+// socksDialer opens connections through a SOCKS5 proxy (RFC 1928), authenticating with the username and password
+// of the proxy URL if present (RFC 1929). Host names are resolved by the proxy for the socks5h scheme
+// and locally otherwise.
+type socksDialer struct {
+	proxy  *url.URL
+	dialer net.Dialer
+}
+
+// proxyAddr returns the address of the proxy, with the default port if the URL has none.
+func (d *socksDialer) proxyAddr() string {
+	if d.proxy.Port() == "" {
+		return net.JoinHostPort(d.proxy.Hostname(), "1080")
+	}
+	return d.proxy.Host
+}
+
+// DialContext connects to addr through the proxy.
+func (d *socksDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("socks5: unsupported network %q", network)
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 0xffff {
+		return nil, fmt.Errorf("socks5: invalid port %q", portStr)
+	}
+	if d.proxy.Scheme != "socks5h" && net.ParseIP(host) == nil {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip"+network[3:], host)
+		if err != nil {
+			return nil, err
+		}
+		host = ips[0].String()
+	}
+
+	conn, err := d.dialer.DialContext(ctx, network, d.proxyAddr())
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	if err := d.handshake(conn, host, port); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// handshake negotiates authentication and requests a connection to host:port.
+func (d *socksDialer) handshake(conn net.Conn, host string, port int) error {
+	methods := []byte{socksAuthNone}
+	if d.proxy.User != nil {
+		methods = append(methods, socksAuthPassword)
+	}
+	if _, err := conn.Write(append([]byte{socksVersion, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("socks5: unexpected version %d", reply[0])
+	}
+	switch reply[1] {
+	case socksAuthNone:
+	case socksAuthPassword:
+		if d.proxy.User == nil {
+			return errors.New("socks5: proxy requires authentication")
+		}
+		if err := d.authenticate(conn); err != nil {
+			return err
+		}
+	case socksAuthNoMethod:
+		return errors.New("socks5: no acceptable authentication method")
+	default:
+		return fmt.Errorf("socks5: unsupported authentication method %d", reply[1])
+	}
+
+	req := []byte{socksVersion, socksCmdConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("socks5: host name too long")
+		}
+		req = append(req, socksAddrDomain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socksAddrIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socksAddrIPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("socks5: connect failed with code %d", head[1])
+	}
+
+	// Skip the bound address, which is of no use for an outgoing connection.
+	var skip int
+	switch head[3] {
+	case socksAddrIPv4:
+		skip = net.IPv4len
+	case socksAddrIPv6:
+		skip = net.IPv6len
+	case socksAddrDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("socks5: unexpected address type %d", head[3])
+	}
+	_, err := io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// authenticate performs the username/password sub-negotiation.
+func (d *socksDialer) authenticate(conn net.Conn) error {
+	user := d.proxy.User.Username()
+	password, _ := d.proxy.User.Password()
+	if len(user) > 255 || len(password) > 255 {
+		return errors.New("socks5: credentials too long")
+	}
+
+	req := []byte{1, byte(len(user))}
+	req = append(req, user...)
+	req = append(req, byte(len(password)))
+	req = append(req, password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return errors.New("socks5: authentication failed")
+	}
+	return nil
+}
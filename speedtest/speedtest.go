@@ -1,13 +1,34 @@
 package speedtest
 
-import "net/http"
+import (
+	"net"
+	"net/http"
+	"net/url"
+)
 
 // Speedtest is a speedtest client.
 type Speedtest struct {
-	doer *http.Client
+	doer      *http.Client
+	dialer    *net.Dialer
+	proxy     *proxy
+	netDialer ContextDialer // custom network stack, nil for the host's
+	userInfo  UserInfoProvider
+
+	// the connection settings of the options, from which New builds doer and proxy once all options have run
+	proxyURL    *url.URL
+	proxyAuth   *ProxyAuth
+	proxyDialer ContextDialer
+	proxyAddr   string
+	connConfigs []ConnConfig
 }
 
 // Option is a function that can be passed to New to modify the Client.
+//
+// The connection options combine the same way whatever their order: connections are opened by the dialer
+// of WithDialer, or else bound as set by WithSourceAddr and WithInterface; they are routed through the proxy
+// of the latest of WithProxy, WithProxyAuth and WithProxyDialer; and the transport is adjusted by WithConnConfig.
+// These settings are installed into a copy of the client of WithDoer, keeping its timeout, cookies and redirect
+// policy, as long as its transport is an *http.Transport; other transports are used as they are for HTTP requests.
 type Option func(*Speedtest)
 
 // WithDoer sets the http.Client used to make requests.
@@ -17,6 +38,104 @@ func WithDoer(doer *http.Client) Option {
 	}
 }
 
+// WithSourceAddr binds every connection to the local address addr, so that tests egress the link that owns it.
+func WithSourceAddr(addr net.IP) Option {
+	return func(s *Speedtest) {
+		s.boundDialer().LocalAddr = &net.TCPAddr{IP: addr}
+	}
+}
+
+// WithInterface binds every connection to the network interface name, so that tests egress that link.
+// On Linux the socket is bound with SO_BINDTODEVICE, which requires CAP_NET_RAW;
+// on other platforms connections are bound to the first address of the interface.
+func WithInterface(name string) Option {
+	return func(s *Speedtest) {
+		bindToInterface(s.boundDialer(), name)
+	}
+}
+
+// WithDialer opens every connection of the client with d, e.g. the dialer of a userspace network stack or tunnel:
+// the HTTP connections of tests and server discovery as well as the connections the package opens itself
+// for socket tests and WebSocket, TCP and UDP latency. ICMP latency needs raw sockets of the host and falls back
+// to the server type's native method, and path tracing is not available.
+// It replaces the binding of WithSourceAddr and WithInterface and the proxies of WithProxy and WithProxyAuth,
+// whatever the order of the options; to route through a proxy with a custom dialer, use WithProxyDialer.
+func WithDialer(d ContextDialer) Option {
+	return func(s *Speedtest) {
+		s.netDialer = d
+	}
+}
+
+// WithUserInfoProvider locates the caller with p instead of speedtest.net, for FetchUserInfo and server discovery.
+func WithUserInfoProvider(p UserInfoProvider) Option {
+	return func(s *Speedtest) {
+		s.userInfo = p
+	}
+}
+
+// boundDialer returns the client's dialer, creating it on first use.
+func (s *Speedtest) boundDialer() *net.Dialer {
+	if s.dialer == nil {
+		s.dialer = &net.Dialer{}
+	}
+	return s.dialer
+}
+
+// buildClient builds doer and proxy from the connection settings of the options, see Option.
+func (s *Speedtest) buildClient() {
+	if s.netDialer != nil {
+		s.dialer = nil
+		s.proxyURL = nil
+	}
+	if s.dialer == nil && s.netDialer == nil && s.proxyURL == nil && s.proxyDialer == nil && len(s.connConfigs) == 0 {
+		if s.doer == nil {
+			s.doer = http.DefaultClient
+		}
+		return
+	}
+
+	var d net.Dialer
+	if s.dialer != nil {
+		d = *s.dialer
+	}
+	route := s.installProxy(d)
+
+	var t *http.Transport
+	switch {
+	case s.doer == nil || s.doer.Transport == nil:
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	default:
+		custom, ok := s.doer.Transport.(*http.Transport)
+		if !ok {
+			// The transport cannot be adjusted; the settings still apply to the connections the package opens itself.
+			return
+		}
+		t = custom.Clone()
+	}
+
+	switch {
+	case s.netDialer != nil:
+		t.DialContext = s.netDialer.DialContext
+	case s.dialer != nil:
+		t.DialContext = d.DialContext
+	}
+	if route != nil {
+		route(t)
+	}
+
+	c := &http.Client{}
+	if s.doer != nil {
+		*c = *s.doer
+	}
+	c.Transport = t
+	for _, cc := range s.connConfigs {
+		if adjusted, err := cc.apply(c); err == nil {
+			c = adjusted
+		}
+	}
+	s.doer = c
+}
+
 // New creates a new speedtest client.
 func New(opts ...Option) *Speedtest {
 	s := &Speedtest{
@@ -26,6 +145,7 @@ func New(opts ...Option) *Speedtest {
 	for _, opt := range opts {
 		opt(s)
 	}
+	s.buildClient()
 
 	return s
 }
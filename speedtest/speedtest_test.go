@@ -1,8 +1,14 @@
 package speedtest
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -23,4 +29,116 @@ func TestNew(t *testing.T) {
 		}
 	})
 
+	t.Run("SourceAddr", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer ts.Close()
+		l := newSocketTestServer(t)
+		defer l.Close()
+
+		c := New(WithSourceAddr(net.ParseIP("127.0.0.1")))
+		if c.dialer == nil || c.doer == http.DefaultClient {
+			t.Fatal("source address is not bound")
+		}
+		server, err := c.CustomServer(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := server.PingTest(); err != nil {
+			t.Error(err)
+		}
+
+		// 192.0.2.1 is reserved for documentation, so binding to it must fail for both protocols.
+		c = New(WithSourceAddr(net.ParseIP("192.0.2.1")))
+		server, _ = c.CustomServer(ts.URL)
+		if err := server.PingTest(); err == nil {
+			t.Error("expected an error binding to a foreign address")
+		}
+		server, _ = c.CustomServer("http://" + l.Addr().String())
+		server.Type = OoklaSocketServer
+		if err := server.PingTest(); err == nil {
+			t.Error("expected an error binding to a foreign address")
+		}
+	})
+
+	t.Run("OptionOrder", func(t *testing.T) {
+		d := &countingDialer{}
+		proxyURL, _ := url.Parse("http://127.0.0.1:3128")
+		for _, opts := range [][]Option{
+			{WithDialer(d), WithSourceAddr(net.ParseIP("127.0.0.1")), WithProxy(proxyURL)},
+			{WithProxy(proxyURL), WithSourceAddr(net.ParseIP("127.0.0.1")), WithDialer(d)},
+		} {
+			c := New(opts...)
+			if c.netDialer != d || c.dialer != nil || c.proxy != nil {
+				t.Errorf("got dialer %v and proxy %v, expected only the custom dialer", c.dialer, c.proxy)
+			}
+		}
+
+		doer := &http.Client{Timeout: time.Minute}
+		for _, opts := range [][]Option{
+			{WithDoer(doer), WithSourceAddr(net.ParseIP("127.0.0.1")), WithConnConfig(ConnConfig{MaxConnsPerHost: 2})},
+			{WithConnConfig(ConnConfig{MaxConnsPerHost: 2}), WithSourceAddr(net.ParseIP("127.0.0.1")), WithDoer(doer)},
+		} {
+			c := New(opts...)
+			tr, ok := c.doer.Transport.(*http.Transport)
+			if c.dialer == nil || c.doer.Timeout != time.Minute || !ok || tr.MaxConnsPerHost != 2 {
+				t.Errorf("got %+v, expected the custom client to be bound and adjusted", c.doer)
+			}
+		}
+	})
+
+	t.Run("Dialer", func(t *testing.T) {
+		ts := newLibrespeedTestServer(true)
+		defer ts.Close()
+		l := newSocketTestServer(t)
+		defer l.Close()
+
+		d := &countingDialer{}
+		c := New(WithDialer(d))
+		server, err := c.CustomServer(ts.URL + "/backend")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.Type = LibrespeedServer
+		if err := server.PingTestWithConfig(context.Background(), NewTestConfig(WithPingCount(2), WithLatencyMethod(LatencyWebSocket))); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.DownloadTestWithConfig(context.Background(), NewTestConfig(WithSavingMode(true), WithNetwork("tcp4"))); err != nil {
+			t.Fatal(err)
+		}
+		if server.LatencyMethod != LatencyWebSocket || d.count("tcp") == 0 || d.count("tcp4") == 0 {
+			t.Errorf("got %v connections over %v, expected the WebSocket and HTTP connections to be dialed", d.dials, server.LatencyMethod)
+		}
+		if err := server.TracePath(context.Background(), TestConfig{}); err == nil {
+			t.Error("expected path tracing to be unavailable")
+		}
+
+		server, _ = c.CustomServer("http://" + l.Addr().String())
+		server.Type = OoklaSocketServer
+		before := d.count("tcp")
+		if err := server.PingTest(); err != nil || d.count("tcp") != before+1 {
+			t.Errorf("got %v, expected the socket connection to be dialed", err)
+		}
+	})
+}
+
+// countingDialer counts the connections it opens by network.
+type countingDialer struct {
+	mu    sync.Mutex
+	dials map[string]int
+}
+
+func (d *countingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	if d.dials == nil {
+		d.dials = map[string]int{}
+	}
+	d.dials[network]++
+	d.mu.Unlock()
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
+
+func (d *countingDialer) count(network string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dials[network]
 }
@@ -0,0 +1,34 @@
+package speedtesttest_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+	"github.com/showwin/speedtest-go/speedtest/speedtesttest"
+)
+
+func Example() {
+	ts := speedtesttest.NewServer(speedtesttest.Config{DownloadMbps: 20, UploadMbps: 10, Latency: 10 * time.Millisecond})
+	defer ts.Close()
+
+	server, err := speedtest.New().CustomServer(ts.SpeedtestURL())
+	if err != nil {
+		panic(err)
+	}
+	cfg := speedtest.NewTestConfig(
+		speedtest.WithDuration(time.Second),
+		// Stop the transfers still in flight at the end of the second, rather than waiting for them.
+		speedtest.WithDrain(100*time.Millisecond),
+		speedtest.WithPingCount(3),
+	)
+	if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+		panic(err)
+	}
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+		panic(err)
+	}
+	fmt.Println(server.MinLatency >= 10*time.Millisecond, server.DLSpeed > 10 && server.DLSpeed <= 22)
+	// Output: true true
+}
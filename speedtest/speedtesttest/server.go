@@ -0,0 +1,324 @@
+// Package speedtesttest provides an in-process speedtest.net and LibreSpeed server for tests, with bandwidth shaping,
+// latency injection and error injection, so that tests of the speedtest package and of its users are reproducible
+// and do not touch the internet:
+//
+//	ts := speedtesttest.NewServer(speedtesttest.Config{DownloadMbps: 50, Latency: 20 * time.Millisecond})
+//	defer ts.Close()
+//	server, _ := speedtest.New().CustomServer(ts.SpeedtestURL())
+//	err := server.DownloadTestWithConfig(ctx, speedtest.NewTestConfig(speedtest.WithDuration(time.Second)))
+//
+// Random delays and injected errors are drawn from a source seeded with Config.Seed, so that a sequence of requests
+// sees the same delays and errors on every run.
+package speedtesttest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// chunkSize is the size of the writes and reads shaped by the server, and librespeedChunkSize the size of a
+// garbage.php chunk.
+const (
+	chunkSize           = 16 * 1024
+	librespeedChunkSize = 1024 * 1024
+)
+
+// Config controls the behaviour of a Server. The zero value serves every request at once and at full speed.
+type Config struct {
+	// DownloadMbps and UploadMbps cap the rate in Mbit/s at which payloads are sent and received, shared by all
+	// connections, like the shaper of an access link. 0 means no cap.
+	// The client counts an upload as sent once its socket buffer takes it, and that buffer holds megabytes on the
+	// loopback interface, so uploads shorter than a few seconds measure faster than UploadMbps; Stats tells what
+	// the server received.
+	DownloadMbps float64
+	UploadMbps   float64
+	// Latency delays every response, and Jitter adds a random delay of up to Jitter to it.
+	Latency time.Duration
+	Jitter  time.Duration
+	// ErrorRate is the fraction of requests, from 0 to 1, answered with ErrorStatus instead of being served.
+	ErrorRate float64
+	// ErrorStatus is the status of injected errors. 0 means 500.
+	ErrorStatus int
+	// Inject, when set, is called with every request and returns the status to answer it with instead of serving it,
+	// or 0 to serve it, e.g. to fail the uploads only.
+	Inject func(r *http.Request) int
+	// Seed seeds the random delays and errors.
+	Seed int64
+}
+
+// Stats counts the requests a Server answered, injected errors excluded, and the payload bytes it moved.
+type Stats struct {
+	Pings           int64
+	Downloads       int64
+	Uploads         int64
+	Errors          int64 // injected errors
+	BytesDownloaded int64 // sent to clients
+	BytesUploaded   int64 // received from clients
+}
+
+// Server is a speedtest.net and LibreSpeed server listening on a system-chosen port of the local loopback interface.
+type Server struct {
+	*httptest.Server
+
+	cfg      Config
+	download *shaper
+	upload   *shaper
+
+	mu   sync.Mutex
+	rand *rand.Rand
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	stats Stats
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when finished, to shut it down.
+func NewServer(cfg Config) *Server {
+	s := newServer(cfg)
+	s.Server = httptest.NewServer(s.handler())
+	return s
+}
+
+// NewTLSServer starts and returns a new Server using TLS. Its Client trusts the server's certificate.
+func NewTLSServer(cfg Config) *Server {
+	s := newServer(cfg)
+	s.Server = httptest.NewTLSServer(s.handler())
+	return s
+}
+
+func newServer(cfg Config) *Server {
+	return &Server{
+		cfg:      cfg,
+		download: newShaper(cfg.DownloadMbps),
+		upload:   newShaper(cfg.UploadMbps),
+		rand:     rand.New(rand.NewSource(cfg.Seed)),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Close interrupts the requests being shaped or delayed and shuts the server down.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+	s.Server.Close()
+}
+
+// SpeedtestURL returns the URL of the upload.php endpoint of the speedtest.net server, for Speedtest.CustomServer.
+func (s *Server) SpeedtestURL() string {
+	return s.URL + "/speedtest/upload.php"
+}
+
+// LibreSpeedURL returns the URL of the LibreSpeed backend directory, for Speedtest.CustomServer.
+// The type of the returned server must be set to LibrespeedServer.
+func (s *Server) LibreSpeedURL() string {
+	return s.URL + "/backend/"
+}
+
+// Stats returns the counts of the requests answered so far.
+func (s *Server) Stats() Stats {
+	return Stats{
+		Pings:           atomic.LoadInt64(&s.stats.Pings),
+		Downloads:       atomic.LoadInt64(&s.stats.Downloads),
+		Uploads:         atomic.LoadInt64(&s.stats.Uploads),
+		Errors:          atomic.LoadInt64(&s.stats.Errors),
+		BytesDownloaded: atomic.LoadInt64(&s.stats.BytesDownloaded),
+		BytesUploaded:   atomic.LoadInt64(&s.stats.BytesUploaded),
+	}
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/speedtest/latency.txt", s.servePing("test=test\n"))
+	mux.HandleFunc("/speedtest/upload.php", s.serveUpload)
+	mux.HandleFunc("/speedtest/", s.serveRandom)
+	mux.HandleFunc("/backend/empty.php", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			s.serveUpload(w, r)
+			return
+		}
+		s.servePing("")(w, r)
+	})
+	mux.HandleFunc("/backend/garbage.php", s.serveGarbage)
+	mux.HandleFunc("/backend/getIP.php", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "127.0.0.1")
+	})
+	return s.inject(mux)
+}
+
+// inject delays every request and answers the ones picked by the error injection with an error.
+func (s *Server) inject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		delay := s.cfg.Latency
+		if s.cfg.Jitter > 0 {
+			delay += time.Duration(s.rand.Int63n(int64(s.cfg.Jitter) + 1))
+		}
+		fail := s.cfg.ErrorRate > 0 && s.rand.Float64() < s.cfg.ErrorRate
+		s.mu.Unlock()
+
+		if err := s.sleep(r.Context(), delay); err != nil {
+			return
+		}
+		status := 0
+		if s.cfg.Inject != nil {
+			status = s.cfg.Inject(r)
+		}
+		if status == 0 && fail {
+			status = s.cfg.ErrorStatus
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+		}
+		if status != 0 {
+			atomic.AddInt64(&s.stats.Errors, 1)
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) servePing(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.stats.Pings, 1)
+		io.WriteString(w, body)
+	}
+}
+
+// serveRandom serves random{N}x{N}.jpg, of N*N*2 bytes.
+func (s *Server) serveRandom(w http.ResponseWriter, r *http.Request) {
+	var n, m int
+	if _, err := fmt.Sscanf(r.URL.Path, "/speedtest/random%dx%d.jpg", &n, &m); err != nil || n != m || n <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	s.serveDownload(w, r, int64(n)*int64(n)*2)
+}
+
+// serveGarbage serves ckSize chunks of 1 MiB, 4 by default, as garbage.php does.
+func (s *Server) serveGarbage(w http.ResponseWriter, r *http.Request) {
+	chunks := 4
+	if v := r.URL.Query().Get("ckSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1024 {
+			http.Error(w, "invalid ckSize", http.StatusBadRequest)
+			return
+		}
+		chunks = n
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	s.serveDownload(w, r, int64(chunks)*librespeedChunkSize)
+}
+
+// serveDownload writes size bytes of payload at the download rate.
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request, size int64) {
+	atomic.AddInt64(&s.stats.Downloads, 1)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	buf := make([]byte, chunkSize)
+	for i := range buf {
+		buf[i] = byte('0' + i%10)
+	}
+	for size > 0 {
+		n := int64(len(buf))
+		if size < n {
+			n = size
+		}
+		if err := s.sleep(r.Context(), s.download.reserve(int(n))); err != nil {
+			return
+		}
+		written, err := w.Write(buf[:n])
+		atomic.AddInt64(&s.stats.BytesDownloaded, int64(written))
+		if err != nil {
+			return
+		}
+		size -= n
+	}
+}
+
+// serveUpload reads the request body at the upload rate and answers with its size, as upload.php does.
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	atomic.AddInt64(&s.stats.Uploads, 1)
+	buf := make([]byte, chunkSize)
+	var total int64
+	for {
+		n, err := r.Body.Read(buf)
+		if n > 0 {
+			total += int64(n)
+			atomic.AddInt64(&s.stats.BytesUploaded, int64(n))
+			if err := s.sleep(r.Context(), s.upload.reserve(n)); err != nil {
+				return
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return
+		}
+	}
+	io.Copy(ioutil.Discard, r.Body)
+	fmt.Fprintf(w, "size=%d", total)
+}
+
+// shaper paces the bytes of all connections at a shared rate: each transfer is scheduled after the previous ones,
+// without credit for idle time, so that bursts do not exceed the rate.
+type shaper struct {
+	rate float64 // bytes per second
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newShaper returns a shaper of mbps Mbit/s, or nil for no cap.
+func newShaper(mbps float64) *shaper {
+	if mbps <= 0 {
+		return nil
+	}
+	return &shaper{rate: mbps * 1000 * 1000 / 8}
+}
+
+// reserve schedules the transfer of n bytes and returns how long to wait for it. A nil shaper does not wait.
+func (s *shaper) reserve(n int) time.Duration {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.next.Before(now) {
+		s.next = now
+	}
+	s.next = s.next.Add(time.Duration(float64(n) / s.rate * float64(time.Second)))
+	return s.next.Sub(now)
+}
+
+// sleep waits for d, or until ctx is done or the server is closed.
+func (s *Server) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.closed:
+		return http.ErrServerClosed
+	}
+}
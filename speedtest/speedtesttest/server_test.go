@@ -0,0 +1,120 @@
+package speedtesttest
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, url string) (int, int64) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, n
+}
+
+func TestServerEndpoints(t *testing.T) {
+	ts := NewServer(Config{})
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		path string
+		size int64
+	}{
+		{"/speedtest/latency.txt", 10},
+		{"/speedtest/random350x350.jpg", 350 * 350 * 2},
+		{"/backend/empty.php", 0},
+		{"/backend/garbage.php?ckSize=2", 2 * librespeedChunkSize},
+	} {
+		if status, n := get(t, ts.URL+tc.path); status != http.StatusOK || n != tc.size {
+			t.Errorf("%s: got status %v and %v bytes, expected %v bytes", tc.path, status, n, tc.size)
+		}
+	}
+	if status, _ := get(t, ts.URL+"/speedtest/random.jpg"); status != http.StatusNotFound {
+		t.Errorf("got status %v for an unknown image", status)
+	}
+
+	for _, url := range []string{ts.SpeedtestURL(), ts.LibreSpeedURL() + "empty.php"} {
+		resp, err := http.Post(url, "application/x-www-form-urlencoded", strings.NewReader(strings.Repeat("0", 50000)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: got status %v", url, resp.StatusCode)
+		}
+	}
+
+	st := ts.Stats()
+	if st.Pings != 2 || st.Downloads != 2 || st.Uploads != 2 || st.BytesUploaded != 100000 || st.BytesDownloaded != 350*350*2+2*librespeedChunkSize {
+		t.Errorf("got unexpected stats %+v", st)
+	}
+}
+
+func TestServerShaping(t *testing.T) {
+	ts := NewServer(Config{DownloadMbps: 8, Latency: 20 * time.Millisecond})
+	defer ts.Close()
+
+	start := time.Now()
+	// 100x100 is 20000 bytes, 20ms at 8 Mbit/s, after the latency.
+	get(t, ts.URL+"/speedtest/random100x100.jpg")
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("got download in %v, expected about 40ms", elapsed)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	statuses := func(cfg Config) []int {
+		ts := NewServer(cfg)
+		defer ts.Close()
+		var got []int
+		for i := 0; i < 20; i++ {
+			status, _ := get(t, ts.URL+"/speedtest/latency.txt")
+			got = append(got, status)
+		}
+		if errors := ts.Stats().Errors; cfg.ErrorRate > 0 && (errors == 0 || errors == 20) {
+			t.Errorf("got %v errors in 20 requests at rate %v", errors, cfg.ErrorRate)
+		}
+		return got
+	}
+
+	cfg := Config{ErrorRate: 0.5, ErrorStatus: http.StatusServiceUnavailable, Seed: 1}
+	a, b := statuses(cfg), statuses(cfg)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("got %v and %v, expected the same errors for the same seed", a, b)
+		}
+		if a[i] != http.StatusOK && a[i] != http.StatusServiceUnavailable {
+			t.Fatalf("got unexpected status %v", a[i])
+		}
+	}
+
+	ts := NewServer(Config{Inject: func(r *http.Request) int {
+		if r.Method == http.MethodPost {
+			return http.StatusForbidden
+		}
+		return 0
+	}})
+	defer ts.Close()
+	resp, err := http.Post(ts.SpeedtestURL(), "text/plain", strings.NewReader("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("got status %v, expected the upload to fail", resp.StatusCode)
+	}
+	if status, _ := get(t, ts.URL+"/speedtest/latency.txt"); status != http.StatusOK {
+		t.Errorf("got status %v, expected the ping to be served", status)
+	}
+}
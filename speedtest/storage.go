@@ -0,0 +1,115 @@
+package speedtest
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// lockedWriter serializes the writes of concurrent streams to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// downloadSink returns the writer receiving the payloads of the main phase of a download test, nil to discard them,
+// and a function to call when the test is done.
+func (cfg TestConfig) downloadSink() (io.Writer, func() error, error) {
+	var sinks []io.Writer
+	closeSink := func() error { return nil }
+	if cfg.DownloadWriter != nil {
+		sinks = append(sinks, cfg.DownloadWriter)
+	}
+	if cfg.DownloadTempFile {
+		f, err := ioutil.TempFile("", "speedtest-download-*")
+		if err != nil {
+			return nil, nil, err
+		}
+		sinks = append(sinks, f)
+		closeSink = func() error {
+			err := f.Close()
+			if rmErr := os.Remove(f.Name()); err == nil {
+				err = rmErr
+			}
+			return err
+		}
+	}
+
+	switch len(sinks) {
+	case 0:
+		return nil, closeSink, nil
+	case 1:
+		return &lockedWriter{w: sinks[0]}, closeSink, nil
+	default:
+		return &lockedWriter{w: io.MultiWriter(sinks...)}, closeSink, nil
+	}
+}
+
+// uploadPayload returns the function filling HTTP upload payloads of the given size, from UploadSource if set.
+func (cfg TestConfig) uploadPayload() func(int64) io.Reader {
+	if cfg.UploadSource != nil && cfg.UploadSourceSize > 0 {
+		src := &sourcePayload{src: cfg.UploadSource, size: cfg.UploadSourceSize}
+		return src.payload
+	}
+	return patternPayload(cfg.PayloadPattern)
+}
+
+// patternPayload returns the function generating payloads of pattern.
+func patternPayload(pattern PayloadPattern) func(int64) io.Reader {
+	return func(size int64) io.Reader {
+		return newPayload(size, pattern)
+	}
+}
+
+// sourcePayload reads payloads from the size bytes of src in turn, wrapping around at the end,
+// so that concurrent uploads read different parts of the source.
+type sourcePayload struct {
+	src  io.ReaderAt
+	size int64
+	off  int64
+}
+
+// payload returns a reader of the next n bytes of the source.
+func (p *sourcePayload) payload(n int64) io.Reader {
+	start := (atomic.AddInt64(&p.off, n) - n) % p.size
+	return &cyclicReader{src: p.src, size: p.size, pos: start, remaining: n}
+}
+
+// cyclicReader reads remaining bytes from src starting at pos, continuing at the start of src after its size bytes.
+type cyclicReader struct {
+	src       io.ReaderAt
+	size      int64
+	pos       int64
+	remaining int64
+}
+
+func (r *cyclicReader) Read(b []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > r.remaining {
+		b = b[:r.remaining]
+	}
+	if int64(len(b)) > r.size-r.pos {
+		b = b[:r.size-r.pos]
+	}
+
+	n, err := r.src.ReadAt(b, r.pos)
+	if err == io.EOF && n == len(b) {
+		err = nil
+	}
+	if err == nil && n == 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	r.pos = (r.pos + int64(n)) % r.size
+	r.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,59 @@
+package speedtest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadWriter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(serveRandomImage))
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/speedtest/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	cfg := NewTestConfig(WithSavingMode(true), WithDownloadWriter(&buf), WithDownloadTempFile())
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if r := server.Result(); int64(buf.Len()) != r.DLBytes {
+		t.Errorf("got %v bytes written, expected %v", buf.Len(), r.DLBytes)
+	}
+}
+
+func TestUploadSource(t *testing.T) {
+	src := &sourcePayload{src: strings.NewReader("abcdefghij"), size: 10}
+	for _, expected := range []string{"abcdefghijabcdefghijabcde", "fghij", "abc"} {
+		b, err := ioutil.ReadAll(src.payload(int64(len(expected))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Errorf("got payload %q, expected %q", b, expected)
+		}
+	}
+
+	var received []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	server := &Server{URL: ts.URL + "/upload.php"}
+	cfg := NewTestConfig(WithUploadSource(strings.NewReader("0123456789abcdef"), 16))
+	_, upload := server.httpUploadFuncs(standardProtocol{}, cfg.uploadPayload())
+	if err := upload(context.Background(), http.DefaultClient, 0, &meter{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(received, []byte(uploadFormPrefix+"0123456789abcdef0123")) {
+		t.Errorf("got unexpected body %.40q", received)
+	}
+}
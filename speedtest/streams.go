@@ -0,0 +1,130 @@
+package speedtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// StreamStats describes one stream of the main phase of a download or upload test.
+// Comparing streams reveals limits that aggregate numbers hide, such as a throttled flow or path.
+type StreamStats struct {
+	Requests int // completed requests
+	Bytes    int64
+	Duration time.Duration
+	// StatusCode is the status of the last HTTP response, 0 for the socket protocol.
+	StatusCode int
+	// ReusedConns is the number of requests sent on a reused connection.
+	ReusedConns int
+	// RemoteIP is the address of the latest connection of the stream, the proxy's for proxied tests.
+	RemoteIP string
+	// Error is the error that stopped the stream, if any.
+	Error string
+}
+
+type streamKey struct{}
+
+// stream collects the statistics of one stream. Its requests find it in their context.
+type stream struct {
+	m     *meter
+	start time.Time
+
+	mu    sync.Mutex
+	stats StreamStats
+}
+
+// streamSet creates the streams of a test, counting their bytes with m, and collects their statistics.
+type streamSet struct {
+	m *meter
+
+	mu      sync.Mutex
+	streams []*stream
+	drain   *drainWindow // set when the main phase was drained at its deadline
+}
+
+func newStreamSet(m *meter) *streamSet {
+	return &streamSet{m: m}
+}
+
+// add starts a new stream.
+func (set *streamSet) add() *stream {
+	st := &stream{m: &meter{parent: set.m, sink: set.m.sink}, start: time.Now()}
+	set.mu.Lock()
+	set.streams = append(set.streams, st)
+	set.mu.Unlock()
+	return st
+}
+
+func (set *streamSet) setDrainWindow(w *drainWindow) {
+	set.mu.Lock()
+	set.drain = w
+	set.mu.Unlock()
+}
+
+// drainWindow returns the part of the main phase until its deadline if its streams were drained, nil otherwise.
+func (set *streamSet) drainWindow() *drainWindow {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	return set.drain
+}
+
+// stats returns the statistics of every stream in the order they were started.
+func (set *streamSet) stats() []StreamStats {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	stats := make([]StreamStats, len(set.streams))
+	for i, st := range set.streams {
+		st.mu.Lock()
+		stats[i] = st.stats
+		st.mu.Unlock()
+		stats[i].Bytes = int64(st.m.total())
+	}
+	return stats
+}
+
+// do runs request on the stream, recording its outcome.
+func (st *stream) do(ctx context.Context, request func(context.Context, *meter) error) error {
+	err := request(context.WithValue(ctx, streamKey{}, st), st.m)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.stats.Duration = time.Since(st.start)
+	if err != nil {
+		st.stats.Error = err.Error()
+		return err
+	}
+	st.stats.Requests++
+	return nil
+}
+
+// traceStream returns req with a trace recording connection reuse in the stream of its context, if any.
+// The stream, which may be nil, records the response status with observe.
+func traceStream(req *http.Request) (*http.Request, *stream) {
+	st, _ := req.Context().Value(streamKey{}).(*stream)
+	if st == nil {
+		return req, nil
+	}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			recordRemote(req.Context(), info.Conn.RemoteAddr())
+			if info.Reused {
+				st.mu.Lock()
+				st.stats.ReusedConns++
+				st.mu.Unlock()
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), st
+}
+
+// observe records the status of resp.
+func (st *stream) observe(resp *http.Response) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	st.stats.StatusCode = resp.StatusCode
+	st.mu.Unlock()
+}
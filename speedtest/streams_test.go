@@ -0,0 +1,67 @@
+package speedtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDownloadTestStreams(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(serveRandomImage))
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/speedtest/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.DownloadTestWithConfig(context.Background(), NewTestConfig(WithSavingMode(true))); err != nil {
+		t.Fatal(err)
+	}
+
+	r := server.Result()
+	if len(r.DLStreams) != 6 {
+		t.Fatalf("got %v streams, expected 6", len(r.DLStreams))
+	}
+	var bytes int64
+	for i, st := range r.DLStreams {
+		if st.Requests != 1 || st.StatusCode != http.StatusOK || st.Duration <= 0 || st.Error != "" {
+			t.Errorf("got unexpected stream %v: %+v", i, st)
+		}
+		bytes += st.Bytes
+	}
+	if bytes != r.DLBytes {
+		t.Errorf("got %v bytes over all streams, expected %v", bytes, r.DLBytes)
+	}
+}
+
+func TestStreamStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(serveRandomImage))
+	defer ts.Close()
+
+	set := newStreamSet(&meter{})
+	st := set.add()
+	_, request := (&Server{URL: ts.URL + "/upload.php"}).httpDownloadFuncs(standardProtocol{})
+	for i := 0; i < 3; i++ {
+		if err := st.do(context.Background(), func(ctx context.Context, m *meter) error {
+			return request(ctx, http.DefaultClient, 0, m)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts.Close()
+	if err := st.do(context.Background(), func(ctx context.Context, m *meter) error {
+		return request(ctx, http.DefaultClient, 0, m)
+	}); err == nil {
+		t.Fatal("expected an error from a closed server")
+	}
+
+	stats := set.stats()
+	if len(stats) != 1 {
+		t.Fatalf("got %v streams, expected 1", len(stats))
+	}
+	s := stats[0]
+	if s.Requests != 3 || s.Bytes != 3*int64(dlPayload(0)) || s.ReusedConns != 2 || s.StatusCode != http.StatusOK || s.Error == "" {
+		t.Errorf("got unexpected stream %+v", s)
+	}
+}
@@ -0,0 +1,186 @@
+package speedtest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// PhaseTiming breaks down the HTTP requests of a test phase into averages, telling a slow server, with a long TTFB,
+// from a slow path, with long connection setup. DNS, Connect and TLS are measured for the connections the phase opened,
+// TTFB, the time from a request being written to the first byte of its response, for every request.
+type PhaseTiming struct {
+	DNS     time.Duration `json:"dns"`
+	Connect time.Duration `json:"connect"`
+	TLS     time.Duration `json:"tls"`
+	TTFB    time.Duration `json:"ttfb"`
+	// Connections is the number of connections opened and Requests the number of requests answered.
+	Connections int `json:"connections"`
+	Requests    int `json:"requests"`
+}
+
+// phaseTimingJSON is the wire format of PhaseTiming.
+type phaseTimingJSON struct {
+	DNS         float64 `json:"dns_ms"`
+	Connect     float64 `json:"connect_ms"`
+	TLS         float64 `json:"tls_ms"`
+	TTFB        float64 `json:"ttfb_ms"`
+	Connections int     `json:"connections"`
+	Requests    int     `json:"requests"`
+}
+
+// MarshalJSON encodes the timing in milliseconds.
+func (p PhaseTiming) MarshalJSON() ([]byte, error) {
+	return json.Marshal(phaseTimingJSON{
+		milliseconds(p.DNS), milliseconds(p.Connect), milliseconds(p.TLS), milliseconds(p.TTFB), p.Connections, p.Requests,
+	})
+}
+
+// UnmarshalJSON decodes a timing encoded by MarshalJSON.
+func (p *PhaseTiming) UnmarshalJSON(data []byte) error {
+	var v phaseTimingJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = PhaseTiming{
+		fromMilliseconds(v.DNS), fromMilliseconds(v.Connect), fromMilliseconds(v.TLS), fromMilliseconds(v.TTFB), v.Connections, v.Requests,
+	}
+	return nil
+}
+
+// Timings holds the PhaseTiming of the latest latency, download and upload tests.
+// Phases that were not run over HTTP, such as ICMP latency tests and socket servers, are left zero.
+type Timings struct {
+	Latency  PhaseTiming `json:"latency"`
+	Download PhaseTiming `json:"download"`
+	Upload   PhaseTiming `json:"upload"`
+}
+
+type timingKey struct{}
+
+// timingCollector sums the timing of the requests made with a context returned by withTiming.
+type timingCollector struct {
+	mu                      sync.Mutex
+	dns, connect, tls, ttfb durationSum
+}
+
+type durationSum struct {
+	total time.Duration
+	n     int
+}
+
+func (d *durationSum) add(v time.Duration) {
+	d.total += v
+	d.n++
+}
+
+func (d durationSum) mean() time.Duration {
+	if d.n == 0 {
+		return 0
+	}
+	return d.total / time.Duration(d.n)
+}
+
+// withTiming returns a context recording the timing of the HTTP requests made with it in c. A nil c stops recording.
+func withTiming(ctx context.Context, c *timingCollector) context.Context {
+	return context.WithValue(ctx, timingKey{}, c)
+}
+
+// traceTiming returns req with a trace recording its timing in the collector of its context, if any.
+func traceTiming(req *http.Request) *http.Request {
+	c, _ := req.Context().Value(timingKey{}).(*timingCollector)
+	if c == nil {
+		return req
+	}
+
+	// Hooks may run on other goroutines, and dials to several addresses concurrently.
+	var mu sync.Mutex
+	var dnsStart, connectStart, tlsStart, wrote time.Time
+	var connected bool
+	since := func(start time.Time, sum *durationSum) {
+		if start.IsZero() {
+			return
+		}
+		d := time.Since(start)
+		c.mu.Lock()
+		sum.add(d)
+		c.mu.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			since(dnsStart, &c.dns)
+		},
+		ConnectStart: func(string, string) {
+			mu.Lock()
+			if connectStart.IsZero() {
+				connectStart = time.Now()
+			}
+			mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil && !connected {
+				connected = true
+				since(connectStart, &c.connect)
+			}
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStart = time.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				since(tlsStart, &c.tls)
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			wrote = time.Now()
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			since(wrote, &c.ttfb)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// summary returns the timing recorded so far, reporting false if no request was answered nor connection opened.
+func (c *timingCollector) summary() (PhaseTiming, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := PhaseTiming{
+		DNS:         c.dns.mean(),
+		Connect:     c.connect.mean(),
+		TLS:         c.tls.mean(),
+		TTFB:        c.ttfb.mean(),
+		Connections: c.connect.n,
+		Requests:    c.ttfb.n,
+	}
+	return t, t.Connections > 0 || t.Requests > 0
+}
+
+// timings returns Server.Timings, allocating it first if needed.
+func (s *Server) timings() *Timings {
+	if s.Timings == nil {
+		s.Timings = &Timings{}
+	}
+	return s.Timings
+}
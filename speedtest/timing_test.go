@@ -0,0 +1,49 @@
+package speedtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "latency.txt") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		serveRandomImage(w, r)
+	}))
+	defer ts.Close()
+
+	// Connect by name so that the DNS lookup is traced too.
+	url := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	server, err := New().CustomServer(url + "/speedtest/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewTestConfig(WithPingCount(3), WithSavingMode(true), WithTLSConfig(TLSConfig{InsecureSkipVerify: true}))
+	if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	timings := server.Result().Timings
+	if timings == nil {
+		t.Fatal("timings were not recorded")
+	}
+	l := timings.Latency
+	if l.Requests != 3 || l.Connections != 1 || l.DNS <= 0 || l.Connect <= 0 || l.TLS <= 0 || l.TTFB < 20*time.Millisecond {
+		t.Errorf("got unexpected latency timing %+v", l)
+	}
+	if d := timings.Download; d.Requests == 0 || d.Connections == 0 || d.TTFB <= 0 {
+		t.Errorf("got unexpected download timing %+v", d)
+	}
+	if timings.Upload != (PhaseTiming{}) {
+		t.Errorf("got unexpected upload timing %+v", timings.Upload)
+	}
+}
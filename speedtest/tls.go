@@ -0,0 +1,85 @@
+package speedtest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// TLSConfig controls how the TLS connections of a test are verified.
+// The zero value keeps the settings of the client's transport.
+type TLSConfig struct {
+	// RootCAs are the certificate authorities server certificates are verified against.
+	// nil uses the system roots. See LoadCertPool.
+	RootCAs *x509.CertPool
+	// InsecureSkipVerify accepts any server certificate. Only use it for testing against servers with self-signed certificates.
+	InsecureSkipVerify bool
+	// ServerName overrides the host name certificates are verified for and sent in SNI.
+	ServerName string
+	// MinVersion is the minimum TLS version accepted, e.g. tls.VersionTLS12. 0 uses the crypto/tls default.
+	MinVersion uint16
+}
+
+// WithTLSConfig sets the TLS settings of TestConfig, used by the connections the test opens.
+func WithTLSConfig(tc TLSConfig) TestOption {
+	return func(cfg *TestConfig) {
+		cfg.ConnConfig.TLS = &tc
+	}
+}
+
+// clientConfig returns a copy of base, or a new configuration if base is nil, adjusted by tc.
+// A nil tc leaves base unchanged.
+func (tc *TLSConfig) clientConfig(base *tls.Config) *tls.Config {
+	var c *tls.Config
+	if base == nil {
+		c = &tls.Config{}
+	} else {
+		c = base.Clone()
+	}
+	if tc == nil {
+		return c
+	}
+
+	if tc.RootCAs != nil {
+		c.RootCAs = tc.RootCAs
+	}
+	if tc.InsecureSkipVerify {
+		c.InsecureSkipVerify = true
+	}
+	if tc.ServerName != "" {
+		c.ServerName = tc.ServerName
+	}
+	if tc.MinVersion != 0 {
+		c.MinVersion = tc.MinVersion
+	}
+	return c
+}
+
+// LoadCertPool returns the system certificate pool extended by the PEM encoded certificates in the given files,
+// for use as TLSConfig.RootCAs.
+func LoadCertPool(paths ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, path := range paths {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", path)
+		}
+	}
+	return pool, nil
+}
+
+// InsecureTransport returns a copy of the default transport that accepts any server certificate,
+// for testing against servers with self-signed certificates.
+func InsecureTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = (&TLSConfig{InsecureSkipVerify: true}).clientConfig(t.TLSClientConfig)
+	return t
+}
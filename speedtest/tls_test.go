@@ -0,0 +1,98 @@
+package speedtest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(serveRandomImage))
+	defer ts.Close()
+
+	newServer := func() *Server {
+		return &Server{URL: ts.URL + "/speedtest/upload.php", doer: &http.Client{}}
+	}
+
+	if err := newServer().PingTestWithConfig(context.Background(), NewTestConfig(WithPingCount(1))); err == nil {
+		t.Error("expected the self-signed certificate to be rejected")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	for _, tc := range []TLSConfig{
+		{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		{InsecureSkipVerify: true},
+	} {
+		cfg := NewTestConfig(WithPingCount(1), WithSavingMode(true), WithTLSConfig(tc))
+		server := newServer()
+		if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.DownloadTestWithConfig(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+		if server.DLSpeed <= 0 {
+			t.Errorf("got unexpected DLSpeed '%v'", server.DLSpeed)
+		}
+	}
+
+	cfg := NewTestConfig(WithPingCount(1), WithTLSConfig(TLSConfig{RootCAs: pool, ServerName: "invalid.test"}))
+	if err := newServer().PingTestWithConfig(context.Background(), cfg); err == nil {
+		t.Error("expected the certificate to be rejected for invalid.test")
+	}
+}
+
+func TestInsecureTransport(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(serveRandomImage))
+	defer ts.Close()
+
+	if err := downloadRequest(&http.Client{Transport: InsecureTransport()}, ts.URL+"/speedtest"); err != nil {
+		t.Fatal(err)
+	}
+	if c := http.DefaultTransport.(*http.Transport).TLSClientConfig; c != nil && c.InsecureSkipVerify {
+		t.Error("the default transport must not be modified")
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(serveRandomImage))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "speedtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := LoadCertPool(ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewHTTPClient(ConnConfig{TLS: &TLSConfig{RootCAs: pool}})
+	if err := downloadRequest(client, ts.URL+"/speedtest"); err != nil {
+		t.Fatal(err)
+	}
+
+	empty := filepath.Join(dir, "empty.pem")
+	if err := ioutil.WriteFile(empty, []byte("no certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCertPool(empty); err == nil {
+		t.Error("expected an error for a file without certificates")
+	}
+	if _, err := LoadCertPool(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,431 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultTraceMaxHops = 30
+	defaultTraceProbes  = 3
+	traceProbeTimeout   = time.Second
+	traceHopLimit       = 64
+
+	// traceBasePort is the first destination port of UDP probes, as used by traceroute(8).
+	traceBasePort = 33434
+	// maxProbeMTU is the largest path MTU probed for, that of Ethernet.
+	maxProbeMTU = 1500
+
+	icmpDestUnreachable   = 3
+	icmpTimeExceeded      = 11
+	icmpFragNeeded        = 4 // code of icmpDestUnreachable
+	icmpv6DestUnreachable = 1
+	icmpv6PacketTooBig    = 2
+	icmpv6TimeExceeded    = 3
+
+	protoICMP   = 1
+	protoUDP    = 17
+	protoICMPv6 = 58
+)
+
+// TraceMethod selects the probes of a path trace.
+type TraceMethod int
+
+const (
+	// TraceICMP probes with ICMP echo requests.
+	TraceICMP TraceMethod = iota
+	// TraceUDP probes with UDP datagrams to unlikely ports, like traceroute(8).
+	// Some networks filter ICMP echo requests but let these through.
+	TraceUDP
+)
+
+// String representation of TraceMethod
+func (m TraceMethod) String() string {
+	if m == TraceUDP {
+		return "udp"
+	}
+	return "icmp"
+}
+
+// MarshalText encodes the method as its string representation.
+func (m TraceMethod) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes a method encoded by MarshalText.
+func (m *TraceMethod) UnmarshalText(text []byte) error {
+	for _, method := range []TraceMethod{TraceICMP, TraceUDP} {
+		if method.String() == string(text) {
+			*m = method
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown trace method %q", text)
+}
+
+// Hop is a router on the path to a server, or the server itself.
+type Hop struct {
+	TTL int `json:"ttl"`
+	// IP is the address that answered the probes, empty if none did.
+	IP string `json:"ip,omitempty"`
+	// RTTs holds the round trip of every probe, 0 for probes that were not answered.
+	RTTs []time.Duration `json:"rtts"`
+}
+
+// hopJSON is the wire format of Hop.
+type hopJSON struct {
+	TTL    int       `json:"ttl"`
+	IP     string    `json:"ip,omitempty"`
+	RTTsMs []float64 `json:"rtts_ms"`
+}
+
+// MarshalJSON encodes the hop with its round trips in milliseconds.
+func (h Hop) MarshalJSON() ([]byte, error) {
+	v := hopJSON{TTL: h.TTL, IP: h.IP}
+	if h.RTTs != nil {
+		v.RTTsMs = make([]float64, len(h.RTTs))
+		for i, rtt := range h.RTTs {
+			v.RTTsMs[i] = milliseconds(rtt)
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a hop encoded by MarshalJSON.
+func (h *Hop) UnmarshalJSON(data []byte) error {
+	var v hopJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*h = Hop{TTL: v.TTL, IP: v.IP}
+	if v.RTTsMs != nil {
+		h.RTTs = make([]time.Duration, len(v.RTTsMs))
+		for i, ms := range v.RTTsMs {
+			h.RTTs[i] = fromMilliseconds(ms)
+		}
+	}
+	return nil
+}
+
+// Path is the route to a server as captured by a path trace.
+type Path struct {
+	Method      TraceMethod `json:"method"`
+	Destination string      `json:"destination"`
+	Hops        []Hop       `json:"hops"`
+	// Reached reports whether the server answered; if not, Hops ends at TestConfig.TraceMaxHops.
+	Reached bool `json:"reached"`
+	// MTU is the path MTU in bytes, probed up to 1500 with unfragmentable ICMP echo requests. 0 if not detected.
+	MTU int `json:"mtu,omitempty"`
+	// Error is the error that stopped the trace, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// TracePath captures the path to the server with the probes selected by cfg and records it in Server.Path,
+// along with the error that stopped the trace, if any.
+// Tracing requires the privilege to open raw sockets and is not available for proxied tests or over WithDialer.
+func (s *Server) TracePath(ctx context.Context, cfg TestConfig) error {
+	path := &Path{Method: cfg.TraceMethod}
+	err := s.tracePath(ctx, cfg, path)
+	if err != nil {
+		path.Error = err.Error()
+	}
+	s.Path = path
+	return err
+}
+
+func (s *Server) tracePath(ctx context.Context, cfg TestConfig, path *Path) error {
+	if s.proxy != nil {
+		return errors.New("path tracing is not available through a proxy")
+	}
+	if s.netDialer != nil {
+		return errors.New("path tracing is not available over a custom dialer")
+	}
+	maxHops := cfg.TraceMaxHops
+	if maxHops <= 0 {
+		maxHops = defaultTraceMaxHops
+	}
+	probes := cfg.TraceProbes
+	if probes <= 0 {
+		probes = defaultTraceProbes
+	}
+
+	c, err := dialICMP(ctx, s.dialer, s.hostname(), cfg.network("ip"))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	path.Destination = c.dst.IP.String()
+
+	t := &tracer{icmpConn: c, method: cfg.TraceMethod}
+	if t.method == TraceUDP {
+		network := "udp4"
+		if c.v6 {
+			network = "udp6"
+		}
+		if t.udp, err = net.ListenPacket(network, ""); err != nil {
+			return err
+		}
+		defer t.udp.Close()
+	}
+
+	for ttl := 1; ttl <= maxHops && !path.Reached; ttl++ {
+		if err := t.setHopLimit(ttl); err != nil {
+			return err
+		}
+		hop := Hop{TTL: ttl, RTTs: make([]time.Duration, probes)}
+		for i := range hop.RTTs {
+			from, rtt, reached, err := t.probe(ctx)
+			if err != nil {
+				path.Hops = append(path.Hops, hop)
+				return err
+			}
+			if from != nil {
+				hop.IP = from.String()
+				hop.RTTs[i] = rtt
+				path.Reached = path.Reached || reached
+			}
+		}
+		path.Hops = append(path.Hops, hop)
+	}
+
+	if path.Reached {
+		path.MTU, err = t.discoverMTU(ctx)
+	}
+	return err
+}
+
+// tracer sends TTL-limited probes and matches the ICMP messages they trigger, received on the raw socket of icmpConn.
+type tracer struct {
+	*icmpConn
+	method TraceMethod
+	udp    net.PacketConn // sends the probes of TraceUDP
+}
+
+// setHopLimit sets the TTL of the probes that follow.
+func (t *tracer) setHopLimit(ttl int) error {
+	if t.udp != nil {
+		return setHopLimit(t.udp.(syscall.Conn), t.v6, ttl)
+	}
+	return setHopLimit(t.conn.(syscall.Conn), t.v6, ttl)
+}
+
+// probe sends a single probe and waits for the ICMP message it triggers.
+// It returns the address that answered, nil if none did in time, and whether that address is the destination.
+func (t *tracer) probe(ctx context.Context) (net.IP, time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, traceProbeTimeout)
+	defer cancel()
+	defer t.watch(ctx)()
+
+	t.seq++
+	sTime := time.Now()
+	var err error
+	if t.method == TraceUDP {
+		_, err = t.udp.WriteTo([]byte("speedtest-go"), &net.UDPAddr{IP: t.dst.IP, Port: t.udpPort()})
+	} else {
+		_, err = t.conn.WriteTo(icmpEcho(t.echoType(), t.id, t.seq, !t.v6), t.dst)
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, 0, false, nil
+			}
+			if ctx.Err() != nil {
+				return nil, 0, false, ctx.Err()
+			}
+			return nil, 0, false, err
+		}
+		ip, ok := from.(*net.IPAddr)
+		if !ok {
+			continue
+		}
+		if answered, reached := t.match(buf[:n], ip.IP); answered {
+			return ip.IP, time.Since(sTime), reached, nil
+		}
+	}
+}
+
+// match reports whether msg, received from src, answers the latest probe and whether it comes from the destination.
+func (t *tracer) match(msg []byte, src net.IP) (answered, reached bool) {
+	if len(msg) < 8 {
+		return false, false
+	}
+	typ := msg[0]
+
+	if t.method == TraceICMP && typ == t.echoReplyType() {
+		ok := t.matchEcho(msg) && src.Equal(t.dst.IP)
+		return ok, ok
+	}
+
+	switch {
+	case !t.v6 && typ == icmpTimeExceeded, t.v6 && typ == icmpv6TimeExceeded:
+		return t.matchEmbedded(msg[8:]), false
+	case !t.v6 && typ == icmpDestUnreachable, t.v6 && typ == icmpv6DestUnreachable:
+		// The destination rejects UDP probes to its closed ports.
+		return t.matchEmbedded(msg[8:]), src.Equal(t.dst.IP)
+	}
+	return false, false
+}
+
+// matchEcho reports whether the echo message msg carries the identifier and sequence number of the latest probe.
+func (t *tracer) matchEcho(msg []byte) bool {
+	return len(msg) >= 8 && binary.BigEndian.Uint16(msg[4:]) == t.id && binary.BigEndian.Uint16(msg[6:]) == t.seq
+}
+
+// matchEmbedded reports whether the IP packet quoted by an ICMP error message is the latest probe.
+func (t *tracer) matchEmbedded(packet []byte) bool {
+	var proto byte
+	var payload []byte
+	if t.v6 {
+		if len(packet) < 40 {
+			return false
+		}
+		proto, payload = packet[6], packet[40:]
+	} else {
+		if len(packet) < 20 {
+			return false
+		}
+		ihl := int(packet[0]&0x0f) * 4
+		if len(packet) < ihl {
+			return false
+		}
+		proto, payload = packet[9], packet[ihl:]
+	}
+
+	if t.method == TraceUDP {
+		return proto == protoUDP && len(payload) >= 4 && int(binary.BigEndian.Uint16(payload[2:])) == t.udpPort()
+	}
+	if t.v6 && proto != protoICMPv6 || !t.v6 && proto != protoICMP {
+		return false
+	}
+	return len(payload) >= 8 && payload[0] == t.echoType() && t.matchEcho(payload)
+}
+
+// discoverMTU searches the largest unfragmentable echo request the destination answers, up to maxProbeMTU.
+func (t *tracer) discoverMTU(ctx context.Context) (int, error) {
+	if err := setHopLimit(t.conn.(syscall.Conn), t.v6, traceHopLimit); err != nil {
+		return 0, err
+	}
+	if err := setDontFragment(t.conn.(syscall.Conn), t.v6); err != nil {
+		return 0, err
+	}
+
+	// Every link carries the minimum MTU of the protocol.
+	lo, hi := 576, maxProbeMTU+1
+	if t.v6 {
+		lo = 1280
+	}
+	for lo+1 < hi {
+		mtu := (lo + hi) / 2
+		if lo+1 < hi-1 && hi == maxProbeMTU+1 {
+			// Most paths carry the full size, try it first.
+			mtu = maxProbeMTU
+		}
+		ok, next, err := t.probeMTU(ctx, mtu)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mtu
+			continue
+		}
+		hi = mtu
+		if next > lo && next < hi {
+			// A router advertised the MTU of its next hop.
+			hi = next + 1
+		}
+	}
+	return lo, nil
+}
+
+// probeMTU reports whether an unfragmentable echo request of mtu bytes reaches the destination, retrying once
+// if neither a reply nor an error arrives. next is the MTU advertised by a router rejecting it, if any.
+func (t *tracer) probeMTU(ctx context.Context, mtu int) (ok bool, next int, err error) {
+	header := 20
+	if t.v6 {
+		header = 40
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		ok, next, answered, err := t.sendMTUProbe(ctx, mtu-header)
+		if err != nil || answered {
+			return ok, next, err
+		}
+	}
+	return false, 0, nil
+}
+
+func (t *tracer) sendMTUProbe(ctx context.Context, size int) (ok bool, next int, answered bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, traceProbeTimeout)
+	defer cancel()
+	defer t.watch(ctx)()
+
+	t.seq++
+	msg := icmpEcho(t.echoType(), t.id, t.seq, false)
+	msg = append(msg, make([]byte, size-len(msg))...)
+	if !t.v6 {
+		binary.BigEndian.PutUint16(msg[2:], internetChecksum(msg))
+	}
+	if _, err := t.conn.WriteTo(msg, t.dst); err != nil {
+		if errors.Is(err, syscall.EMSGSIZE) {
+			// Larger than the MTU of the outgoing interface.
+			return false, 0, true, nil
+		}
+		return false, 0, false, err
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return false, 0, false, nil
+			}
+			if ctx.Err() != nil {
+				return false, 0, false, ctx.Err()
+			}
+			return false, 0, false, err
+		}
+		reply := buf[:n]
+		if n < 8 {
+			continue
+		}
+		switch {
+		case reply[0] == t.echoReplyType() && t.matchEcho(reply):
+			return true, 0, true, nil
+		case !t.v6 && reply[0] == icmpDestUnreachable && reply[1] == icmpFragNeeded && t.matchEmbedded(reply[8:]):
+			return false, int(binary.BigEndian.Uint16(reply[6:])), true, nil
+		case t.v6 && reply[0] == icmpv6PacketTooBig && t.matchEmbedded(reply[8:]):
+			return false, int(binary.BigEndian.Uint32(reply[4:])), true, nil
+		}
+	}
+}
+
+func (t *tracer) echoType() byte {
+	if t.v6 {
+		return icmpv6EchoRequest
+	}
+	return icmpEchoRequest
+}
+
+func (t *tracer) echoReplyType() byte {
+	if t.v6 {
+		return icmpv6EchoReply
+	}
+	return icmpEchoReply
+}
+
+// udpPort returns the destination port of the latest UDP probe, which identifies it.
+func (t *tracer) udpPort() int {
+	return traceBasePort + int(t.seq)%1000
+}
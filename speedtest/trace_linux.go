@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+package speedtest
+
+import (
+	"syscall"
+)
+
+// ipPMTUDiscProbe sets the don't fragment bit while ignoring the path MTU cached by the kernel.
+const ipPMTUDiscProbe = 3
+
+// setHopLimit sets the TTL, or hop limit for IPv6, of the packets sent on c.
+func setHopLimit(c syscall.Conn, v6 bool, ttl int) error {
+	if v6 {
+		return setsockoptInt(c, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl)
+	}
+	return setsockoptInt(c, syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+}
+
+// setDontFragment makes the packets sent on c unfragmentable, so that oversized ones are rejected instead.
+func setDontFragment(c syscall.Conn, v6 bool) error {
+	if v6 {
+		return setsockoptInt(c, syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_PROBE)
+	}
+	return setsockoptInt(c, syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, ipPMTUDiscProbe)
+}
+
+func setsockoptInt(c syscall.Conn, level, opt, value int) error {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), level, opt, value)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
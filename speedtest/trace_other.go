@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package speedtest
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errTraceUnsupported = errors.New("path tracing is not supported on this platform")
+
+// setHopLimit sets the TTL, or hop limit for IPv6, of the packets sent on c.
+func setHopLimit(c syscall.Conn, v6 bool, ttl int) error {
+	return errTraceUnsupported
+}
+
+// setDontFragment makes the packets sent on c unfragmentable, so that oversized ones are rejected instead.
+func setDontFragment(c syscall.Conn, v6 bool) error {
+	return errTraceUnsupported
+}
@@ -0,0 +1,79 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestTracePath(t *testing.T) {
+	if _, err := dialICMP(context.Background(), nil, "127.0.0.1", "ip"); errors.Is(err, os.ErrPermission) {
+		t.Skip("raw sockets are not permitted")
+	}
+
+	for _, method := range []TraceMethod{TraceICMP, TraceUDP} {
+		server := &Server{Host: "127.0.0.1:8080"}
+		if err := server.TracePath(context.Background(), NewTestConfig(WithPathTrace(method, 5))); err != nil {
+			t.Fatal(err)
+		}
+		p := server.Path
+		if !p.Reached || len(p.Hops) != 1 || p.Hops[0].IP != "127.0.0.1" || p.Hops[0].RTTs[0] <= 0 || p.MTU != maxProbeMTU {
+			t.Errorf("got unexpected %v path %+v", method, p)
+		}
+	}
+}
+
+func TestPingTestTracePath(t *testing.T) {
+	l := newSocketTestServer(t)
+	defer l.Close()
+
+	server := &Server{Host: l.Addr().String(), Type: OoklaSocketServer}
+	cfg := NewTestConfig(WithPingCount(2), WithPathTrace(TraceICMP, 2))
+	if err := server.PingTestWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Without raw sockets the trace fails, but the latency test does not.
+	if p := server.Result().Path; p == nil || !p.Reached && p.Error == "" {
+		t.Errorf("got unexpected path %+v", p)
+	}
+}
+
+func TestTracerMatch(t *testing.T) {
+	tr := &tracer{icmpConn: &icmpConn{dst: &net.IPAddr{IP: net.IPv4(192, 0, 2, 1)}, id: 7, seq: 3}}
+	router := net.IPv4(198, 51, 100, 1)
+
+	// A time exceeded message quoting the IPv4 header and the first 8 bytes of the probe.
+	quoted := make([]byte, 20)
+	quoted[0] = 0x45
+	quoted[9] = protoICMP
+	quoted = append(quoted, icmpEcho(icmpEchoRequest, 7, 3, true)[:8]...)
+	msg := append([]byte{icmpTimeExceeded, 0, 0, 0, 0, 0, 0, 0}, quoted...)
+	if answered, reached := tr.match(msg, router); !answered || reached {
+		t.Errorf("got answered %v and reached %v for time exceeded", answered, reached)
+	}
+
+	tr.seq++
+	if answered, _ := tr.match(msg, router); answered {
+		t.Error("a message quoting a previous probe must not match")
+	}
+
+	reply := icmpEcho(icmpEchoReply, 7, 4, true)
+	if answered, reached := tr.match(reply, tr.dst.IP); !answered || !reached {
+		t.Errorf("got answered %v and reached %v for echo reply", answered, reached)
+	}
+
+	// A UDP probe rejected by the destination.
+	tr.method = TraceUDP
+	udp := make([]byte, 8)
+	binary.BigEndian.PutUint16(udp[2:], uint16(tr.udpPort()))
+	quoted = append(make([]byte, 20), udp...)
+	quoted[0] = 0x45
+	quoted[9] = protoUDP
+	msg = append([]byte{icmpDestUnreachable, 3, 0, 0, 0, 0, 0, 0}, quoted...)
+	if answered, reached := tr.match(msg, tr.dst.IP); !answered || !reached {
+		t.Errorf("got answered %v and reached %v for port unreachable", answered, reached)
+	}
+}
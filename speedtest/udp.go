@@ -0,0 +1,86 @@
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// udpConn measures round trips with PING datagrams, which speedtest.net servers answer with PONG on the socket port.
+type udpConn struct {
+	conn net.Conn
+}
+
+// dialUDP connects a UDP socket to addr over network, "udp", "udp4" or "udp6", with d, or the default dialer if d is nil.
+func dialUDP(ctx context.Context, d ContextDialer, addr, network string) (*udpConn, error) {
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	recordRemote(ctx, conn.RemoteAddr())
+	return &udpConn{conn: conn}, nil
+}
+
+// udpDialer returns the dialer for UDP sockets: the custom network stack if set, or the bound dialer.
+func (s *Server) udpDialer() ContextDialer {
+	if s.netDialer != nil {
+		return s.netDialer
+	}
+	if s.dialer == nil {
+		return nil
+	}
+	d := *s.dialer
+	// The local address of a bound dialer is a TCP address; use its IP for UDP.
+	if a, ok := d.LocalAddr.(*net.TCPAddr); ok {
+		d.LocalAddr = &net.UDPAddr{IP: a.IP}
+	}
+	return &d
+}
+
+// ping measures a single PING/PONG round trip.
+// Replies that are not PONG, such as a late reply to a previous ping, are skipped.
+func (c *udpConn) ping(ctx context.Context) (time.Duration, error) {
+	defer c.watch(ctx)()
+
+	sTime := time.Now()
+	if _, err := fmt.Fprintf(c.conn, "PING %d\n", sTime.UnixNano()/int64(time.Millisecond)); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 512)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		if strings.HasPrefix(string(buf[:n]), "PONG") {
+			return time.Since(sTime), nil
+		}
+	}
+}
+
+// watch bounds reads by the deadline of ctx and aborts them when ctx is done. The returned function stops watching.
+func (c *udpConn) watch(ctx context.Context) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetReadDeadline(deadline)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// Close closes the socket.
+func (c *udpConn) Close() error {
+	return c.conn.Close()
+}
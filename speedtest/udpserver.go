@@ -0,0 +1,218 @@
+package speedtest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// udpSessionTTL is how long the UDP test server keeps the state of a session after its latest datagram.
+	udpSessionTTL = time.Minute
+	// udpMaxSessions bounds the sessions the UDP test server keeps; datagrams of new sessions past it are dropped.
+	udpMaxSessions = 1024
+	// udpMaxRate and udpMaxDuration bound the downloads the UDP test server sends, in bytes/s.
+	udpMaxRate     = 1e9 / 8
+	udpMaxDuration = time.Minute
+	// udpMaxDownloads and udpMaxHostDownloads bound the downloads the UDP test server sends at once, in total
+	// and to a single host.
+	udpMaxDownloads     = 16
+	udpMaxHostDownloads = 2
+	// udpCookieLen is the length of the cookie a client echoes to confirm a download.
+	udpCookieLen = 16
+)
+
+// udpSessionKey identifies a session of the UDP test server.
+type udpSessionKey struct {
+	addr string
+	id   uint32
+}
+
+// udpSession is the state of an upload received or a download sent by the UDP test server.
+type udpSession struct {
+	receiver udpReceiver
+	seen     time.Time
+}
+
+// udpDownloads counts the downloads the UDP test server is sending, per host.
+type udpDownloads struct {
+	mu     sync.Mutex
+	total  int
+	byHost map[string]int
+}
+
+// acquire reports whether a download to host may start, counting it if so.
+func (d *udpDownloads) acquire(host string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.total >= udpMaxDownloads || d.byHost[host] >= udpMaxHostDownloads {
+		return false
+	}
+	d.total++
+	d.byHost[host]++
+	return true
+}
+
+// release ends a download to host.
+func (d *udpDownloads) release(host string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.total--
+	if d.byHost[host]--; d.byHost[host] <= 0 {
+		delete(d.byHost, host)
+	}
+}
+
+// ServeUDP answers the UDP tests of UDPTest on conn until it is closed, as a companion to a LibreSpeed backend or
+// any other server, usually on port 5202 of its host. It returns nil once conn is closed, and the error of a failed read otherwise.
+//
+// The server never answers a datagram with more than it received until the sender proved it receives at its address:
+// a download starts only once the client echoes the cookie the server answered its start with. Downloads are capped
+// at 1 Gbit/s and a minute, 16 at once and 2 to the same host.
+func ServeUDP(conn net.PacketConn) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	downloads := &udpDownloads{byHost: map[string]int{}}
+	sessions := map[udpSessionKey]*udpSession{}
+	buf := make([]byte, udpMaxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		kind, id, body, ok := parseUDPHeader(buf[:n])
+		if !ok {
+			continue
+		}
+
+		if kind == udpKindStart && len(body) >= udpStartLen {
+			// The cookie is no larger than the start, and is all a spoofed start gets sent to its victim.
+			reply := make([]byte, udpHeaderLen+udpCookieLen)
+			copy(udpHeader(reply, udpKindCookie, id), udpCookie(secret, addr, id, body[:udpStartLen]))
+			_, _ = conn.WriteTo(reply, addr)
+			continue
+		}
+
+		now := time.Now()
+		key := udpSessionKey{addr: addr.String(), id: id}
+		session, found := sessions[key]
+		if !found && (kind == udpKindData || kind == udpKindStats || kind == udpKindConfirm) {
+			for k, s := range sessions {
+				if now.Sub(s.seen) > udpSessionTTL {
+					delete(sessions, k)
+				}
+			}
+			if len(sessions) >= udpMaxSessions {
+				continue
+			}
+			if kind == udpKindConfirm {
+				// A confirmation resent by the client finds its session and is ignored.
+				if len(body) < udpStartLen+udpCookieLen ||
+					!hmac.Equal(body[udpStartLen:udpStartLen+udpCookieLen], udpCookie(secret, addr, id, body[:udpStartLen])) {
+					continue
+				}
+				host := udpHost(addr)
+				if !downloads.acquire(host) {
+					continue
+				}
+				start := append([]byte(nil), body[:udpStartLen]...)
+				go func() {
+					defer downloads.release(host)
+					serveUDPDownload(ctx, conn, addr, id, start)
+				}()
+			}
+			session = &udpSession{}
+			sessions[key] = session
+		}
+		if session == nil {
+			continue
+		}
+		session.seen = now
+
+		switch {
+		case kind == udpKindData && len(body) >= 16:
+			session.receiver.add(body, n, now)
+		case kind == udpKindStats && n >= udpReportLen:
+			// Requests are padded to the size of the report, which is not sent for shorter ones.
+			// An upload whose datagrams were all lost is reported as such.
+			reply := make([]byte, udpReportLen)
+			b := udpHeader(reply, udpKindReport, id)
+			r := session.receiver
+			binary.BigEndian.PutUint64(b, uint64(r.received))
+			binary.BigEndian.PutUint64(b[8:], uint64(r.bytes))
+			binary.BigEndian.PutUint64(b[16:], uint64(r.reordered))
+			binary.BigEndian.PutUint64(b[24:], uint64(int64(r.jitter)))
+			_, _ = conn.WriteTo(reply, addr)
+		}
+	}
+}
+
+// udpCookie returns the cookie of the download of session requested by start from addr.
+func udpCookie(secret []byte, addr net.Addr, session uint32, start []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(addr.String()))
+	var id [4]byte
+	binary.BigEndian.PutUint32(id[:], session)
+	mac.Write(id[:])
+	mac.Write(start)
+	return mac.Sum(nil)[:udpCookieLen]
+}
+
+// udpHost returns the host of addr, or addr itself if it has no port.
+func udpHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// serveUDPDownload sends the download requested by the start datagram body to addr.
+func serveUDPDownload(ctx context.Context, conn net.PacketConn, addr net.Addr, session uint32, body []byte) {
+	rate := binary.BigEndian.Uint64(body)
+	size := int(binary.BigEndian.Uint32(body[8:]))
+	duration := time.Duration(binary.BigEndian.Uint64(body[12:]))
+	if rate == 0 || size < udpDataLen || size > udpMaxPacketSize || duration <= 0 {
+		return
+	}
+	if rate > udpMaxRate {
+		rate = udpMaxRate
+	}
+	if duration > udpMaxDuration {
+		duration = udpMaxDuration
+	}
+
+	buf := make([]byte, size)
+	data := udpHeader(buf, udpKindData, session)
+	sent, elapsed, _ := paceDatagrams(ctx, float64(rate)*8/1000/1000, size, duration, func(seq uint64) error {
+		binary.BigEndian.PutUint64(data, seq)
+		binary.BigEndian.PutUint64(data[8:], uint64(time.Now().UnixNano()))
+		// Datagrams the socket cannot send are lost, as on the path.
+		_, _ = conn.WriteTo(buf, addr)
+		return nil
+	})
+
+	end := make([]byte, udpHeaderLen+16)
+	b := udpHeader(end, udpKindEnd, session)
+	binary.BigEndian.PutUint64(b, uint64(sent))
+	binary.BigEndian.PutUint64(b[8:], uint64(elapsed))
+	// The end is sent a few times, as it may be lost like any datagram.
+	for i := 0; i < udpAttempts; i++ {
+		_, _ = conn.WriteTo(end, addr)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
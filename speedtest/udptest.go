@@ -0,0 +1,390 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// defaultUDPTestPort is the port of the companion UDP test server on the server's host, see ServeUDP.
+	defaultUDPTestPort = "5202"
+	// defaultUDPRate is the rate in Mbit/s of UDP tests without TestConfig.UDPRate.
+	defaultUDPRate = 10
+	// defaultUDPPacketSize fits the MTU of most paths, tunnels included.
+	defaultUDPPacketSize = 1200
+	// defaultUDPDuration is the duration of each direction of UDP tests without a TestConfig.Duration.
+	defaultUDPDuration = 5 * time.Second
+	// udpReplyTimeout bounds the wait for a control reply, which is resent on timeout up to udpAttempts times.
+	udpReplyTimeout = time.Second
+	udpAttempts     = 3
+)
+
+// UDPStats describes the datagrams sent in one direction of a UDP test.
+type UDPStats struct {
+	TargetSpeed float64 `json:"target_speed"` // Mbit/s the datagrams were sent at
+	Speed       float64 `json:"speed"`        // Mbit/s received
+	Sent        int64   `json:"sent"`
+	Received    int64   `json:"received"`
+	Loss        float64 `json:"loss"` // percentage of datagrams lost
+	// Reordered counts the datagrams received after one sent later.
+	Reordered int64 `json:"reordered"`
+	// Jitter is the mean deviation of the transit time of consecutive datagrams, as defined by RFC 3550.
+	Jitter time.Duration `json:"jitter"`
+}
+
+// udpStatsJSON is the wire format of UDPStats.
+type udpStatsJSON struct {
+	TargetSpeed float64 `json:"target_speed"`
+	Speed       float64 `json:"speed"`
+	Sent        int64   `json:"sent"`
+	Received    int64   `json:"received"`
+	Loss        float64 `json:"loss"`
+	Reordered   int64   `json:"reordered"`
+	JitterMs    float64 `json:"jitter_ms"`
+}
+
+// MarshalJSON encodes the statistics with the jitter in milliseconds.
+func (st UDPStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(udpStatsJSON{st.TargetSpeed, st.Speed, st.Sent, st.Received, st.Loss, st.Reordered, milliseconds(st.Jitter)})
+}
+
+// UnmarshalJSON decodes statistics encoded by MarshalJSON.
+func (st *UDPStats) UnmarshalJSON(data []byte) error {
+	var v udpStatsJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*st = UDPStats{v.TargetSpeed, v.Speed, v.Sent, v.Received, v.Loss, v.Reordered, fromMilliseconds(v.JitterMs)}
+	return nil
+}
+
+// UDPThroughput holds the results of UDPTest. A direction whose datagrams are policed or shaped, as some links do
+// to the UDP traffic of VoIP and VPNs, shows a Speed below TargetSpeed along with Loss.
+type UDPThroughput struct {
+	Download   UDPStats `json:"download"`
+	Upload     UDPStats `json:"upload"`
+	PacketSize int      `json:"packet_size"`
+}
+
+// UDPTest sends datagrams to and receives datagrams from the companion UDP test server of the server, see ServeUDP,
+// at cfg.UDPRate for cfg.Duration each, and records the rate, loss, reordering and jitter of each direction
+// in Server.UDP. The test server is at cfg.UDPAddr, or port 5202 of the server's host.
+// Unlike TCP tests, it measures the rate the path sustains at the given sending rate rather than its capacity.
+func (s *Server) UDPTest(ctx context.Context, cfg TestConfig) error {
+	addr := cfg.UDPAddr
+	if addr == "" {
+		addr = net.JoinHostPort(s.hostname(), defaultUDPTestPort)
+	}
+	rate := cfg.UDPRate
+	if rate <= 0 {
+		rate = defaultUDPRate
+	}
+	size := cfg.UDPPacketSize
+	if size <= 0 {
+		size = defaultUDPPacketSize
+	}
+	if size < udpDataLen || size > udpMaxPacketSize {
+		return fmt.Errorf("UDP packet size %d out of range %d to %d", size, udpDataLen, udpMaxPacketSize)
+	}
+	duration := cfg.Duration
+	if duration <= 0 {
+		duration = defaultUDPDuration
+	}
+
+	r := &remote{}
+	c, err := dialUDP(withRemote(ctx, r), s.udpDialer(), addr, cfg.network("udp"))
+	if err != nil {
+		return connError(ctx, err)
+	}
+	defer c.Close()
+
+	sTime := time.Now()
+	session := uint32(sTime.UnixNano())
+	u := &UDPThroughput{PacketSize: size}
+	if u.Upload, err = c.sendDatagrams(ctx, session, rate, size, duration); err != nil {
+		return err
+	}
+	if u.Download, err = c.receiveDatagrams(ctx, session+1, rate, size, duration); err != nil {
+		return err
+	}
+	s.UDP = u
+	s.setRemote(r.get())
+	s.markTest(sTime)
+	return nil
+}
+
+// The UDP test protocol. Every datagram starts with udpMagic, its kind and the session it belongs to;
+// integers are big-endian. A session is a single direction of a test, identified by the client address and its ID.
+//
+//	data:    seq uint64, send time int64 (ns), padding up to the packet size
+//	stats:   the client asks for the receiver statistics of an upload session, padded to the size of the report
+//	report:  received uint64, bytes uint64, reordered uint64, jitter int64 (ns)
+//	start:   the client asks for a download of rate uint64 (bytes/s), packet size uint32, duration int64 (ns)
+//	cookie:  the server answers a start with a cookie of 16 bytes
+//	confirm: the client echoes the start followed by the cookie from the same address, which starts the download
+//	end:     the server ends a download after sending sent uint64 datagrams over duration int64 (ns)
+//
+// No reply of the server is larger than the datagram it answers until the client confirmed it receives
+// at its address, so that the server cannot be used to flood a spoofed address.
+const (
+	udpMagic         = "SUDP"
+	udpHeaderLen     = len(udpMagic) + 1 + 4
+	udpDataLen       = udpHeaderLen + 16
+	udpStartLen      = 20
+	udpReportLen     = udpHeaderLen + 32
+	udpMaxPacketSize = 65507
+)
+
+const (
+	udpKindData byte = iota + 1
+	udpKindStats
+	udpKindReport
+	udpKindStart
+	udpKindEnd
+	udpKindCookie
+	udpKindConfirm
+)
+
+// udpHeader writes the header of a datagram of the given kind into b and returns the rest of b.
+func udpHeader(b []byte, kind byte, session uint32) []byte {
+	copy(b, udpMagic)
+	b[len(udpMagic)] = kind
+	binary.BigEndian.PutUint32(b[len(udpMagic)+1:], session)
+	return b[udpHeaderLen:]
+}
+
+// parseUDPHeader returns the kind, session and body of datagram b, or ok false if b is not a datagram of the protocol.
+func parseUDPHeader(b []byte) (kind byte, session uint32, body []byte, ok bool) {
+	if len(b) < udpHeaderLen || string(b[:len(udpMagic)]) != udpMagic {
+		return 0, 0, nil, false
+	}
+	return b[len(udpMagic)], binary.BigEndian.Uint32(b[len(udpMagic)+1:]), b[udpHeaderLen:], true
+}
+
+// udpReceiver accumulates the statistics of the datagrams received in a session.
+type udpReceiver struct {
+	received, bytes, reordered int64
+	next                       uint64 // the sequence number following the highest received
+	jitter                     float64
+	transit                    int64 // of the latest datagram, 0 before the first
+}
+
+// add records a data datagram of size bytes with body b received at now.
+func (r *udpReceiver) add(b []byte, size int, now time.Time) {
+	seq := binary.BigEndian.Uint64(b)
+	sent := int64(binary.BigEndian.Uint64(b[8:]))
+	r.received++
+	r.bytes += int64(size)
+	if seq < r.next {
+		r.reordered++
+	} else {
+		r.next = seq + 1
+	}
+
+	// RFC 3550 interarrival jitter; the offset of the clocks of sender and receiver cancels out.
+	transit := now.UnixNano() - sent
+	if r.transit != 0 {
+		d := float64(transit - r.transit)
+		if d < 0 {
+			d = -d
+		}
+		r.jitter += (d - r.jitter) / 16
+	}
+	r.transit = transit
+}
+
+// stats returns the statistics of the direction, of sent datagrams over elapsed at target Mbit/s.
+func (r *udpReceiver) stats(target float64, sent int64, elapsed time.Duration) UDPStats {
+	st := UDPStats{
+		TargetSpeed: target,
+		Speed:       mbps(uint64(r.bytes), elapsed),
+		Sent:        sent,
+		Received:    r.received,
+		Reordered:   r.reordered,
+		Jitter:      time.Duration(r.jitter),
+	}
+	if sent > 0 && r.received < sent {
+		st.Loss = float64(sent-r.received) / float64(sent) * 100
+	}
+	return st
+}
+
+// errNoUDPReply is returned when the UDP test server does not answer.
+var errNoUDPReply = errors.New("no reply from the UDP test server")
+
+// paceDatagrams sends datagrams with send at rate Mbit/s for duration, and returns how many were sent and how long it took.
+func paceDatagrams(ctx context.Context, rate float64, size int, duration time.Duration, send func(seq uint64) error) (int64, time.Duration, error) {
+	perSecond := float64(RateFromMbps(rate)) / float64(size)
+	start := time.Now()
+	var sent int64
+	for {
+		elapsed := time.Since(start)
+		if elapsed >= duration {
+			return sent, elapsed, nil
+		}
+		for due := int64(elapsed.Seconds()*perSecond) + 1; sent < due; sent++ {
+			if err := send(uint64(sent)); err != nil {
+				return sent, time.Since(start), err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return sent, time.Since(start), ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// sendDatagrams runs the upload direction of session and asks the server for its statistics.
+func (c *udpConn) sendDatagrams(ctx context.Context, session uint32, rate float64, size int, duration time.Duration) (UDPStats, error) {
+	buf := make([]byte, size)
+	body := udpHeader(buf, udpKindData, session)
+	sent, elapsed, err := paceDatagrams(ctx, rate, size, duration, func(seq uint64) error {
+		binary.BigEndian.PutUint64(body, seq)
+		binary.BigEndian.PutUint64(body[8:], uint64(time.Now().UnixNano()))
+		_, err := c.conn.Write(buf)
+		return err
+	})
+	if err != nil {
+		return UDPStats{}, connError(ctx, err)
+	}
+
+	req := make([]byte, udpReportLen)
+	udpHeader(req, udpKindStats, session)
+	for attempt := 0; attempt < udpAttempts; attempt++ {
+		if _, err := c.conn.Write(req); err != nil {
+			return UDPStats{}, connError(ctx, err)
+		}
+		b, err := c.await(ctx, session, udpKindReport, 32)
+		if errors.Is(err, errNoUDPReply) {
+			continue
+		}
+		if err != nil {
+			return UDPStats{}, err
+		}
+		r := udpReceiver{
+			received:  int64(binary.BigEndian.Uint64(b)),
+			bytes:     int64(binary.BigEndian.Uint64(b[8:])),
+			reordered: int64(binary.BigEndian.Uint64(b[16:])),
+			jitter:    float64(int64(binary.BigEndian.Uint64(b[24:]))),
+		}
+		return r.stats(rate, sent, elapsed), nil
+	}
+	return UDPStats{}, errNoUDPReply
+}
+
+// await reads datagrams until one of the given kind and session with a body of at least n bytes arrives, which it returns,
+// for up to udpReplyTimeout.
+func (c *udpConn) await(ctx context.Context, session uint32, kind byte, n int) ([]byte, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, udpReplyTimeout)
+	defer cancel()
+	defer c.watch(waitCtx)()
+	buf := make([]byte, udpMaxPacketSize)
+	for {
+		m, err := c.conn.Read(buf)
+		if err != nil {
+			if ctx.Err() == nil && waitCtx.Err() != nil {
+				return nil, errNoUDPReply
+			}
+			return nil, connError(ctx, err)
+		}
+		if k, id, body, ok := parseUDPHeader(buf[:m]); ok && k == kind && id == session && len(body) >= n {
+			return body, nil
+		}
+	}
+}
+
+// receiveDatagrams asks the server for the download direction of session and receives it.
+func (c *udpConn) receiveDatagrams(ctx context.Context, session uint32, rate float64, size int, duration time.Duration) (UDPStats, error) {
+	req := make([]byte, udpHeaderLen+udpStartLen+udpCookieLen)
+	body := udpHeader(req, udpKindStart, session)
+	binary.BigEndian.PutUint64(body, uint64(RateFromMbps(rate)))
+	binary.BigEndian.PutUint32(body[8:], uint32(size))
+	binary.BigEndian.PutUint64(body[12:], uint64(duration))
+	cookie, err := c.handshake(ctx, session, req[:udpHeaderLen+udpStartLen])
+	if err != nil {
+		return UDPStats{}, err
+	}
+	udpHeader(req, udpKindConfirm, session)
+	copy(body[udpStartLen:], cookie)
+
+	var r udpReceiver
+	buf := make([]byte, udpMaxPacketSize)
+	started := false
+	for attempt := 0; attempt < udpAttempts && !started; attempt++ {
+		if _, err := c.conn.Write(req); err != nil {
+			return UDPStats{}, connError(ctx, err)
+		}
+		sent, elapsed, err := c.receive(ctx, session, &r, buf, udpReplyTimeout)
+		if errors.Is(err, errNoUDPReply) {
+			continue
+		}
+		if err != nil {
+			return UDPStats{}, err
+		}
+		started = true
+		if sent >= 0 {
+			return r.stats(rate, sent, elapsed), nil
+		}
+	}
+	if !started {
+		return UDPStats{}, errNoUDPReply
+	}
+	// The end of the download was lost: measure it from its nominal duration, assuming every datagram was sent.
+	expected := int64(duration.Seconds()*float64(RateFromMbps(rate))/float64(size)) + 1
+	return r.stats(rate, expected, duration), nil
+}
+
+// handshake sends the start datagram of session and returns the cookie the server answers it with.
+func (c *udpConn) handshake(ctx context.Context, session uint32, start []byte) ([]byte, error) {
+	for attempt := 0; attempt < udpAttempts; attempt++ {
+		if _, err := c.conn.Write(start); err != nil {
+			return nil, connError(ctx, err)
+		}
+		b, err := c.await(ctx, session, udpKindCookie, udpCookieLen)
+		if errors.Is(err, errNoUDPReply) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b[:udpCookieLen]...), nil
+	}
+	return nil, errNoUDPReply
+}
+
+// receive records the data datagrams of session in r until the end of the download, returning the datagrams sent
+// and how long it took, or -1 if no datagram arrived for idle after the first. It returns errNoUDPReply
+// if no datagram arrived at all.
+func (c *udpConn) receive(ctx context.Context, session uint32, r *udpReceiver, buf []byte, idle time.Duration) (int64, time.Duration, error) {
+	defer c.watch(ctx)()
+	for {
+		_ = c.conn.SetReadDeadline(time.Now().Add(idle))
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			var ne net.Error
+			if ctx.Err() == nil && errors.As(err, &ne) && ne.Timeout() {
+				if r.received == 0 {
+					return 0, 0, errNoUDPReply
+				}
+				return -1, 0, nil
+			}
+			return 0, 0, connError(ctx, err)
+		}
+		kind, id, body, ok := parseUDPHeader(buf[:n])
+		if !ok || id != session {
+			continue
+		}
+		switch {
+		case kind == udpKindData && len(body) >= 16:
+			r.add(body, n, time.Now())
+		case kind == udpKindEnd && len(body) >= 16:
+			return int64(binary.BigEndian.Uint64(body)), time.Duration(binary.BigEndian.Uint64(body[8:])), nil
+		}
+	}
+}
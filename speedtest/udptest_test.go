@@ -0,0 +1,160 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// newUDPTestServer starts ServeUDP on a local port.
+func newUDPTestServer(t *testing.T) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeUDP(pc)
+	return pc
+}
+
+func TestUDPTest(t *testing.T) {
+	pc := newUDPTestServer(t)
+	defer pc.Close()
+
+	server := &Server{Host: "127.0.0.1"}
+	cfg := NewTestConfig(WithUDP(pc.LocalAddr().String(), 20, 1000), WithDuration(300*time.Millisecond))
+	if err := server.UDPTest(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	u := server.Result().UDP
+	if u == nil || u.PacketSize != 1000 {
+		t.Fatalf("got unexpected result %+v", u)
+	}
+	for name, st := range map[string]UDPStats{"upload": u.Upload, "download": u.Download} {
+		// 20 Mbit/s of 1000 byte datagrams is 2500 per second.
+		if st.Sent < 600 || st.Sent > 800 || st.Received == 0 || st.Received > st.Sent {
+			t.Errorf("%s: got %v datagrams received of %v sent", name, st.Received, st.Sent)
+		}
+		if st.TargetSpeed != 20 || st.Speed <= 0 || st.Speed > 25 {
+			t.Errorf("%s: got speed %v for target %v", name, st.Speed, st.TargetSpeed)
+		}
+	}
+	if server.IPVersion != 4 {
+		t.Errorf("got IP version %v", server.IPVersion)
+	}
+}
+
+func TestUDPTestNoServer(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	server := &Server{Host: "127.0.0.1"}
+	cfg := NewTestConfig(WithUDP(addr, 1, 0), WithDuration(100*time.Millisecond))
+	if err := server.UDPTest(context.Background(), cfg); err == nil {
+		t.Error("expected an error without UDP test server")
+	}
+	if err := server.UDPTest(context.Background(), NewTestConfig(WithUDP(addr, 1, 10))); err == nil {
+		t.Error("expected an error for a packet size below the header")
+	}
+}
+
+func TestUDPReceiver(t *testing.T) {
+	var r udpReceiver
+	now := time.Now()
+	body := make([]byte, 16)
+	for i, seq := range []uint64{0, 1, 3, 2, 4} {
+		binary.BigEndian.PutUint64(body, seq)
+		binary.BigEndian.PutUint64(body[8:], uint64(now.UnixNano()))
+		// Every datagram takes 1ms longer than the previous one.
+		r.add(body, 1000, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	st := r.stats(1, 8, time.Second)
+	if st.Received != 5 || st.Reordered != 1 || st.Loss != 37.5 || st.Speed != 0.04 {
+		t.Errorf("got unexpected stats %+v", st)
+	}
+	if st.Jitter <= 0 || st.Jitter > time.Millisecond {
+		t.Errorf("got unexpected jitter %v", st.Jitter)
+	}
+}
+
+func TestServeUDPReturnRoutability(t *testing.T) {
+	pc := newUDPTestServer(t)
+	defer pc.Close()
+	c, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	read := func() []byte {
+		buf := make([]byte, udpMaxPacketSize)
+		_ = c.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, err := c.Read(buf)
+		if err != nil {
+			return nil
+		}
+		return buf[:n]
+	}
+
+	start := make([]byte, udpHeaderLen+udpStartLen)
+	body := udpHeader(start, udpKindStart, 7)
+	binary.BigEndian.PutUint64(body, 1e6)
+	binary.BigEndian.PutUint32(body[8:], 1000)
+	binary.BigEndian.PutUint64(body[12:], uint64(100*time.Millisecond))
+	c.Write(start)
+	reply := read()
+	kind, id, cookie, ok := parseUDPHeader(reply)
+	if !ok || kind != udpKindCookie || id != 7 || len(reply) > len(start) {
+		t.Fatalf("got reply %x to a start, expected a cookie no larger than the start", reply)
+	}
+	if b := read(); b != nil {
+		t.Fatalf("got %x before the cookie was echoed", b)
+	}
+
+	// A wrong cookie starts nothing, and a short stats request is not answered.
+	confirm := append(append([]byte(nil), start...), make([]byte, udpCookieLen)...)
+	udpHeader(confirm, udpKindConfirm, 7)
+	c.Write(confirm)
+	stats := make([]byte, udpHeaderLen)
+	udpHeader(stats, udpKindStats, 8)
+	c.Write(stats)
+	if b := read(); b != nil {
+		t.Fatalf("got %x to an invalid confirmation and a short stats request", b)
+	}
+
+	copy(confirm[len(start):], cookie)
+	c.Write(confirm)
+	if kind, _, _, _ := parseUDPHeader(read()); kind != udpKindData {
+		t.Errorf("got no data after the cookie was echoed")
+	}
+}
+
+func TestUDPDownloadsLimit(t *testing.T) {
+	d := &udpDownloads{byHost: map[string]int{}}
+	for i := 0; i < udpMaxHostDownloads; i++ {
+		if !d.acquire("192.0.2.1") {
+			t.Fatalf("download %d refused", i)
+		}
+	}
+	if d.acquire("192.0.2.1") {
+		t.Error("expected the downloads to a host to be capped")
+	}
+	for i := udpMaxHostDownloads; i < udpMaxDownloads; i++ {
+		if !d.acquire(fmt.Sprintf("192.0.2.%d", i+10)) {
+			t.Fatalf("download %d refused", i)
+		}
+	}
+	if d.acquire("192.0.2.2") {
+		t.Error("expected the downloads to be capped")
+	}
+	d.release("192.0.2.1")
+	if !d.acquire("192.0.2.2") || len(d.byHost) != udpMaxDownloads-udpMaxHostDownloads+2 {
+		t.Errorf("got %d hosts after a release", len(d.byHost))
+	}
+}
@@ -2,20 +2,104 @@ package speedtest
 
 import (
 	"context"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
-const speedTestConfigUrl = "https://www.speedtest.net/speedtest-config.php"
+const (
+	speedTestConfigUrl = "https://www.speedtest.net/speedtest-config.php"
+	// DefaultIPInfoURL is the endpoint IPInfoProvider queries when its URL is empty.
+	DefaultIPInfoURL = "https://ipinfo.io/json"
+)
 
-// User represents information determined about the caller by speedtest.net
+// User represents information determined about the caller by speedtest.net or a UserInfoProvider.
 type User struct {
-	IP  string `xml:"ip,attr"`
-	Lat string `xml:"lat,attr"`
-	Lon string `xml:"lon,attr"`
-	Isp string `xml:"isp,attr"`
+	IP      string `xml:"ip,attr"`
+	Lat     string `xml:"lat,attr"`
+	Lon     string `xml:"lon,attr"`
+	Isp     string `xml:"isp,attr"`
+	Country string `xml:"country,attr"`
+	// ASN is the autonomous system of the caller's network, e.g. "AS7922". speedtest.net does not report it.
+	ASN string `xml:"-"`
+}
+
+// UserInfoProvider locates the caller in place of speedtest.net, see WithUserInfoProvider.
+type UserInfoProvider interface {
+	// FetchUserInfo determines information about the caller, sending its requests with doer.
+	FetchUserInfo(ctx context.Context, doer *http.Client) (*User, error)
+}
+
+// IPInfoProvider is a UserInfoProvider querying an ipinfo.io compatible endpoint, which reports the ASN of the caller.
+type IPInfoProvider struct {
+	// URL is the endpoint queried. Empty means DefaultIPInfoURL.
+	URL string
+	// Token, when set, is sent as bearer token, for the higher rate limits of registered users.
+	Token string
+}
+
+// ipInfo is the response of an ipinfo.io compatible endpoint.
+type ipInfo struct {
+	IP      string `json:"ip"`
+	Loc     string `json:"loc"` // "37.3860,-122.0838"
+	Org     string `json:"org"` // "AS7922 Comcast Cable Communications, LLC"
+	Country string `json:"country"`
+}
+
+// FetchUserInfo queries the endpoint of p.
+func (p IPInfoProvider) FetchUserInfo(ctx context.Context, doer *http.Client) (*User, error) {
+	rawURL := p.URL
+	if rawURL == "" {
+		rawURL = DefaultIPInfoURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+
+	resp, err := doer.Do(req)
+	if err != nil {
+		return nil, connError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	var v ipInfo
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	if v.IP == "" {
+		return nil, errors.New("failed to fetch user information")
+	}
+	user := &User{IP: v.IP, Country: v.Country}
+	user.ASN, user.Isp = splitOrg(v.Org)
+	if parts := strings.SplitN(v.Loc, ",", 2); len(parts) == 2 {
+		user.Lat, user.Lon = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	}
+	return user, nil
+}
+
+// splitOrg splits the organization of ipinfo.io, "AS7922 Comcast Cable Communications, LLC", into ASN and name.
+// An organization without ASN is returned as name.
+func splitOrg(org string) (asn, name string) {
+	if !strings.HasPrefix(org, "AS") {
+		return "", org
+	}
+	fields := strings.SplitN(org, " ", 2)
+	if len(fields) == 2 {
+		name = fields[1]
+	}
+	return fields[0], name
 }
 
 // Users for decode xml
@@ -33,8 +117,13 @@ func FetchUserInfo() (*User, error) {
 	return defaultClient.FetchUserInfo()
 }
 
-// FetchUserInfoContext returns information about caller determined by speedtest.net, observing the given context.
+// FetchUserInfoContext returns information about caller determined by speedtest.net, or by the provider set with
+// WithUserInfoProvider, observing the given context.
 func (client *Speedtest) FetchUserInfoContext(ctx context.Context) (*User, error) {
+	if client.userInfo != nil {
+		return client.userInfo.FetchUserInfo(ctx, client.doer)
+	}
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, speedTestConfigUrl, nil)
 	if err != nil {
 		return nil, err
@@ -71,3 +160,11 @@ func FetchUserInfoContext(ctx context.Context) (*User, error) {
 func (u *User) String() string {
 	return fmt.Sprintf("%s, (%s) [%s, %s]", u.IP, u.Isp, u.Lat, u.Lon)
 }
+
+// ClientInfo returns the information about the caller as recorded in Server.ClientInfo.
+func (u *User) ClientInfo() *ClientInfo {
+	info := &ClientInfo{IP: u.IP, ISP: u.Isp, ASN: u.ASN, Country: u.Country}
+	info.Lat, _ = strconv.ParseFloat(u.Lat, 64)
+	info.Lon, _ = strconv.ParseFloat(u.Lon, 64)
+	return info
+}
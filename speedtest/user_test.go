@@ -1,6 +1,11 @@
 package speedtest
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
@@ -44,3 +49,46 @@ func TestFetchUserInfo(t *testing.T) {
 		t.Errorf("Invalid Iso. got: %v;", user.Isp)
 	}
 }
+
+func TestIPInfoProvider(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"ip": "192.0.2.1", "loc": "35.6895,139.6917", "org": "AS2516 KDDI CORPORATION", "country": "JP"}`)
+	}))
+	defer ts.Close()
+
+	client := New(WithUserInfoProvider(IPInfoProvider{URL: ts.URL, Token: "secret"}))
+	user, err := client.FetchUserInfoContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := User{IP: "192.0.2.1", Lat: "35.6895", Lon: "139.6917", Isp: "KDDI CORPORATION", Country: "JP", ASN: "AS2516"}
+	if *user != expected {
+		t.Errorf("got unexpected user %+v", user)
+	}
+	info := user.ClientInfo()
+	if info.IP != "192.0.2.1" || info.ASN != "AS2516" || info.ISP != "KDDI CORPORATION" || info.Lat != 35.6895 || info.Lon != 139.6917 {
+		t.Errorf("got unexpected client info %+v", info)
+	}
+
+	client = New(WithUserInfoProvider(IPInfoProvider{URL: ts.URL}))
+	if _, err := client.FetchUserInfoContext(context.Background()); !errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("got %v, expected an HTTP status error without token", err)
+	}
+}
+
+func TestSplitOrg(t *testing.T) {
+	for org, expected := range map[string][2]string{
+		"AS7922 Comcast Cable Communications, LLC": {"AS7922", "Comcast Cable Communications, LLC"},
+		"AS7922":      {"AS7922", ""},
+		"Example ISP": {"", "Example ISP"},
+		"":            {"", ""},
+	} {
+		if asn, name := splitOrg(org); asn != expected[0] || name != expected[1] {
+			t.Errorf("splitOrg(%q) = %q, %q", org, asn, name)
+		}
+	}
+}
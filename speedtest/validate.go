@@ -0,0 +1,139 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Capabilities describes what a server supports, as probed by Validate.
+type Capabilities struct {
+	// Latency, Download and Upload report whether the latency, download and upload endpoints answered as expected.
+	Latency  bool `json:"latency"`
+	Download bool `json:"download"`
+	Upload   bool `json:"upload"`
+	// PayloadSize is the size in bytes of the smallest download payload as served, and ExpectedPayloadSize
+	// the size the protocol expects of it.
+	PayloadSize         int64 `json:"payload_size"`
+	ExpectedPayloadSize int64 `json:"expected_payload_size"`
+	// HTTPS is set when the HTTP endpoints were reached over TLS, whether the server's URL is https or redirects there.
+	HTTPS bool `json:"https"`
+	// RedirectURL is the URL the latency endpoint redirected to, if it did.
+	RedirectURL string `json:"redirect_url,omitempty"`
+	// LatencyError, DownloadError and UploadError are the errors of the failed probes.
+	LatencyError  string `json:"latency_error,omitempty"`
+	DownloadError string `json:"download_error,omitempty"`
+	UploadError   string `json:"upload_error,omitempty"`
+}
+
+// Valid reports whether every probe succeeded, so that the server can be tested.
+func (c *Capabilities) Valid() bool {
+	return c.Latency && c.Download && c.Upload
+}
+
+// errUploadRedirected is returned when an upload was redirected to a request without body.
+var errUploadRedirected = errors.New("upload redirected")
+
+// Validate probes the endpoints of the server before a test: the latency endpoint, the smallest download payload,
+// whose size is checked against the expected one, and a small upload, e.g. latency.txt, random350x350.jpg and upload.php
+// of speedtest.net servers and empty.php and garbage.php of LibreSpeed backends, following redirects.
+// It always returns the capabilities found, along with the error of the first failed probe, if any,
+// so that callers can exclude broken servers up front.
+func (s *Server) Validate(ctx context.Context) (*Capabilities, error) {
+	c := &Capabilities{ExpectedPayloadSize: int64(s.downloadPayload(0))}
+	var first error
+	record := func(ok *bool, msg *string, err error) {
+		*ok = err == nil
+		if err != nil {
+			*msg = err.Error()
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	if s.Type == OoklaSocketServer {
+		d := s.tcpDialer()
+		record(&c.Latency, &c.LatencyError, s.validateSocketPing(ctx, d))
+		m := &meter{}
+		record(&c.Download, &c.DownloadError, s.socketDownload(ctx, d, int(c.ExpectedPayloadSize), m))
+		c.PayloadSize = int64(m.total())
+		record(&c.Upload, &c.UploadError, s.socketUpload(ctx, d, ulPayload(0), nil))
+		return c, first
+	}
+
+	p, err := s.protocol()
+	if err != nil {
+		return c, err
+	}
+
+	req, err := p.BuildPingRequest(ctx, s)
+	if err == nil {
+		var answered *http.Request
+		answered, _, err = s.probe(req)
+		if answered != nil {
+			c.HTTPS = answered.URL.Scheme == "https"
+			if answered.URL.String() != req.URL.String() {
+				c.RedirectURL = answered.URL.String()
+			}
+		}
+	}
+	record(&c.Latency, &c.LatencyError, err)
+
+	req, err = p.BuildDownloadRequest(ctx, s, 0)
+	if err == nil {
+		_, c.PayloadSize, err = s.probe(req)
+		if err == nil {
+			err = checkPayload(req.URL.String(), c.PayloadSize, int(c.ExpectedPayloadSize))
+		}
+	}
+	record(&c.Download, &c.DownloadError, err)
+
+	newBody, length := uploadBody(ulSizes[0], func(n int64) io.Reader { return newPayload(n, PayloadRepeat) })
+	req, err = p.BuildUploadRequest(ctx, s, length)
+	if err == nil {
+		req.Body = newBody()
+		req.GetBody = func() (io.ReadCloser, error) { return newBody(), nil }
+		req.ContentLength = length
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		var answered *http.Request
+		answered, _, err = s.probe(req)
+		if err == nil && answered.Method != req.Method {
+			// A 301, 302 or 303 redirect turns the upload into a GET without body, which would measure nothing.
+			err = fmt.Errorf("%w: %s %s became %s %s", errUploadRedirected, req.Method, req.URL, answered.Method, answered.URL)
+		}
+	}
+	record(&c.Upload, &c.UploadError, err)
+
+	return c, first
+}
+
+// validateSocketPing probes the latency command of a socket server.
+func (s *Server) validateSocketPing(ctx context.Context, d ContextDialer) error {
+	c, err := dialSocket(ctx, d, s.socketAddr())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = c.ping(ctx)
+	return err
+}
+
+// probe sends req and returns the request that was answered, after redirects, and the size of the response body.
+func (s *Server) probe(req *http.Request) (*http.Request, int64, error) {
+	resp, err := s.doer.Do(req)
+	if err != nil {
+		return nil, 0, connError(req.Context(), err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return resp.Request, 0, err
+	}
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	return resp.Request, n, err
+}
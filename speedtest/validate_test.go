@@ -0,0 +1,95 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	ts := newLibrespeedTestServer(false)
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Type = LibrespeedServer
+	c, err := server.Validate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Valid() || c.HTTPS || c.RedirectURL != "" || c.PayloadSize != c.ExpectedPayloadSize || c.PayloadSize == 0 {
+		t.Errorf("got unexpected capabilities %+v", c)
+	}
+}
+
+func TestValidateStandardServer(t *testing.T) {
+	mux := http.NewServeMux()
+	// latency.txt redirects to a mirror that serves small images and turns uploads into GETs.
+	mux.HandleFunc("/speedtest/latency.txt", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/mirror/latency.txt", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/mirror/latency.txt", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "test=test")
+	})
+	mux.HandleFunc("/speedtest/random350x350.jpg", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "too small")
+	})
+	mux.HandleFunc("/speedtest/upload.php", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/mirror/upload.php", http.StatusFound)
+	})
+	mux.HandleFunc("/mirror/upload.php", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/speedtest/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := server.Validate(context.Background())
+	if !errors.Is(err, ErrPayloadTooSmall) {
+		t.Errorf("got error %v, expected the first failure to be the download", err)
+	}
+	if c.Valid() || !c.Latency || c.Download || c.Upload || c.RedirectURL != ts.URL+"/mirror/latency.txt" {
+		t.Errorf("got unexpected capabilities %+v", c)
+	}
+	if c.PayloadSize != 9 || c.DownloadError == "" || !strings.HasPrefix(c.UploadError, errUploadRedirected.Error()) {
+		t.Errorf("got unexpected probe results %+v", c)
+	}
+}
+
+func TestValidateUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := server.Validate(context.Background())
+	if !errors.Is(err, ErrServerUnreachable) || c.Latency || c.Download || c.Upload || c.LatencyError == "" {
+		t.Errorf("got %+v, %v", c, err)
+	}
+}
+
+func TestValidateSocketServer(t *testing.T) {
+	l := newSocketTestServer(t)
+	defer l.Close()
+
+	server := &Server{Type: OoklaSocketServer, Host: l.Addr().String()}
+	c, err := server.Validate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Valid() || c.PayloadSize != int64(dlPayload(0)) {
+		t.Errorf("got unexpected capabilities %+v", c)
+	}
+}
@@ -0,0 +1,95 @@
+package speedtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// warmUp runs the warm-up of a test on cfg.warmUpStreams() streams, each repeating request, which moves payload bytes,
+// until the budget of cfg is spent. Requests count their bytes with a meter shared by all streams and capped at
+// cfg.RateLimit. Connections are opened before timing starts, and the time streams still spend setting up connections
+// is excluded from the speed, so that it reflects the transfer rate even on high-latency links.
+// It returns the warm-up speed in Mbit/s, the bytes moved and how long the warm-up took.
+func (s *Server) warmUp(ctx context.Context, cfg TestConfig, doer *http.Client, payload int, request func(context.Context, *http.Client, *meter) error) (float64, int64, time.Duration, error) {
+	streams := cfg.warmUpStreams()
+	s.preconnect(ctx, cfg, doer, streams)
+
+	m := &meter{limit: newTokenBucket(ctx, cfg.RateLimit)}
+	var bytes int64
+	speeds := make([]float64, streams)
+	eg := errgroup.Group{}
+	sTime := time.Now()
+	for i := 0; i < streams; i++ {
+		i := i
+		eg.Go(func() error {
+			var getConn, setup int64 // nanoseconds
+			ctx := httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+				GetConn: func(string) {
+					atomic.StoreInt64(&getConn, time.Now().UnixNano())
+				},
+				GotConn: func(info httptrace.GotConnInfo) {
+					if !info.Reused {
+						atomic.AddInt64(&setup, time.Now().UnixNano()-atomic.LoadInt64(&getConn))
+					}
+				},
+			})
+
+			var moved int64
+			start := time.Now()
+			for {
+				if err := request(ctx, doer, m); err != nil {
+					return err
+				}
+				moved += int64(payload)
+				total := atomic.AddInt64(&bytes, int64(payload))
+				if !cfg.warmUpContinues(time.Since(sTime), total) || ctx.Err() != nil {
+					break
+				}
+			}
+			speeds[i] = warmUpSpeed(moved, time.Since(start)-time.Duration(atomic.LoadInt64(&setup)), s.Latency)
+			return nil
+		})
+	}
+	err := eg.Wait()
+
+	var speed float64
+	for _, v := range speeds {
+		speed += v
+	}
+	return speed, bytes, time.Since(sTime), err
+}
+
+// warmUpSpeed computes the speed of a warm-up stream in Mbit/s from the bytes it moved and the time it spent transferring.
+// If the bandwidth is so large that the transfer took less than the latency of the server, the latency is ignored.
+// This does not affect the final result since the warm-up only sizes the main phase.
+func warmUpSpeed(bytes int64, elapsed, latency time.Duration) float64 {
+	if elapsed-latency > 0 {
+		elapsed -= latency
+	}
+	return mbps(uint64(bytes), elapsed)
+}
+
+// preconnect opens connections to the server for n streams ahead of the warm-up, so that their setup is not timed.
+// It uses the latency endpoint and gives up silently, leaving the warm-up to open connections itself.
+// Socket servers, whose requests open their own connections, and tests without keep-alives are not preconnected.
+func (s *Server) preconnect(ctx context.Context, cfg TestConfig, doer *http.Client, n int) {
+	if doer == nil || s.Type == OoklaSocketServer || cfg.DisableKeepAlives {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	eg := errgroup.Group{}
+	for i := 0; i < n; i++ {
+		eg.Go(func() error {
+			_, err := s.httpPing(ctx, doer)
+			return err
+		})
+	}
+	_ = eg.Wait()
+}
@@ -0,0 +1,81 @@
+package speedtest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarmUpBudget(t *testing.T) {
+	server := &Server{URL: "http://dummy.com/upload.php"}
+	request := func(ctx context.Context, doer *http.Client, m *meter) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+
+	_, bytes, _, err := server.warmUp(context.Background(), TestConfig{}, nil, 1000, request)
+	if err != nil || bytes != 2000 {
+		t.Errorf("got %v bytes and error %v without budget, expected a request per stream", bytes, err)
+	}
+
+	speed, bytes, elapsed, err := server.warmUp(context.Background(), NewTestConfig(WithWarmUp(200*time.Millisecond, 0)), nil, 1000, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed < 200*time.Millisecond || bytes < 10000 || speed <= 0 {
+		t.Errorf("got %v bytes in '%v' at %v Mbit/s with a duration budget", bytes, elapsed, speed)
+	}
+
+	_, bytes, elapsed, err = server.warmUp(context.Background(), NewTestConfig(WithWarmUp(time.Minute, 5000)), nil, 1000, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes < 5000 || bytes > 6000 || elapsed > time.Second {
+		t.Errorf("got %v bytes in '%v' with a byte budget", bytes, elapsed)
+	}
+}
+
+func TestWarmUpPreconnect(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(serveRandomImage))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	server, err := New().CustomServer(ts.URL + "/speedtest/upload.php")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := server.protocol()
+	if err != nil {
+		t.Fatal(err)
+	}
+	warmUp, _ := server.httpDownloadFuncs(p)
+
+	var reused int32
+	request := func(ctx context.Context, doer *http.Client, m *meter) error {
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if info.Reused {
+					atomic.AddInt32(&reused, 1)
+				}
+			},
+		})
+		return warmUp(ctx, doer, m)
+	}
+	if _, _, _, err := server.warmUp(context.Background(), TestConfig{}, server.doer, server.downloadPayload(dlWarmUpWeight), request); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&conns); n != 2 || atomic.LoadInt32(&reused) != 2 {
+		t.Errorf("got %v connections and %v reused, expected the warm-up to reuse 2 preconnected connections", n, reused)
+	}
+}
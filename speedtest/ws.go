@@ -0,0 +1,254 @@
+package speedtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xa
+
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// wsMaxControlPayload is the largest payload of a control frame allowed by RFC 6455 section 5.5.
+	wsMaxControlPayload = 125
+	// wsMaxDataPayload is the largest data frame payload read; larger data frames are discarded.
+	wsMaxDataPayload = 64 * 1024
+)
+
+// errWSFrame is returned for frames that violate RFC 6455.
+var errWSFrame = errors.New("invalid websocket frame")
+
+// wsConn is a minimal RFC 6455 client connection, sufficient for measuring round trips with ping/pong control frames.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialWebSocket opens a WebSocket connection to rawURL (ws:// or wss://) with d, or the default dialer if d is nil.
+// wss connections are verified as adjusted by tc, which may be nil.
+func dialWebSocket(ctx context.Context, d ContextDialer, rawURL string, tc *TLSConfig) (*wsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "wss" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	recordRemote(ctx, conn.RemoteAddr())
+	if u.Scheme == "wss" {
+		conn = tls.Client(conn, tc.clientConfig(&tls.Config{ServerName: u.Hostname()}))
+	}
+
+	c := &wsConn{conn: conn, r: bufio.NewReader(conn)}
+	defer c.watch(ctx)()
+
+	if err := c.handshake(u); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *wsConn) handshake(u *url.URL) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+	if err := req.Write(c.conn); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(c.r, req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		return errors.New("websocket handshake failed: invalid Sec-WebSocket-Accept")
+	}
+	return nil
+}
+
+// wsAccept computes the Sec-WebSocket-Accept value for key.
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// watch aborts blocking I/O on the connection when ctx is done. The returned function stops watching.
+func (c *wsConn) watch(ctx context.Context) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// writeFrame writes a single masked frame, as required for frames sent by a client.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	if len(payload) > 125 {
+		return errors.New("websocket control frame payload too large")
+	}
+
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// readFrame reads a single frame and returns its opcode and payload, nil for data frames over wsMaxDataPayload.
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return 0, nil, err
+	}
+
+	opcode := head[0] & 0x0f
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if opcode&0x8 != 0 && length > wsMaxControlPayload {
+		return 0, nil, fmt.Errorf("%w: control frame of %d bytes", errWSFrame, length)
+	}
+	if length > math.MaxInt64 {
+		return 0, nil, fmt.Errorf("%w: length %d", errWSFrame, length)
+	}
+
+	var mask []byte
+	if head[1]&0x80 != 0 {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.r, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if length > wsMaxDataPayload {
+		// Round trips are measured with control frames, so large data frames are skipped rather than held in memory.
+		if _, err := io.CopyN(ioutil.Discard, c.r, int64(length)); err != nil {
+			return 0, nil, err
+		}
+		return opcode, nil, nil
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	if mask != nil {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+// ping measures a single ping/pong round trip.
+func (c *wsConn) ping(ctx context.Context) (time.Duration, error) {
+	defer c.watch(ctx)()
+
+	sTime := time.Now()
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, uint64(sTime.UnixNano()))
+	if err := c.writeFrame(wsOpPing, payload); err != nil {
+		return 0, err
+	}
+
+	for {
+		opcode, data, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		switch opcode {
+		case wsOpPong:
+			if bytes.Equal(data, payload) {
+				return time.Since(sTime), nil
+			}
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, data); err != nil {
+				return 0, err
+			}
+		case wsOpClose:
+			return 0, errors.New("websocket closed by server")
+		}
+	}
+}
+
+// Close sends a close frame and closes the connection.
+func (c *wsConn) Close() error {
+	_ = c.writeFrame(wsOpClose, []byte{0x03, 0xe8})
+	return c.conn.Close()
+}
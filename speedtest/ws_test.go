@@ -0,0 +1,42 @@
+package speedtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestWSReadFrame(t *testing.T) {
+	frame := func(opcode byte, length uint64, payload []byte) *wsConn {
+		var b bytes.Buffer
+		b.WriteByte(0x80 | opcode)
+		b.WriteByte(127)
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], length)
+		b.Write(ext[:])
+		b.Write(payload)
+		return &wsConn{r: bufio.NewReader(&b)}
+	}
+
+	if _, _, err := frame(wsOpPong, 1<<63+1, nil).readFrame(); !errors.Is(err, errWSFrame) {
+		t.Errorf("got %v for a length out of range", err)
+	}
+	if _, _, err := frame(0x2, 1<<63+1, nil).readFrame(); !errors.Is(err, errWSFrame) {
+		t.Errorf("got %v for a data frame length out of range", err)
+	}
+	if _, _, err := frame(wsOpPing, 126, make([]byte, 126)).readFrame(); !errors.Is(err, errWSFrame) {
+		t.Errorf("got %v for a control frame over 125 bytes", err)
+	}
+
+	c := frame(0x2, wsMaxDataPayload+1, make([]byte, wsMaxDataPayload+1))
+	opcode, payload, err := c.readFrame()
+	if err != nil || opcode != 0x2 || payload != nil || c.r.Buffered() != 0 {
+		t.Errorf("got opcode %v, %d bytes, %v, expected the large data frame to be discarded", opcode, len(payload), err)
+	}
+	opcode, payload, err = frame(wsOpPong, 8, []byte("12345678")).readFrame()
+	if err != nil || opcode != wsOpPong || string(payload) != "12345678" {
+		t.Errorf("got opcode %v, payload %q, %v", opcode, payload, err)
+	}
+}